@@ -5,6 +5,7 @@ import (
 	"fmt"
 	"os"
 	"os/signal"
+	"reflect"
 	"syscall"
 	"time"
 
@@ -21,7 +22,9 @@ import (
 	"github.com/local/picobot/internal/chat"
 	"github.com/local/picobot/internal/config"
 	"github.com/local/picobot/internal/cron"
+	"github.com/local/picobot/internal/doctor"
 	"github.com/local/picobot/internal/heartbeat"
+	"github.com/local/picobot/internal/pairing"
 	"github.com/local/picobot/internal/providers"
 )
 
@@ -31,7 +34,19 @@ func NewRootCmd() *cobra.Command {
 	rootCmd := &cobra.Command{
 		Use:   "picobot",
 		Short: "picobot — lightweight clawbot in Go",
+		PersistentPreRunE: func(cmd *cobra.Command, args []string) error {
+			path, _ := cmd.Flags().GetString("config")
+			profile, _ := cmd.Flags().GetString("profile")
+			if err := config.Select(path, profile); err != nil {
+				// a usage problem, but not with this command's arguments
+				cmd.SilenceUsage, cmd.SilenceErrors = true, true
+				return err
+			}
+			return nil
+		},
 	}
+	rootCmd.PersistentFlags().String("config", "", "config file to use (JSON, or YAML by extension; env PICOBOT_CONFIG)")
+	rootCmd.PersistentFlags().String("profile", "", "use the config in ~/.picobot/profiles/<name> (env PICOBOT_PROFILE)")
 
 	rootCmd.AddCommand(&cobra.Command{
 		Use:   "version",
@@ -66,7 +81,7 @@ func NewRootCmd() *cobra.Command {
 			}
 
 			hub := chat.NewHub(100)
-			cfg, _ := config.LoadConfig()
+			cfg := loadConfig()
 			var provider providers.LLMProvider
 			if cfg.Providers.OpenAI != nil && cfg.Providers.OpenAI.APIKey != "" {
 				provider = providers.NewOpenAIProvider(cfg.Providers.OpenAI.APIKey, cfg.Providers.OpenAI.APIBase, cfg.Providers.OpenAI.Timeout)
@@ -87,7 +102,7 @@ func NewRootCmd() *cobra.Command {
 			if maxIter <= 0 {
 				maxIter = 100
 			}
-			ag := agent.NewAgentLoop(hub, provider, model, maxIter, cfg.Agents.Defaults.Temperature, cfg.Agents.Defaults.MaxTokens, cfg.Agents.Defaults.Workspace, nil, &cfg.Tools, &cfg.Memory)
+			ag := agent.NewAgentLoop(hub, provider, model, maxIter, cfg.Agents.Defaults.Temperature, cfg.Agents.Defaults.MaxTokens, cfg.Agents.Defaults.Workspace, nil, &cfg.Tools, &cfg.Memory, cfg.Users, &cfg.Permissions, &cfg.RateLimit)
 
 			resp, err := ag.ProcessDirect(msg, time.Duration(cfg.Providers.OpenAI.Timeout)*time.Second)
 			if err != nil {
@@ -106,7 +121,7 @@ func NewRootCmd() *cobra.Command {
 		Short: "Start long-running gateway (agent, telegram, heartbeat)",
 		Run: func(cmd *cobra.Command, args []string) {
 			hub := chat.NewHub(200)
-			cfg, _ := config.LoadConfig()
+			cfg := loadConfig()
 			provider := providers.NewProviderFromConfig(cfg)
 
 			// choose model: flag > config > provider default
@@ -120,21 +135,60 @@ func NewRootCmd() *cobra.Command {
 			}
 
 			// create scheduler with fire callback that routes back through the agent loop, so the LLM can process the reminder and respond naturally to the user.
-			scheduler := cron.NewScheduler(func(job cron.Job) {
-				log.Printf("cron fired: %s — %s", job.Name, job.Message)
+			var scheduler *cron.Scheduler
+			scheduler = cron.NewScheduler(func(job cron.Job) {
+				log.Printf("cron fired: %s (%s) — %s", job.Name, job.Kind, job.Message)
+				late := ""
+				if time.Since(job.FireAt) > time.Minute {
+					late = fmt.Sprintf(" Note: it was due at %s, but picobot was not running then.", job.FireAt.Format("2006-01-02 15:04 MST"))
+				}
+				start := time.Now()
+				run := &chat.JobRun{ID: job.ID, Kind: job.Kind, Owner: job.SenderID, Tool: job.Tool, Args: job.Args,
+					Done: func(output string, err error) {
+						r := cron.Run{JobID: job.ID, Name: job.Name, Kind: job.Kind, Channel: job.Channel, ChatID: job.ChatID, DueAt: job.FireAt, Start: start, End: time.Now(), Status: cron.RunOK, Output: output}
+						if err != nil {
+							r.Status, r.Output = cron.RunFailed, err.Error()
+						}
+						scheduler.Record(r)
+					}}
+				content := job.Message
+				switch job.Kind {
+				case cron.KindRaw:
+					hub.Out <- chat.Outbound{Channel: job.Channel, ChatID: job.ChatID, Content: job.Message}
+					run.Finish(job.Message, nil)
+					return
+				case cron.KindAgent:
+					content = fmt.Sprintf("[Scheduled task %q] %s\n\nDo this now. Your reply is sent to the user as is, so reply with the result only.%s", job.Name, job.Message, late)
+				case cron.KindTool:
+				default:
+					content = fmt.Sprintf("[Scheduled reminder fired] %s — Please relay this to the user in a friendly way.%s", job.Message, late)
+				}
 				hub.In <- chat.Inbound{
 					Channel:  job.Channel,
 					SenderID: "cron",
 					ChatID:   job.ChatID,
-					Content:  fmt.Sprintf("[Scheduled reminder fired] %s — Please relay this to the user in a friendly way.", job.Message),
+					Content:  content,
+					Metadata: map[string]interface{}{chat.MetaJob: run},
 				}
 			})
+			if cfg.Cron.TimeZone != "" {
+				loc, err := time.LoadLocation(cfg.Cron.TimeZone)
+				if err != nil {
+					fmt.Fprintf(os.Stderr, "invalid cron.timeZone: %v\n", err)
+					os.Exit(1)
+				}
+				scheduler.SetTimeZone(loc)
+			}
+			if err := scheduler.Persist(cron.StorePath(cfg.Agents.Defaults.Workspace), cron.MissedPolicy(cfg.Cron.MissedRuns)); err != nil {
+				fmt.Fprintf(os.Stderr, "failed to load cron jobs: %v (fix or remove the file)\n", err)
+				os.Exit(1)
+			}
 
 			maxIter := cfg.Agents.Defaults.MaxToolIterations
 			if maxIter <= 0 {
 				maxIter = 100
 			}
-			ag := agent.NewAgentLoop(hub, provider, model, maxIter, cfg.Agents.Defaults.Temperature, cfg.Agents.Defaults.MaxTokens, cfg.Agents.Defaults.Workspace, scheduler, &cfg.Tools, &cfg.Memory)
+			ag := agent.NewAgentLoop(hub, provider, model, maxIter, cfg.Agents.Defaults.Temperature, cfg.Agents.Defaults.MaxTokens, cfg.Agents.Defaults.Workspace, scheduler, &cfg.Tools, &cfg.Memory, cfg.Users, &cfg.Permissions, &cfg.RateLimit)
 			ctx, cancel := context.WithCancel(context.Background())
 			defer cancel()
 
@@ -149,24 +203,42 @@ func NewRootCmd() *cobra.Command {
 			if hbInterval <= 0 {
 				hbInterval = 60 * time.Second
 			}
-			heartbeat.StartHeartbeat(ctx, cfg.Agents.Defaults.Workspace, hbInterval, hub)
+			hbLoc, _ := scheduler.Location("") // cron.timeZone, for times in HEARTBEAT.md too
+			heartbeat.StartHeartbeat(ctx, cfg.Agents.Defaults.Workspace, hbInterval, hbLoc, &cfg.Heartbeat, hub)
 
 			if err := channels.StartProxy(ctx, hub); err != nil {
 				log.Panicf("Failed to start proxy channel: %v\n", err)
 			}
 
-			// start telegram if enabled
-			if cfg.Channels.Telegram.Enabled {
-				if err := channels.StartTelegram(ctx, hub, cfg.Channels.Telegram.Token, cfg.Channels.Telegram.AllowFrom); err != nil {
-					fmt.Fprintf(os.Stderr, "failed to start telegram: %v\n", err)
+			// start the enabled channels; reloads restart only what changed
+			chans := channels.NewManager(ctx, hub, cfg.Agents.Defaults.Workspace, scheduler)
+			chans.Apply(cfg.Channels)
+
+			// reload the config when the file changes or on SIGHUP
+			hupCh := make(chan os.Signal, 1)
+			signal.Notify(hupCh, syscall.SIGHUP)
+			reloadCh := make(chan struct{}, 1)
+			go func() {
+				for range hupCh {
+					select {
+					case reloadCh <- struct{}{}:
+					default:
+					}
 				}
-			}
-			// start ntfy if enabled
-			if cfg.Channels.Ntfy.Enabled {
-				if err := channels.StartNtfy(ctx, hub, cfg.Channels.Ntfy.Server, cfg.Channels.Ntfy.Token, cfg.Channels.Ntfy.Topic); err != nil {
-					fmt.Fprintf(os.Stderr, "failed to start ntfy: %v\n", err)
+			}()
+			current := cfg
+			go config.Watch(ctx, config.ConfigPath(), reloadCh, func(next config.Config) {
+				if err := ag.Reconfigure(next, modelFlag); err != nil {
+					log.Printf("config: not reloading, %v", err)
+					return
 				}
-			}
+				chans.Apply(next.Channels)
+				for _, section := range restartRequired(current, next) {
+					log.Printf("config: changes to %s take effect after a restart", section)
+				}
+				current = next
+				log.Printf("config: reloaded")
+			})
 
 			// wait for signal
 			sigCh := make(chan os.Signal, 1)
@@ -191,7 +263,7 @@ func NewRootCmd() *cobra.Command {
 		Args:  cobra.ExactArgs(1),
 		Run: func(cmd *cobra.Command, args []string) {
 			target := args[0]
-			cfg, _ := config.LoadConfig()
+			cfg := loadConfig()
 			ws := cfg.Agents.Defaults.Workspace
 			if ws == "" {
 				ws = "~/.picobot/workspace"
@@ -225,7 +297,7 @@ func NewRootCmd() *cobra.Command {
 				fmt.Fprintln(cmd.ErrOrStderr(), "-c content required")
 				return
 			}
-			cfg, _ := config.LoadConfig()
+			cfg := loadConfig()
 			ws := cfg.Agents.Defaults.Workspace
 			if ws == "" {
 				ws = "~/.picobot/workspace"
@@ -274,7 +346,7 @@ func NewRootCmd() *cobra.Command {
 				fmt.Fprintln(cmd.ErrOrStderr(), "-c content required")
 				return
 			}
-			cfg, _ := config.LoadConfig()
+			cfg := loadConfig()
 			ws := cfg.Agents.Defaults.Workspace
 			if ws == "" {
 				ws = "~/.picobot/workspace"
@@ -298,7 +370,7 @@ func NewRootCmd() *cobra.Command {
 		Short: "Show recent N days' notes",
 		Run: func(cmd *cobra.Command, args []string) {
 			days, _ := cmd.Flags().GetInt("days")
-			cfg, _ := config.LoadConfig()
+			cfg := loadConfig()
 			ws := cfg.Agents.Defaults.Workspace
 			if ws == "" {
 				ws = "~/.picobot/workspace"
@@ -330,7 +402,7 @@ func NewRootCmd() *cobra.Command {
 				return
 			}
 			top, _ := cmd.Flags().GetInt("top")
-			cfg, _ := config.LoadConfig()
+			cfg := loadConfig()
 			ws := cfg.Agents.Defaults.Workspace
 			if ws == "" {
 				ws = "~/.picobot/workspace"
@@ -384,6 +456,329 @@ func NewRootCmd() *cobra.Command {
 	memoryCmd.AddCommand(rankCmd)
 
 	rootCmd.AddCommand(memoryCmd)
+
+	// pairing subcommands: list, approve, revoke
+	pairingCmd := &cobra.Command{
+		Use:   "pairing",
+		Short: "Manage users paired through the chat pairing flow",
+	}
+
+	pairingListCmd := &cobra.Command{
+		Use:   "list",
+		Short: "List pending pairing requests and paired users",
+		Run: func(cmd *cobra.Command, args []string) {
+			pending, paired, err := pairing.Open(pairing.DefaultPath()).List()
+			if err != nil {
+				fmt.Fprintln(cmd.ErrOrStderr(), "list failed:", err)
+				return
+			}
+			fmt.Fprintln(cmd.OutOrStdout(), "Pending requests:")
+			for _, r := range pending {
+				fmt.Fprintf(cmd.OutOrStdout(), "  %s  %s:%s  %s  (expires %s)\n", r.Code, r.Channel, r.SenderID, r.Name, r.Created.Add(pairing.CodeTTL).Format("15:04"))
+			}
+			fmt.Fprintln(cmd.OutOrStdout(), "Paired users:")
+			for _, p := range paired {
+				fmt.Fprintf(cmd.OutOrStdout(), "  %s:%s  %s  (approved %s by %s)\n", p.Channel, p.SenderID, p.Name, p.Approved.Format("2006-01-02 15:04"), p.ApprovedBy)
+			}
+		},
+	}
+
+	pairingApproveCmd := &cobra.Command{
+		Use:   "approve <code>",
+		Short: "Approve a pending pairing request",
+		Args:  cobra.ExactArgs(1),
+		Run: func(cmd *cobra.Command, args []string) {
+			req, err := pairing.Open(pairing.DefaultPath()).Approve(args[0], "cli")
+			if err != nil {
+				fmt.Fprintln(cmd.ErrOrStderr(), "approve failed:", err)
+				return
+			}
+			fmt.Fprintf(cmd.OutOrStdout(), "approved %s:%s (%s)\n", req.Channel, req.SenderID, req.Name)
+		},
+	}
+
+	pairingRevokeCmd := &cobra.Command{
+		Use:   "revoke <user id>",
+		Short: "Remove a paired user",
+		Args:  cobra.ExactArgs(1),
+		Run: func(cmd *cobra.Command, args []string) {
+			channel, _ := cmd.Flags().GetString("channel")
+			ok, err := pairing.Open(pairing.DefaultPath()).Revoke(channel, args[0])
+			if err != nil {
+				fmt.Fprintln(cmd.ErrOrStderr(), "revoke failed:", err)
+				return
+			}
+			if !ok {
+				fmt.Fprintf(cmd.ErrOrStderr(), "%s:%s is not paired\n", channel, args[0])
+				return
+			}
+			fmt.Fprintf(cmd.OutOrStdout(), "revoked %s:%s\n", channel, args[0])
+		},
+	}
+	pairingRevokeCmd.Flags().String("channel", "telegram", "Channel the user was paired on")
+
+	pairingCmd.AddCommand(pairingListCmd)
+	pairingCmd.AddCommand(pairingApproveCmd)
+	pairingCmd.AddCommand(pairingRevokeCmd)
+	rootCmd.AddCommand(pairingCmd)
+
+	// cron subcommands: list, show, pause, resume, cancel, run. They edit
+	// the saved jobs, which a running gateway re-reads within a second.
+	cronCmd := &cobra.Command{
+		Use:   "cron",
+		Short: "Manage scheduled jobs",
+	}
+
+	cronListCmd := &cobra.Command{
+		Use:   "list",
+		Short: "List scheduled jobs",
+		Run: func(cmd *cobra.Command, args []string) {
+			s := openCronStore()
+			jobs := s.List()
+			if len(jobs) == 0 {
+				fmt.Fprintln(cmd.OutOrStdout(), "no scheduled jobs")
+				return
+			}
+			for _, j := range jobs {
+				next := "next " + cronTime(s, j, j.FireAt)
+				if j.Paused {
+					next = "paused"
+				}
+				fmt.Fprintf(cmd.OutOrStdout(), "  %-8s %-20s %-6s %-28s %s\n", j.ID, j.Name, j.Kind, j.Describe(), next)
+			}
+		},
+	}
+
+	cronShowCmd := &cobra.Command{
+		Use:   "show <job>",
+		Short: "Show a job and its recent runs",
+		Args:  cobra.ExactArgs(1),
+		Run: func(cmd *cobra.Command, args []string) {
+			s := openCronStore()
+			j, ok := s.Find(args[0])
+			if !ok {
+				fmt.Fprintf(cmd.ErrOrStderr(), "no job %q\n", args[0])
+				return
+			}
+			out := cmd.OutOrStdout()
+			fmt.Fprintf(out, "%s (%s)\n", j.Name, j.ID)
+			fmt.Fprintf(out, "  kind:     %s\n", j.Kind)
+			fmt.Fprintf(out, "  schedule: %s\n", j.Describe())
+			if j.Paused {
+				fmt.Fprintln(out, "  next:     paused")
+			} else {
+				fmt.Fprintf(out, "  next:     %s\n", cronTime(s, j, j.FireAt))
+			}
+			fmt.Fprintf(out, "  chat:     %s:%s\n", j.Channel, j.ChatID)
+			if j.Kind == cron.KindTool {
+				fmt.Fprintf(out, "  tool:     %s %v\n", j.Tool, j.Args)
+			}
+			if j.Message != "" {
+				fmt.Fprintf(out, "  message:  %s\n", j.Message)
+			}
+			runs, err := s.History(j.ID)
+			if err != nil {
+				fmt.Fprintln(cmd.ErrOrStderr(), "reading run log:", err)
+				return
+			}
+			fmt.Fprintln(out, "Recent runs:")
+			if len(runs) == 0 {
+				fmt.Fprintln(out, "  none")
+			}
+			for _, r := range runs {
+				fmt.Fprintf(out, "  %s  %-6s %6v  %s\n", cronTime(s, j, r.Start), r.Status, r.End.Sub(r.Start).Round(time.Second), strings.Join(strings.Fields(r.Output), " "))
+			}
+		},
+	}
+
+	// cronAction makes a subcommand that applies do to the job named by
+	// its argument, an ID or a name.
+	cronAction := func(use, short, done string, do func(s *cron.Scheduler, id string) bool) *cobra.Command {
+		return &cobra.Command{
+			Use:   use + " <job>",
+			Short: short,
+			Args:  cobra.ExactArgs(1),
+			Run: func(cmd *cobra.Command, args []string) {
+				s := openCronStore()
+				j, ok := s.Find(args[0])
+				if ok {
+					ok = do(s, j.ID)
+				}
+				if !ok {
+					fmt.Fprintf(cmd.ErrOrStderr(), "no job %q\n", args[0])
+					return
+				}
+				fmt.Fprintf(cmd.OutOrStdout(), "%s %s (%s)\n", done, j.ID, j.Name)
+			},
+		}
+	}
+	cronCmd.AddCommand(cronListCmd)
+	cronCmd.AddCommand(cronShowCmd)
+	cronCmd.AddCommand(cronAction("pause", "Stop a job from firing until resumed", "paused", func(s *cron.Scheduler, id string) bool {
+		_, ok := s.Pause(id)
+		return ok
+	}))
+	cronCmd.AddCommand(cronAction("resume", "Let a paused job fire again", "resumed", func(s *cron.Scheduler, id string) bool {
+		_, ok := s.Resume(id)
+		return ok
+	}))
+	cronCmd.AddCommand(cronAction("cancel", "Remove a job", "cancelled", func(s *cron.Scheduler, id string) bool {
+		return s.Cancel(id)
+	}))
+	cronCmd.AddCommand(cronAction("run", "Run a job now, keeping its schedule (the gateway runs it, when it is running)", "requested a run of", func(s *cron.Scheduler, id string) bool {
+		_, ok := s.RunNow(id)
+		return ok
+	}))
+	rootCmd.AddCommand(cronCmd)
+
+	// config subcommands: validate, path, get, set, migrate
+	configCmd := &cobra.Command{
+		Use:   "config",
+		Short: "Inspect, check and edit the config file",
+	}
+
+	configValidateCmd := &cobra.Command{
+		Use:   "validate",
+		Short: "Check the config for unknown keys, wrong types and invalid settings",
+		Run: func(cmd *cobra.Command, args []string) {
+			path := config.ConfigPath()
+			_, problems, err := config.CheckFile(path)
+			if err != nil {
+				fmt.Fprintf(cmd.ErrOrStderr(), "%s: %v\n", path, err)
+				os.Exit(1)
+			}
+			if len(problems) == 0 {
+				fmt.Fprintf(cmd.OutOrStdout(), "%s is valid\n", path)
+				return
+			}
+			for _, p := range problems {
+				fmt.Fprintln(cmd.ErrOrStderr(), p)
+			}
+			fmt.Fprintf(cmd.ErrOrStderr(), "%s: %d problem(s)\n", path, len(problems))
+			os.Exit(1)
+		},
+	}
+
+	configPathCmd := &cobra.Command{
+		Use:   "path",
+		Short: "Print the path of the config file in use",
+		Run: func(cmd *cobra.Command, args []string) {
+			fmt.Fprintln(cmd.OutOrStdout(), config.ConfigPath())
+		},
+	}
+
+	configGetCmd := &cobra.Command{
+		Use:   "get <key>",
+		Short: "Print a value from the config file, e.g. agents.defaults.model",
+		Args:  cobra.ExactArgs(1),
+		Run: func(cmd *cobra.Command, args []string) {
+			doc, err := config.OpenDocument(config.ConfigPath())
+			if err == nil {
+				var v string
+				if v, err = doc.Get(args[0]); err == nil {
+					fmt.Fprintln(cmd.OutOrStdout(), v)
+					return
+				}
+			}
+			fmt.Fprintln(cmd.ErrOrStderr(), err)
+			os.Exit(1)
+		},
+	}
+
+	configSetCmd := &cobra.Command{
+		Use:   "set <key> <value>",
+		Short: "Set a value in the config file, e.g. channels.telegram.allowFrom '[\"123\"]'",
+		Long: "Set a value in the config file, keeping the rest of the file (and comments in YAML) as it is.\n" +
+			"The value is parsed as YAML, so true, 42, \"text\" and [\"a\", \"b\"] all work.",
+		Args: cobra.ExactArgs(2),
+		Run: func(cmd *cobra.Command, args []string) {
+			path := config.ConfigPath()
+			doc, err := config.OpenDocument(path)
+			if err == nil {
+				if err = doc.Set(args[0], args[1]); err == nil {
+					err = doc.Save()
+				}
+			}
+			if err != nil {
+				fmt.Fprintln(cmd.ErrOrStderr(), err)
+				os.Exit(1)
+			}
+			fmt.Fprintf(cmd.OutOrStdout(), "Set %s in %s\n", args[0], path)
+		},
+	}
+
+	configMigrateCmd := &cobra.Command{
+		Use:   "migrate",
+		Short: "Upgrade the config file to the current version, keeping a backup",
+		Run: func(cmd *cobra.Command, args []string) {
+			dryRun, _ := cmd.Flags().GetBool("dry-run")
+			path := config.ConfigPath()
+			doc, err := config.OpenDocument(path)
+			if err != nil {
+				fmt.Fprintln(cmd.ErrOrStderr(), err)
+				os.Exit(1)
+			}
+			from, changes, err := doc.Migrate()
+			if err != nil {
+				fmt.Fprintf(cmd.ErrOrStderr(), "%s: %v\n", path, err)
+				os.Exit(1)
+			}
+			if from == config.CurrentVersion {
+				fmt.Fprintf(cmd.OutOrStdout(), "%s is up to date (version %d)\n", path, from)
+				return
+			}
+			for _, c := range changes {
+				fmt.Fprintln(cmd.OutOrStdout(), "  "+c)
+			}
+			if dryRun {
+				fmt.Fprintf(cmd.OutOrStdout(), "%s would be upgraded from version %d to %d\n", path, from, config.CurrentVersion)
+				return
+			}
+			backup, err := doc.Backup(from)
+			if err == nil {
+				err = doc.Save()
+			}
+			if err != nil {
+				fmt.Fprintf(cmd.ErrOrStderr(), "%s: %v\n", path, err)
+				os.Exit(1)
+			}
+			fmt.Fprintf(cmd.OutOrStdout(), "Upgraded %s from version %d to %d (backup in %s)\n", path, from, config.CurrentVersion, backup)
+		},
+	}
+	configMigrateCmd.Flags().Bool("dry-run", false, "show the changes without writing the file")
+
+	configCmd.AddCommand(configValidateCmd)
+	configCmd.AddCommand(configPathCmd)
+	configCmd.AddCommand(configGetCmd)
+	configCmd.AddCommand(configSetCmd)
+	configCmd.AddCommand(configMigrateCmd)
+	rootCmd.AddCommand(configCmd)
+
+	rootCmd.AddCommand(&cobra.Command{
+		Use:   "doctor",
+		Short: "Check config, workspace, provider, channels, MCP servers and memory",
+		Run: func(cmd *cobra.Command, args []string) {
+			failed := 0
+			for _, r := range doctor.Run(config.ConfigPath()) {
+				mark := "✓"
+				switch r.Status {
+				case doctor.Warn:
+					mark = "!"
+				case doctor.Fail:
+					mark = "✗"
+					failed++
+				case doctor.Skip:
+					mark = "-"
+				}
+				fmt.Fprintf(cmd.OutOrStdout(), "%s %-12s %s\n", mark, r.Name, r.Detail)
+			}
+			if failed > 0 {
+				fmt.Fprintf(cmd.OutOrStdout(), "\n%d check(s) failed\n", failed)
+				os.Exit(1)
+			}
+			fmt.Fprintln(cmd.OutOrStdout(), "\nall checks passed")
+		},
+	})
 	return rootCmd
 }
 
@@ -394,3 +789,65 @@ func main() {
 		os.Exit(1)
 	}
 }
+
+// loadConfig loads the config, exiting if it can't be read: carrying on with
+// an empty config would silently drop the user's settings.
+func loadConfig() config.Config {
+	cfg, err := config.LoadConfig()
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "failed to load config: %v\n", err)
+		os.Exit(1)
+	}
+	return cfg
+}
+
+// openCronStore opens the jobs saved in the configured workspace, exiting on
+// failure.
+func openCronStore() *cron.Scheduler {
+	cfg := loadConfig()
+	s, err := cron.Open(cron.StorePath(cfg.Agents.Defaults.Workspace))
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "failed to load cron jobs: %v\n", err)
+		os.Exit(1)
+	}
+	if cfg.Cron.TimeZone != "" {
+		if loc, err := time.LoadLocation(cfg.Cron.TimeZone); err == nil {
+			s.SetTimeZone(loc)
+		}
+	}
+	return s
+}
+
+// cronTime formats t in the job's time zone.
+func cronTime(s *cron.Scheduler, j cron.Job, t time.Time) string {
+	loc, err := s.Location(j.TimeZone)
+	if err != nil {
+		loc = time.Local
+	}
+	return t.In(loc).Format("2006-01-02 15:04 MST")
+}
+
+// restartRequired lists the config sections that changed between old and
+// next but are only read at startup.
+func restartRequired(old, next config.Config) []string {
+	var sections []string
+	if old.Agents.Defaults.Workspace != next.Agents.Defaults.Workspace {
+		sections = append(sections, "agents.defaults.workspace")
+	}
+	if old.Agents.Defaults.HeartbeatIntervalS != next.Agents.Defaults.HeartbeatIntervalS {
+		sections = append(sections, "agents.defaults.heartbeatIntervalS")
+	}
+	if !reflect.DeepEqual(old.Providers, next.Providers) {
+		sections = append(sections, "providers")
+	}
+	if !reflect.DeepEqual(old.Memory, next.Memory) {
+		sections = append(sections, "memory")
+	}
+	if !reflect.DeepEqual(old.Heartbeat, next.Heartbeat) {
+		sections = append(sections, "heartbeat")
+	}
+	if old.Cron != next.Cron {
+		sections = append(sections, "cron")
+	}
+	return sections
+}
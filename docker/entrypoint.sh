@@ -14,50 +14,29 @@ if [ ! -f "${PICOBOT_HOME}/config.json" ]; then
   echo ""
 fi
 
-# Allow overriding config values via environment variables
+# Map the short variable names onto picobot's own PICOBOT_* overrides.
+# picobot applies them when it loads the config, so config.json is never
+# modified and secrets are not written to disk.
 if [ -n "${OPENAI_API_KEY}" ]; then
-  echo "Applying OPENAI_API_KEY from environment..."
-  TMP=$(mktemp)
-  cat "${PICOBOT_HOME}/config.json" | \
-    sed "s|sk-or-v1-REPLACE_ME|${OPENAI_API_KEY}|g" > "$TMP" && \
-    mv "$TMP" "${PICOBOT_HOME}/config.json"
+  export PICOBOT_PROVIDERS_OPENAI_API_KEY="${OPENAI_API_KEY}"
 fi
 
 if [ -n "${OPENAI_API_BASE}" ]; then
-  echo "Applying OPENAI_API_BASE from environment..."
-  TMP=$(mktemp)
-  cat "${PICOBOT_HOME}/config.json" | \
-    sed "s|https://openrouter.ai/api/v1|${OPENAI_API_BASE}|g" > "$TMP" && \
-    mv "$TMP" "${PICOBOT_HOME}/config.json"
+  export PICOBOT_PROVIDERS_OPENAI_API_BASE="${OPENAI_API_BASE}"
 fi
 
-if [ -n "${TELEGRAM_BOT_TOKEN}" ]; then
-  echo "Applying TELEGRAM_BOT_TOKEN from environment..."
-  TMP=$(mktemp)
-  # Enable telegram and set token using sed
-  cat "${PICOBOT_HOME}/config.json" | \
-    sed 's|"enabled": false|"enabled": true|g' | \
-    sed "s|\"token\": \"\"|\"token\": \"${TELEGRAM_BOT_TOKEN}\"|g" > "$TMP" && \
-    mv "$TMP" "${PICOBOT_HOME}/config.json"
+if [ -n "${PICOBOT_MODEL}" ]; then
+  export PICOBOT_AGENTS_DEFAULTS_MODEL="${PICOBOT_MODEL}"
 fi
 
-if [ -n "${TELEGRAM_ALLOW_FROM}" ]; then
-  echo "Applying TELEGRAM_ALLOW_FROM from environment..."
-  TMP=$(mktemp)
-  # Convert comma-separated IDs to JSON array: "id1,id2" -> ["id1","id2"]
-  ALLOW_JSON=$(echo "${TELEGRAM_ALLOW_FROM}" | sed 's/,/","/g' | sed 's/^/["/' | sed 's/$/"]/') 
-  cat "${PICOBOT_HOME}/config.json" | \
-    sed "s/\"allowFrom\": null/\"allowFrom\": ${ALLOW_JSON}/g" | \
-    sed "s/\"allowFrom\": \[\]/\"allowFrom\": ${ALLOW_JSON}/g" > "$TMP" && \
-    mv "$TMP" "${PICOBOT_HOME}/config.json"
+if [ -n "${TELEGRAM_BOT_TOKEN}" ]; then
+  export PICOBOT_CHANNELS_TELEGRAM_ENABLED=true
+  export PICOBOT_CHANNELS_TELEGRAM_TOKEN="${TELEGRAM_BOT_TOKEN}"
 fi
 
-if [ -n "${PICOBOT_MODEL}" ]; then
-  echo "Applying PICOBOT_MODEL from environment..."
-  TMP=$(mktemp)
-  cat "${PICOBOT_HOME}/config.json" | \
-    sed "s|\"model\": \"stub-model\"|\"model\": \"${PICOBOT_MODEL}\"|g" > "$TMP" && \
-    mv "$TMP" "${PICOBOT_HOME}/config.json"
+if [ -n "${TELEGRAM_ALLOW_FROM}" ]; then
+  # comma-separated IDs, e.g. "8881234567,8887654321"
+  export PICOBOT_CHANNELS_TELEGRAM_ALLOW_FROM="${TELEGRAM_ALLOW_FROM}"
 fi
 
 echo "Starting picobot $@..."
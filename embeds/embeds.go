@@ -8,3 +8,8 @@ import "embed"
 //
 //go:embed skills/*
 var Skills embed.FS
+
+// Web contains the static assets of the built-in web chat UI served by the gateway.
+//
+//go:embed web/*
+var Web embed.FS
@@ -0,0 +1,179 @@
+// picobot web UI: chat over a WebSocket plus read-only views of the workspace.
+(function () {
+  "use strict";
+
+  const $ = (sel) => document.querySelector(sel);
+  let token = localStorage.getItem("picobot.token") || "";
+  let session = localStorage.getItem("picobot.session") || "default";
+  let ws = null;
+  let pending = null;
+
+  function ensureToken() {
+    while (!token) {
+      token = (prompt("picobot access token") || "").trim();
+    }
+    localStorage.setItem("picobot.token", token);
+  }
+
+  async function api(path) {
+    const resp = await fetch(path, { headers: { Authorization: "Bearer " + token } });
+    if (resp.status === 401) {
+      localStorage.removeItem("picobot.token");
+      token = "";
+      ensureToken();
+      return api(path);
+    }
+    return resp.json();
+  }
+
+  function el(tag, cls, text) {
+    const e = document.createElement(tag);
+    if (cls) e.className = cls;
+    if (text !== undefined) e.textContent = text;
+    return e;
+  }
+
+  function scrollLog() {
+    const log = $("#log");
+    log.scrollTop = log.scrollHeight;
+  }
+
+  function addMessage(role, content) {
+    if (pending && role === "assistant") {
+      pending.remove();
+      pending = null;
+    }
+    $("#log").appendChild(el("div", "msg " + role, content));
+    scrollLog();
+  }
+
+  function addTrace(trace) {
+    const d = el("details", "trace" + (trace.error ? " error" : ""));
+    d.appendChild(el("summary", "", "🔧 " + trace.tool));
+    d.appendChild(el("pre", "", JSON.stringify(trace.args, null, 2)));
+    d.appendChild(el("pre", "", trace.result));
+    $("#log").insertBefore(d, pending);
+    scrollLog();
+  }
+
+  function connect() {
+    const proto = location.protocol === "https:" ? "wss:" : "ws:";
+    ws = new WebSocket(proto + "//" + location.host + "/ws?token=" + encodeURIComponent(token));
+    ws.onopen = () => switchSession(session);
+    ws.onmessage = (e) => {
+      const ev = JSON.parse(e.data);
+      switch (ev.type) {
+        case "history":
+          $("#log").innerHTML = "";
+          (ev.messages || []).forEach((m) => addMessage(m.role, m.content));
+          break;
+        case "message":
+          addMessage("assistant", ev.content);
+          if (!ev.final && !pending) showPending();
+          break;
+        case "trace":
+          addTrace(ev.trace);
+          break;
+        case "error":
+          addMessage("assistant", "⚠️ " + ev.content);
+          break;
+      }
+    };
+    ws.onclose = () => setTimeout(connect, 2000);
+  }
+
+  function showPending() {
+    pending = el("div", "msg assistant pending", "thinking…");
+    $("#log").appendChild(pending);
+    scrollLog();
+  }
+
+  function switchSession(name) {
+    session = name;
+    localStorage.setItem("picobot.session", name);
+    if (ws && ws.readyState === WebSocket.OPEN) {
+      ws.send(JSON.stringify({ type: "switch", session: name }));
+    }
+    loadSessions();
+  }
+
+  async function loadSessions() {
+    const data = await api("/api/sessions");
+    const names = data.sessions || [];
+    if (!names.includes(session)) names.unshift(session);
+    const ul = $("#sessions");
+    ul.innerHTML = "";
+    names.forEach((n) => {
+      const li = el("li", n === session ? "active" : "", n);
+      li.onclick = () => switchSession(n);
+      ul.appendChild(li);
+    });
+  }
+
+  async function showView(name) {
+    document.querySelectorAll("nav button").forEach((b) => b.classList.toggle("active", b.dataset.view === name));
+    document.querySelectorAll(".view").forEach((v) => v.classList.toggle("active", v.id === "view-" + name));
+    if (name === "memory") {
+      const m = await api("/api/memory");
+      $("#memory").textContent = m.long + (m.today ? "\n\n# Today\n\n" + m.today : "");
+    } else if (name === "skills") {
+      const s = await api("/api/skills");
+      const box = $("#skills");
+      box.innerHTML = "";
+      (s.skills || []).forEach((sk) => {
+        const c = el("div", "card");
+        c.appendChild(el("h3", "", sk.Name));
+        c.appendChild(el("p", "", sk.Description));
+        box.appendChild(c);
+      });
+      if (!box.children.length) box.textContent = "No skills installed.";
+    } else if (name === "cron") {
+      const j = await api("/api/cron");
+      const box = $("#cron");
+      box.innerHTML = "";
+      (j.jobs || []).forEach((job) => {
+        const c = el("div", "card");
+        c.appendChild(el("h3", "", job.name + " (" + job.id + ")"));
+        c.appendChild(el("p", "", job.message));
+        c.appendChild(el("p", "", (job.paused ? "paused" : "next: " + new Date(job.fireAt).toLocaleString()) + (job.recurring ? " · recurring" : "")));
+        box.appendChild(c);
+      });
+      if (!box.children.length) box.textContent = "No pending jobs.";
+    }
+  }
+
+  function send() {
+    const input = $("#input");
+    const text = input.value.trim();
+    if (!text || !ws || ws.readyState !== WebSocket.OPEN) return;
+    ws.send(JSON.stringify({ type: "message", content: text }));
+    addMessage("user", text);
+    showPending();
+    input.value = "";
+  }
+
+  $("#composer").onsubmit = (e) => {
+    e.preventDefault();
+    send();
+  };
+  $("#input").onkeydown = (e) => {
+    if (e.key === "Enter" && !e.shiftKey) {
+      e.preventDefault();
+      send();
+    }
+  };
+  $("#new-session").onsubmit = (e) => {
+    e.preventDefault();
+    const name = $("#new-session-name").value.trim().replace(/[^A-Za-z0-9_-]/g, "");
+    $("#new-session-name").value = "";
+    if (name) switchSession(name);
+  };
+  document.querySelectorAll("nav button").forEach((b) => (b.onclick = () => showView(b.dataset.view)));
+  $("#logout").onclick = () => {
+    localStorage.removeItem("picobot.token");
+    location.reload();
+  };
+
+  ensureToken();
+  connect();
+})();
@@ -12,6 +12,7 @@ import (
 	"github.com/local/picobot/internal/agent/skills"
 	"github.com/local/picobot/internal/providers"
 	"github.com/local/picobot/internal/session"
+	"github.com/local/picobot/internal/users"
 )
 
 // ContextBuilder builds messages for the LLM from session history and current message.
@@ -19,17 +20,19 @@ type ContextBuilder struct {
 	workspace    string
 	skillsLoader *skills.Loader
 	memPersist   *memory.MemoryPersist
+	users        *users.Directory
 }
 
-func NewContextBuilder(workspace string, memPersist *memory.MemoryPersist) *ContextBuilder {
+func NewContextBuilder(workspace string, memPersist *memory.MemoryPersist, dir *users.Directory) *ContextBuilder {
 	return &ContextBuilder{
 		workspace:    workspace,
 		skillsLoader: skills.NewLoader(workspace),
 		memPersist:   memPersist,
+		users:        dir,
 	}
 }
 
-func (cb *ContextBuilder) BuildMessages(history []*session.Message, currentMessage string, channel, chatID string, memoryContext string, memories []memory.MemoryItem) []providers.Message {
+func (cb *ContextBuilder) BuildMessages(history []*session.Message, currentMessage string, channel, chatID string, user *users.User, memoryContext string, memories []memory.MemoryItem) []providers.Message {
 	msgs := make([]providers.Message, 0, len(history)+8)
 	// system prompt
 	system := "You are Picobot, a helpful assistant.\n\n"
@@ -53,6 +56,19 @@ Chat ID: %s
 `
 	system = system + fmt.Sprintf(tmpl, time_now, cb.workspace, cb.workspace, cb.workspace, cb.workspace, channel, chatID) + "\n\n"
 
+	// Known users get their profile; the same person may write from several channels.
+	if user != nil {
+		system = system + fmt.Sprintf("## Current User\nName: %s\n", user.Name)
+		if len(user.Roles) > 0 {
+			system = system + fmt.Sprintf("Roles: %s\n", strings.Join(user.Roles, ", "))
+		}
+		system = system + fmt.Sprintf("Notes about this user can be kept in: %s\n", cb.users.ProfilePath(user))
+		if profile := cb.users.ProfileText(user); profile != "" {
+			system = system + "\n" + profile + "\n"
+		}
+		system = system + "\n"
+	}
+
 	// Load workspace bootstrap files (SOUL.md, AGENTS.md, USER.md, TOOLS.md)
 	// These define the agent's personality, instructions, and available tools documentation.
 	bootstrapFiles := []string{"SOUL.md", "AGENTS.md", "USER.md", "TOOLS.md"}
@@ -2,10 +2,13 @@ package agent
 
 import (
 	"context"
+	"fmt"
 	"log"
 	"os"
+	"reflect"
 	"regexp"
 	"strings"
+	"sync"
 	"time"
 
 	"github.com/local/picobot/internal/agent/memory"
@@ -14,7 +17,9 @@ import (
 	"github.com/local/picobot/internal/config"
 	"github.com/local/picobot/internal/cron"
 	"github.com/local/picobot/internal/providers"
+	"github.com/local/picobot/internal/ratelimit"
 	"github.com/local/picobot/internal/session"
+	"github.com/local/picobot/internal/users"
 )
 
 var rememberRE = regexp.MustCompile(`(?i)^remember(?:\s+to)?\s+(.+)$`)
@@ -28,15 +33,36 @@ type AgentLoop struct {
 	context       *ContextBuilder
 	memory        *memory.MemoryStore
 	memoryPersist *memory.MemoryPersist
+	mcp           *tools.MCPServers
+	workspace     string
+	running       bool
+
+	mu       sync.RWMutex
+	settings settings // guarded by mu; replaced by Reconfigure
+}
+
+// settings are the parts of the agent's configuration that can change while
+// it runs. A turn works on a copy taken when it starts.
+type settings struct {
 	model         string
 	maxIterations int
 	temperature   float64
 	maxTokens     int
-	running       bool
+	users         *users.Directory
+	permissions   *tools.Permissions
+	limiter       *ratelimit.Limiter
+	rateLimit     config.RateLimitConfig
+}
+
+// queued is an accepted message together with the limiter that admitted it,
+// so the right limiter is told when it is done even after a reload.
+type queued struct {
+	msg     chat.Inbound
+	limiter *ratelimit.Limiter
 }
 
 // NewAgentLoop creates a new AgentLoop with the given provider.
-func NewAgentLoop(b *chat.Hub, provider providers.LLMProvider, model string, maxIterations int, Temperature float64, MaxTokens int, workspace string, scheduler *cron.Scheduler, toolsConfig *config.ToolsConfig, memoryConfig *config.MemoryConfig) *AgentLoop {
+func NewAgentLoop(b *chat.Hub, provider providers.LLMProvider, model string, maxIterations int, Temperature float64, MaxTokens int, workspace string, scheduler *cron.Scheduler, toolsConfig *config.ToolsConfig, memoryConfig *config.MemoryConfig, usersConfig []config.UserConfig, permissionsConfig *config.PermissionsConfig, rateLimitConfig *config.RateLimitConfig) *AgentLoop {
 	if model == "" {
 		model = provider.GetDefaultModel()
 	}
@@ -63,7 +89,7 @@ func NewAgentLoop(b *chat.Hub, provider providers.LLMProvider, model string, max
 	reg.Register(tools.NewWebTool())
 	reg.Register(tools.NewSpawnTool())
 	if scheduler != nil {
-		reg.Register(tools.NewCronTool(scheduler))
+		reg.Register(tools.NewCronTool(scheduler, reg))
 	}
 
 	sm := session.NewSessionManager(workspace)
@@ -80,7 +106,21 @@ func NewAgentLoop(b *chat.Hub, provider providers.LLMProvider, model string, max
 		log.Printf("Persistent memory store initialized with %s embedder", memoryConfig.EmbedType)
 	}
 
-	ctx := NewContextBuilder(workspace, memPersist)
+	dir := users.NewDirectory(usersConfig, workspace)
+	var limiter *ratelimit.Limiter
+	var rateLimit config.RateLimitConfig
+	if rateLimitConfig != nil {
+		rateLimit = *rateLimitConfig
+		limiter = ratelimit.New(rateLimit)
+	}
+	var perms *tools.Permissions
+	if permissionsConfig != nil {
+		perms, err = tools.NewPermissions(*permissionsConfig)
+		if err != nil {
+			log.Fatalf("invalid permissions config: %v", err)
+		}
+	}
+	ctx := NewContextBuilder(workspace, memPersist, dir)
 	mem := memory.NewMemoryStoreWithWorkspace(workspace, 100)
 	// register memory tool (needs store instance)
 	reg.Register(tools.NewWriteMemoryTool(mem))
@@ -92,15 +132,83 @@ func NewAgentLoop(b *chat.Hub, provider providers.LLMProvider, model string, max
 	reg.Register(tools.NewReadSkillTool(skillMgr))
 	reg.Register(tools.NewDeleteSkillTool(skillMgr))
 
-	tools.RegisterMCPFromConfig(reg, toolsConfig)
+	mcp := tools.NewMCPServers(reg)
+	mcp.Sync(toolsConfig)
 
-	return &AgentLoop{hub: b, provider: provider, tools: reg, sessions: sm, context: ctx, memory: mem, memoryPersist: memPersist, model: model, maxIterations: maxIterations, temperature: Temperature, maxTokens: MaxTokens}
+	return &AgentLoop{hub: b, provider: provider, tools: reg, sessions: sm, context: ctx, memory: mem, memoryPersist: memPersist, mcp: mcp, workspace: workspace,
+		settings: settings{model: model, maxIterations: maxIterations, temperature: Temperature, maxTokens: MaxTokens, users: dir, permissions: perms, limiter: limiter, rateLimit: rateLimit}}
+}
+
+// current returns a snapshot of the live settings.
+func (a *AgentLoop) current() settings {
+	a.mu.RLock()
+	defer a.mu.RUnlock()
+	return a.settings
+}
+
+// Reconfigure applies a reloaded config to the running agent: model and
+// sampling settings, users, permissions, rate limits and MCP servers. Turns
+// already in progress finish with the old settings. If the new permissions
+// don't compile nothing is changed. model overrides the config's model, as
+// the --model flag does at startup.
+func (a *AgentLoop) Reconfigure(cfg config.Config, model string) error {
+	perms, err := tools.NewPermissions(cfg.Permissions)
+	if err != nil {
+		return fmt.Errorf("invalid permissions config: %w", err)
+	}
+	d := cfg.Agents.Defaults
+	if model == "" {
+		model = d.Model
+	}
+	if model == "" {
+		model = a.provider.GetDefaultModel()
+	}
+	maxIter := d.MaxToolIterations
+	if maxIter <= 0 {
+		maxIter = 100
+	}
+
+	a.mu.Lock()
+	old := a.settings
+	next := settings{
+		model:         model,
+		maxIterations: maxIter,
+		temperature:   d.Temperature,
+		maxTokens:     d.MaxTokens,
+		users:         users.NewDirectory(cfg.Users, a.workspace),
+		permissions:   perms,
+		limiter:       old.limiter,
+		rateLimit:     cfg.RateLimit,
+	}
+	// keep the limiter, and with it the buckets and bans, unless its config changed
+	if !reflect.DeepEqual(cfg.RateLimit, old.rateLimit) {
+		next.limiter = ratelimit.New(cfg.RateLimit)
+		log.Printf("config: rate limits updated (enabled: %v)", cfg.RateLimit.Enabled)
+	}
+	a.settings = next
+	a.mu.Unlock()
+
+	if next.model != old.model {
+		log.Printf("config: model changed from %s to %s", old.model, next.model)
+	}
+	if next.temperature != old.temperature || next.maxTokens != old.maxTokens || next.maxIterations != old.maxIterations {
+		log.Printf("config: temperature %g, maxTokens %d, maxToolIterations %d", next.temperature, next.maxTokens, next.maxIterations)
+	}
+	started, stopped := a.mcp.Sync(&cfg.Tools)
+	for _, name := range stopped {
+		log.Printf("config: MCP server %s stopped", name)
+	}
+	for _, name := range started {
+		log.Printf("config: MCP server %s started", name)
+	}
+	return nil
 }
 
 // Run starts processing inbound messages. This is a blocking call until context is canceled.
 func (a *AgentLoop) Run(ctx context.Context) {
 	a.running = true
 	log.Println("Agent loop started")
+	queue := a.intake(ctx)
 
 	for a.running {
 		select {
@@ -108,38 +216,63 @@ func (a *AgentLoop) Run(ctx context.Context) {
 			log.Println("Agent loop received shutdown signal")
 			a.running = false
 			return
-		case msg, ok := <-a.hub.In:
+		case q, ok := <-queue:
 			if !ok {
 				log.Println("Inbound channel closed, stopping agent loop")
 				a.running = false
 				return
 			}
+			msg := q.msg
+			cfg := a.current()
 
 			log.Printf("Processing message from %s:%s\n", msg.Channel, msg.SenderID)
+			// a scheduled job acts for whoever scheduled it
+			sender := msg.SenderID
+			run, _ := msg.Metadata[chat.MetaJob].(*chat.JobRun)
+			if run != nil && run.Owner != "" {
+				sender = run.Owner
+			}
+			user := cfg.users.Lookup(msg.Channel, sender)
+			sessionKey, memoryKey := historyKeys(msg, user)
+			if run != nil && run.Kind == cron.KindAgent {
+				// keep the job's runs out of the conversation
+				sessionKey = "cron:" + run.ID
+			}
+			turnCtx := tools.WithPolicy(ctx, policyFor(cfg.permissions, msg, user))
+
+			if run != nil && run.Kind == cron.KindTool {
+				a.runToolJob(turnCtx, msg, run)
+				q.limiter.Done()
+				continue
+			}
 
 			// Quick heuristic: if user asks the agent to remember something explicitly,
 			// store it in today's note and reply immediately without calling the LLM.
 			trimmed := strings.TrimSpace(msg.Content)
 			rememberRe := rememberRE
-			if matches := rememberRe.FindStringSubmatch(trimmed); len(matches) == 2 {
+			if matches := rememberRe.FindStringSubmatch(trimmed); len(matches) == 2 && a.mayRemember(turnCtx, matches[1]) {
 				note := matches[1]
 				if err := a.memory.AppendToday(note); err != nil {
 					log.Printf("error appending to memory: %v", err)
 				}
-				out := chat.Outbound{Channel: msg.Channel, ChatID: msg.ChatID, Content: "OK, I've remembered that."}
+				out := finalReply(msg, "OK, I've remembered that.")
 				select {
 				case a.hub.Out <- out:
 				default:
 					log.Println("Outbound channel full, dropping message")
 				}
 				// save to session as well
-				session := a.sessions.GetOrCreate(msg.Channel + ":" + msg.ChatID)
-				session.AddMessage("user", msg.Content)
+				session := a.sessions.GetOrCreate(sessionKey)
+				session.AddMessage("user", attributed(msg))
 				session.AddMessage("assistant", "OK, I've remembered that.")
 				a.sessions.Save(session)
+				run.Finish("OK, I've remembered that.", nil)
+				q.limiter.Done()
 				continue
 			}
 
+			msg.Content = attributed(msg)
+
 			// Set tool context (so message tool knows channel+chat)
 			if mt := a.tools.Get("message"); mt != nil {
 				if mtool, ok := mt.(interface{ SetContext(string, string) }); ok {
@@ -150,16 +283,23 @@ func (a *AgentLoop) Run(ctx context.Context) {
 				if ctool, ok := ct.(interface{ SetContext(string, string) }); ok {
 					ctool.SetContext(msg.Channel, msg.ChatID)
 				}
+				if ctool, ok := ct.(interface{ SetSender(string) }); ok {
+					ctool.SetSender(sender)
+				}
 			}
 
 			// Build messages from session, long-term memory, and recent memory
-			session := a.sessions.GetOrCreate(msg.Channel + ":" + msg.ChatID)
-			// get file-backed memory context (long-term + today)
-			memCtx, _ := a.memory.GetMemoryContext()
+			session := a.sessions.GetOrCreate(sessionKey)
+			// get file-backed memory context (long-term + today); it is the
+			// owner's, so senders restricted by permissions don't see it
+			memCtx := ""
+			if tools.PolicyFromContext(turnCtx) == nil {
+				memCtx, _ = a.memory.GetMemoryContext()
+			}
 			// query persistent memory for relevant items
 			memories := []memory.MemoryItem{}
 			if a.memoryPersist != nil {
-				memx, err := a.memoryPersist.QueryHistory(msg.Channel+msg.ChatID, msg.Content, 0)
+				memx, err := a.memoryPersist.QueryHistory(memoryKey, msg.Content, 0)
 				if err != nil {
 					log.Printf("Failed to query persistent memory: %v", err)
 				} else {
@@ -177,18 +317,20 @@ func (a *AgentLoop) Run(ctx context.Context) {
 				}
 			}
 
-			messages := a.context.BuildMessages(session.GetHistory(), msg.Content, msg.Channel, msg.ChatID, memCtx, memories)
+			messages := a.context.BuildMessages(session.GetHistory(), msg.Content, msg.Channel, msg.ChatID, user, memCtx, memories)
 
 			iteration := 0
 			finalContent := ""
 			lastToolResult := ""
-			toolDefs := a.tools.Definitions()
-			for iteration < a.maxIterations {
+			var turnErr error
+			toolDefs := a.tools.Definitions(turnCtx)
+			for iteration < cfg.maxIterations {
 				iteration++
-				resp, err := a.provider.Chat(ctx, messages, toolDefs, a.model, a.temperature, a.maxTokens)
+				resp, err := a.provider.Chat(ctx, messages, toolDefs, cfg.model, cfg.temperature, cfg.maxTokens)
 				if err != nil {
 					log.Printf("provider error: %v", err)
 					finalContent = "Sorry, I encountered an error while processing your request."
+					turnErr = err
 					break
 				}
 
@@ -197,10 +339,11 @@ func (a *AgentLoop) Run(ctx context.Context) {
 					messages = append(messages, providers.Message{Role: "assistant", Content: resp.Content, ToolCalls: resp.ToolCalls})
 					// Execute each tool call and return results with "tool" role
 					for _, tc := range resp.ToolCalls {
-						res, err := a.tools.Execute(ctx, tc.Name, tc.Arguments)
+						res, err := a.tools.Execute(turnCtx, tc.Name, tc.Arguments)
 						if err != nil {
 							res = "(tool error) " + err.Error()
 						}
+						a.trace(msg, tc, res, err != nil)
 						lastToolResult = res
 						messages = append(messages, providers.Message{Role: "tool", Content: res, ToolCallID: tc.ID})
 					}
@@ -229,7 +372,7 @@ func (a *AgentLoop) Run(ctx context.Context) {
 				for _, m := range msgs {
 					if m.Role != "user" {
 						//log.Printf("Storing trimmed history to memory: Role: %s Content: %q\n", m.Role, m.Content)
-						err := a.memoryPersist.StoreHistory(msg.Channel+msg.ChatID, m.Role, m.Content, m.Timestamp)
+						err := a.memoryPersist.StoreHistory(memoryKey, m.Role, m.Content, m.Timestamp)
 						if err != nil {
 							log.Printf("Failed to store trimmed history: %v", err)
 						}
@@ -240,12 +383,14 @@ func (a *AgentLoop) Run(ctx context.Context) {
 			}
 			a.sessions.Save(session)
 
-			out := chat.Outbound{Channel: msg.Channel, ChatID: msg.ChatID, Content: finalContent}
+			out := finalReply(msg, finalContent)
 			select {
 			case a.hub.Out <- out:
 			default:
 				log.Println("Outbound channel full, dropping message")
 			}
+			run.Finish(finalContent, turnErr)
+			q.limiter.Done()
 		default:
 			// idle tick
 			time.Sleep(100 * time.Millisecond)
@@ -253,6 +398,191 @@ func (a *AgentLoop) Run(ctx context.Context) {
 	}
 }
 
+// intake applies rate limits as messages arrive, so throttled senders get
+// their answer right away instead of after the turns queued before them.
+// Accepted messages are passed on in order on the returned channel.
+func (a *AgentLoop) intake(ctx context.Context) <-chan queued {
+	queue := make(chan queued, cap(a.hub.In))
+	go func() {
+		defer close(queue)
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case msg, ok := <-a.hub.In:
+				if !ok {
+					return
+				}
+				limiter := a.current().limiter
+				// picobot's own messages (cron jobs, heartbeat) are never
+				// throttled; only they carry a *chat.JobRun
+				if _, own := msg.Metadata[chat.MetaJob].(*chat.JobRun); own {
+					limiter.Admit()
+				} else if verdict, notify := limiter.Allow(msg.Channel, msg.SenderID); verdict != ratelimit.Allowed {
+					log.Printf("ratelimit: %s message from %s:%s", verdict, msg.Channel, msg.SenderID)
+					// repeat refusals are only suppressed on push channels; a
+					// request/response caller waits for an answer to every turn
+					if _, turn := msg.Metadata[chat.MetaTurn]; notify || turn {
+						a.throttleReply(limiter, msg, verdict)
+					}
+					continue
+				}
+				select {
+				case queue <- queued{msg: msg, limiter: limiter}:
+				case <-ctx.Done():
+					return
+				}
+			}
+		}
+	}()
+	return queue
+}
+
+// runToolJob calls a scheduled job's tool and sends the output to the job's
+// chat, without asking the LLM. msg.Content, if any, is sent as a heading.
+func (a *AgentLoop) runToolJob(ctx context.Context, msg chat.Inbound, run *chat.JobRun) {
+	res, err := a.tools.Execute(ctx, run.Tool, run.Args)
+	if err != nil {
+		log.Printf("cron: job %s: %s failed: %v", run.ID, run.Tool, err)
+		res = fmt.Sprintf("Scheduled %s call failed: %v", run.Tool, err)
+	}
+	defer run.Finish(res, err)
+	if msg.Content != "" {
+		res = msg.Content + "\n\n" + res
+	}
+	out := finalReply(msg, res)
+	select {
+	case a.hub.Out <- out:
+	default:
+		log.Println("Outbound channel full, dropping tool job output")
+	}
+}
+
+// attributed is msg's content, prefixed with who sent it if the channel
+// named the sender (see chat.MetaSenderName).
+func attributed(msg chat.Inbound) string {
+	name, _ := msg.Metadata[chat.MetaSenderName].(string)
+	if name == "" {
+		return msg.Content
+	}
+	return fmt.Sprintf("[%s (%s)]: %s", name, msg.SenderID, msg.Content)
+}
+
+// finalReply is the agent's last reply to msg, marked so request/response
+// channels know the turn is over.
+func finalReply(msg chat.Inbound, content string) chat.Outbound {
+	md := map[string]interface{}{chat.MetaFinal: true}
+	if turn, ok := msg.Metadata[chat.MetaTurn]; ok {
+		md[chat.MetaTurn] = turn
+	}
+	return chat.Outbound{Channel: msg.Channel, ChatID: msg.ChatID, Content: content, Metadata: md}
+}
+
+// throttleReply tells a sender why their message was not processed.
+func (a *AgentLoop) throttleReply(limiter *ratelimit.Limiter, msg chat.Inbound, verdict ratelimit.Verdict) {
+	content := limiter.Message()
+	switch verdict {
+	case ratelimit.Busy:
+		content = "I'm busy with other requests right now. Please try again in a little while."
+	case ratelimit.Banned:
+		content = fmt.Sprintf("Too many messages. I'll ignore you for the next %s.", limiter.BannedFor(msg.Channel, msg.SenderID).Round(time.Minute))
+	}
+	out := finalReply(msg, content)
+	out.Metadata[chat.MetaThrottled] = true
+	select {
+	case a.hub.Out <- out:
+	default:
+		log.Println("Outbound channel full, dropping throttle reply")
+	}
+}
+
+// mayRemember reports whether the turn's policy lets the sender do what the
+// "remember ..." shortcut does. If not, the message goes to the model instead.
+func (a *AgentLoop) mayRemember(ctx context.Context, note string) bool {
+	policy := tools.PolicyFromContext(ctx)
+	if policy == nil {
+		return true
+	}
+	t := a.tools.Get("write_memory")
+	return t != nil && policy.Check(t, map[string]interface{}{"target": "today", "content": note}) == nil
+}
+
+// historyKeys returns the session key and persistent-memory key for msg.
+// Known users who opted in share one session across their direct chats and
+// one memory history across channels; everyone else is keyed per chat.
+func historyKeys(msg chat.Inbound, user *users.User) (sessionKey, memoryKey string) {
+	sessionKey = msg.Channel + ":" + msg.ChatID
+	memoryKey = msg.Channel + msg.ChatID
+	if user == nil {
+		return sessionKey, memoryKey
+	}
+	if user.ShareSessions && isDirectChat(msg) {
+		sessionKey = "user:" + user.Name
+	}
+	if user.ShareMemory {
+		memoryKey = "user:" + user.Name
+	}
+	return sessionKey, memoryKey
+}
+
+// policyFor returns the tool policy for msg's sender. The heartbeat runs
+// under the heartbeat role.
+func policyFor(permissions *tools.Permissions, msg chat.Inbound, user *users.User) *tools.Policy {
+	var policy *tools.Policy
+	if msg.Channel == "heartbeat" {
+		policy = permissions.HeartbeatPolicy()
+	} else {
+		var roles []string
+		if user != nil {
+			roles = user.Roles
+		}
+		policy = permissions.PolicyFor(roles)
+	}
+	if policy != nil {
+		log.Printf("tools restricted to role %s for %s:%s", policy, msg.Channel, msg.SenderID)
+	}
+	return policy
+}
+
+// isDirectChat reports whether msg comes from a one-to-one conversation.
+// Channels mark group conversations in the "chat_type" metadata.
+func isDirectChat(msg chat.Inbound) bool {
+	switch t, _ := msg.Metadata["chat_type"].(string); t {
+	case "", "private", "im":
+		return true
+	}
+	return false
+}
+
+// maxTraceResult caps the tool output included in a trace.
+const maxTraceResult = 2000
+
+// trace reports a tool call back to the originating channel if it asked for traces.
+func (a *AgentLoop) trace(msg chat.Inbound, tc providers.ToolCall, result string, failed bool) {
+	if want, _ := msg.Metadata[chat.MetaTrace].(bool); !want {
+		return
+	}
+	if len(result) > maxTraceResult {
+		result = result[:maxTraceResult] + "…"
+	}
+	out := chat.Outbound{
+		Channel: msg.Channel,
+		ChatID:  msg.ChatID,
+		Content: "🔧 " + tc.Name,
+		Metadata: map[string]interface{}{
+			chat.MetaTrace: chat.ToolTrace{Tool: tc.Name, Args: tc.Arguments, Result: result, Error: failed},
+		},
+	}
+	if turn, ok := msg.Metadata[chat.MetaTurn]; ok {
+		out.Metadata[chat.MetaTurn] = turn
+	}
+	select {
+	case a.hub.Out <- out:
+	default:
+		log.Println("Outbound channel full, dropping trace")
+	}
+}
+
 // ProcessDirect sends a message directly to the provider and returns the response.
 // It supports tool calling - if the model requests tools, they will be executed.
 func (a *AgentLoop) ProcessDirect(content string, timeout time.Duration) (string, error) {
@@ -275,12 +605,13 @@ func (a *AgentLoop) ProcessDirect(content string, timeout time.Duration) (string
 	// Build full context (bootstrap files, skills, memory) just like the main loop
 	memCtx, _ := a.memory.GetMemoryContext()
 	memories := []memory.MemoryItem{} //a.memory.Recent(5)
-	messages := a.context.BuildMessages(nil, content, "cli", "direct", memCtx, memories)
+	messages := a.context.BuildMessages(nil, content, "cli", "direct", nil, memCtx, memories)
 
 	// Support tool calling iterations (similar to main loop)
 	var lastToolResult string
-	for iteration := 0; iteration < a.maxIterations; iteration++ {
-		resp, err := a.provider.Chat(ctx, messages, a.tools.Definitions(), a.model, a.temperature, a.maxTokens)
+	cfg := a.current()
+	for iteration := 0; iteration < cfg.maxIterations; iteration++ {
+		resp, err := a.provider.Chat(ctx, messages, a.tools.Definitions(ctx), cfg.model, cfg.temperature, cfg.maxTokens)
 		if err != nil {
 			return "", err
 		}
@@ -391,6 +391,30 @@ func normalizeVector(v []float32) []float32 {
 	return res
 }
 
+// ProbeEmbedder loads the configured model and tokenizer and embeds a short
+// text, returning the embedding size. It is used by picobot doctor.
+func ProbeEmbedder(memConf config.MemoryConfig) (int, error) {
+	if memConf.EmbedType != "onnx" {
+		return 0, fmt.Errorf("unknown embed type: %s", memConf.EmbedType)
+	}
+	home, _ := os.UserHomeDir()
+	emb, err := NewONNXEmbedder(&onnx.ModelConfig{
+		Path:                expandPath(memConf.ONNXModelPath, home),
+		TokenizerPath:       expandPath(memConf.ONNXTokenizerPath, home),
+		NormalizeEmbeddings: true,
+		BatchSize:           1,
+	})
+	if err != nil {
+		return 0, err
+	}
+	defer emb.Close()
+	vec, err := emb.Embed("picobot doctor")
+	if err != nil {
+		return 0, err
+	}
+	return len(vec), nil
+}
+
 func expandPath(path, home string) string {
 	if path == "" {
 		return path
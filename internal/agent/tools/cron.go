@@ -11,20 +11,26 @@ import (
 
 // CronTool schedules delayed/recurring tasks via the cron scheduler.
 // It holds a channel/chatID context (set per-incoming-message) so fired jobs
-// know where to send their notification.
+// know where to send their notification, and the sender, whose permissions
+// the jobs run with. Only the jobs of the current chat can be seen and
+// managed; `picobot cron` manages all of them.
 type CronTool struct {
 	scheduler *cron.Scheduler
+	registry  *Registry // for checking tool jobs; may be nil
 	channel   string
 	chatID    string
+	senderID  string
 }
 
-func NewCronTool(scheduler *cron.Scheduler) *CronTool {
-	return &CronTool{scheduler: scheduler}
+func NewCronTool(scheduler *cron.Scheduler, registry *Registry) *CronTool {
+	return &CronTool{scheduler: scheduler, registry: registry}
 }
 
 func (t *CronTool) Name() string { return "cron" }
 func (t *CronTool) Description() string {
-	return "Schedule one-time or recurring reminders/tasks. Actions: add (schedule), list (show pending), cancel (remove by name)."
+	return "Schedule one-time or recurring reminders/tasks. Actions: add (schedule), list (show pending), cancel (remove), pause, resume, edit (change message or schedule), run (fire now, schedule unchanged), history (past runs). Jobs are identified by name or id; only this chat's jobs are visible. " +
+		"A job runs after a delay, at an absolute time, every interval, or on a cron schedule such as '0 8 * * 1-5' (weekdays at 8:00). " +
+		"Kinds: remind (you relay the message), agent (you run the message as a prompt and only the result is sent), tool (a tool is called with fixed args and its output sent), raw (the message is sent verbatim, no LLM)."
 }
 
 func (t *CronTool) Parameters() map[string]interface{} {
@@ -33,20 +39,49 @@ func (t *CronTool) Parameters() map[string]interface{} {
 		"properties": map[string]interface{}{
 			"action": map[string]interface{}{
 				"type":        "string",
-				"description": "The action: add (schedule a new job), list (show pending jobs), cancel (remove a job by name)",
-				"enum":        []string{"add", "list", "cancel"},
+				"description": "The action: add (schedule a new job), list (show pending jobs), cancel (remove a job), pause, resume, edit (change a job's message, kind, tool, args or schedule), run (fire a job now, keeping its schedule), history (show a job's recent runs, or all jobs' if no job is given)",
+				"enum":        []string{"add", "list", "cancel", "pause", "resume", "edit", "run", "history"},
 			},
 			"name": map[string]interface{}{
 				"type":        "string",
-				"description": "A short name for the job (used to identify it for cancellation)",
+				"description": "A short name for the job; other actions find the job by it",
+			},
+			"id": map[string]interface{}{
+				"type":        "string",
+				"description": "The job's id, e.g. 'job-3'; use instead of name to pick one of several jobs with the same name",
 			},
 			"message": map[string]interface{}{
 				"type":        "string",
-				"description": "The reminder message or task description to deliver when the job fires",
+				"description": "The reminder message (remind, raw), the prompt to run (agent), or a heading for the output (tool, optional)",
+			},
+			"kind": map[string]interface{}{
+				"type":        "string",
+				"description": "What happens when the job fires (default remind). Use raw for fixed texts and tool for deterministic checks; they cost no LLM call.",
+				"enum":        cron.Kinds,
+			},
+			"tool": map[string]interface{}{
+				"type":        "string",
+				"description": "For kind tool: the tool to call, e.g. 'web'",
+			},
+			"args": map[string]interface{}{
+				"type":        "object",
+				"description": "For kind tool: the arguments to call the tool with",
 			},
 			"delay": map[string]interface{}{
 				"type":        "string",
-				"description": "How long to wait before first firing, e.g. '2m', '1h30m', '30s', '1h'. Uses Go duration format.",
+				"description": "How long to wait before first firing, e.g. '2m', '1h30m', '30s', '1h'. Uses Go duration format. Give one of delay, at or cron (for edit, at most one, to replace the schedule).",
+			},
+			"at": map[string]interface{}{
+				"type":        "string",
+				"description": "When to fire, as an RFC3339 time ('2026-03-03T14:00:00+01:00') or a local time without offset ('2026-03-03T14:00') read in timeZone.",
+			},
+			"cron": map[string]interface{}{
+				"type":        "string",
+				"description": "A 5-field cron expression (minute hour day-of-month month day-of-week) for jobs on a calendar schedule, e.g. '0 8 * * 1-5' for weekdays at 8:00 or '30 14 3 3 *' for March 3rd at 14:30. Repeats until cancelled; runs must be at least 2m apart.",
+			},
+			"timeZone": map[string]interface{}{
+				"type":        "string",
+				"description": "IANA time zone for cron and at, e.g. 'Europe/Berlin'. Defaults to the configured time zone.",
 			},
 			"recurring": map[string]interface{}{
 				"type":        "boolean",
@@ -67,6 +102,11 @@ func (t *CronTool) SetContext(channel, chatID string) {
 	t.chatID = chatID
 }
 
+// SetSender sets who is scheduling jobs, on the channel given to SetContext.
+func (t *CronTool) SetSender(senderID string) {
+	t.senderID = senderID
+}
+
 func (t *CronTool) Execute(ctx context.Context, args map[string]interface{}) (string, error) {
 	action, _ := args["action"].(string)
 
@@ -74,73 +114,351 @@ func (t *CronTool) Execute(ctx context.Context, args map[string]interface{}) (st
 	case "add":
 		name, _ := args["name"].(string)
 		message, _ := args["message"].(string)
-		delayStr, _ := args["delay"].(string)
-		recurring, _ := args["recurring"].(bool)
-		intervalStr, _ := args["interval"].(string)
+		kind, _ := args["kind"].(string)
+		toolName, _ := args["tool"].(string)
+		toolArgs, _ := args["args"].(map[string]interface{})
+		tz, _ := args["timeZone"].(string)
 
 		if name == "" {
 			name = "reminder"
 		}
-		if message == "" {
+		if kind == cron.KindTool {
+			if err := t.checkTool(ctx, toolName, toolArgs); err != nil {
+				return "", fmt.Errorf("cron add: %v", err)
+			}
+		} else if message == "" {
 			return "", fmt.Errorf("cron add: 'message' is required")
 		}
-		if delayStr == "" {
-			return "", fmt.Errorf("cron add: 'delay' is required (e.g. '2m', '1h')")
-		}
-
-		delay, err := time.ParseDuration(delayStr)
+		job := cron.Job{Name: name, Message: message, Channel: t.channel, ChatID: t.chatID, TimeZone: tz,
+			Kind: kind, Tool: toolName, Args: toolArgs, SenderID: t.senderID}
+		changed, err := t.setSchedule(&job, args)
 		if err != nil {
-			return "", fmt.Errorf("cron add: invalid delay %q: %v", delayStr, err)
+			return "", fmt.Errorf("cron add: %v", err)
 		}
-		if delay <= 0 {
-			return "", fmt.Errorf("cron add: delay must be positive")
+		if !changed {
+			return "", fmt.Errorf("cron add: give exactly one of 'delay' (e.g. '2m', '1h'), 'at' or 'cron'")
 		}
-
-		// Handle recurring jobs
-		if recurring {
-			if intervalStr == "" {
-				intervalStr = delayStr // use delay as interval if not specified
-			}
-			interval, err := time.ParseDuration(intervalStr)
-			if err != nil {
-				return "", fmt.Errorf("cron add: invalid interval %q: %v", intervalStr, err)
-			}
-			// Enforce minimum 2-minute interval to prevent abuse
-			if interval < 2*time.Minute {
-				return "", fmt.Errorf("cron add: recurring interval must be at least 2m (got %v)", interval)
-			}
-			id := t.scheduler.AddRecurring(name, message, interval, t.channel, t.chatID)
-			return fmt.Sprintf("Scheduled recurring job %q (id: %s). Will fire in %v, then repeat every %v.", name, id, delay, interval), nil
+		job, err = t.scheduler.Schedule(job)
+		if err != nil {
+			return "", fmt.Errorf("cron add: %v", err)
 		}
-
-		// One-time job
-		id := t.scheduler.Add(name, message, delay, t.channel, t.chatID)
-		return fmt.Sprintf("Scheduled job %q (id: %s). Will fire in %v.", name, id, delay), nil
+		loc := t.location(job)
+		switch {
+		case job.Cron != "":
+			return fmt.Sprintf("Scheduled job %q (id: %s), %s. First run: %s.", name, job.ID, job.Describe(), formatTime(job.FireAt, loc)), nil
+		case job.Recurring:
+			return fmt.Sprintf("Scheduled recurring job %q (id: %s). Will fire at %s, then repeat every %v.", name, job.ID, formatTime(job.FireAt, loc), job.Interval), nil
+		}
+		return fmt.Sprintf("Scheduled job %q (id: %s). Will fire at %s.", name, job.ID, formatTime(job.FireAt, loc)), nil
 
 	case "list":
-		jobs := t.scheduler.List()
+		jobs := t.jobs()
 		if len(jobs) == 0 {
 			return "No pending jobs.", nil
 		}
 		var sb strings.Builder
 		sb.WriteString(fmt.Sprintf("%d pending job(s):\n", len(jobs)))
 		for _, j := range jobs {
-			remaining := time.Until(j.FireAt).Round(time.Second)
-			sb.WriteString(fmt.Sprintf("- %s (%s): %q — fires in %v\n", j.Name, j.ID, j.Message, remaining))
+			what := fmt.Sprintf("%q", j.Message)
+			if j.Kind == cron.KindTool {
+				what = fmt.Sprintf("%s %v", j.Tool, j.Args)
+			}
+			next := "next " + formatTime(j.FireAt, t.location(j))
+			if j.Paused {
+				next = "paused"
+			}
+			sb.WriteString(fmt.Sprintf("- %s (%s, %s): %s — %s, %s\n", j.Name, j.ID, j.Kind, what, j.Describe(), next))
 		}
 		return sb.String(), nil
 
 	case "cancel":
-		name, _ := args["name"].(string)
-		if name == "" {
-			return "", fmt.Errorf("cron cancel: 'name' is required")
+		ref := jobRef(args)
+		if ref == "" {
+			return "", fmt.Errorf("cron cancel: 'name' or 'id' is required")
+		}
+		if job, ok := t.lookup(ref); ok && t.scheduler.Cancel(job.ID) {
+			return fmt.Sprintf("Cancelled job %q (id: %s).", job.Name, job.ID), nil
+		}
+		return fmt.Sprintf("No job found with name or id %q.", ref), nil
+
+	case "pause", "resume", "run":
+		job, err := t.find(action, args)
+		if err != nil {
+			return "", err
+		}
+		var ok bool
+		switch action {
+		case "pause":
+			job, ok = t.scheduler.Pause(job.ID)
+		case "resume":
+			job, ok = t.scheduler.Resume(job.ID)
+		default:
+			job, ok = t.scheduler.RunNow(job.ID)
+		}
+		switch {
+		case !ok:
+			return fmt.Sprintf("No job found with id %q.", job.ID), nil
+		case action == "pause":
+			return fmt.Sprintf("Paused job %q (id: %s).", job.Name, job.ID), nil
+		case action == "resume":
+			return fmt.Sprintf("Resumed job %q (id: %s). Next run: %s.", job.Name, job.ID, formatTime(job.FireAt, t.location(job))), nil
+		}
+		return fmt.Sprintf("Job %q (id: %s) will run in a moment; its schedule is unchanged.", job.Name, job.ID), nil
+
+	case "edit":
+		job, err := t.find(action, args)
+		if err != nil {
+			return "", err
+		}
+		if message, ok := args["message"].(string); ok && message != "" {
+			job.Message = message
+		}
+		if kind, ok := args["kind"].(string); ok && kind != "" {
+			job.Kind = kind
+		}
+		if toolName, ok := args["tool"].(string); ok && toolName != "" {
+			job.Tool = toolName
+		}
+		if toolArgs, ok := args["args"].(map[string]interface{}); ok {
+			job.Args = toolArgs
+		}
+		if tz, ok := args["timeZone"].(string); ok && tz != "" {
+			job.TimeZone = tz
+		}
+		if job.Kind == cron.KindTool {
+			if err := t.checkTool(ctx, job.Tool, job.Args); err != nil {
+				return "", fmt.Errorf("cron edit: %v", err)
+			}
+		}
+		// the edited job runs with the editor's permissions, so editing
+		// someone else's job can't borrow theirs
+		job.SenderID = t.senderID
+		if _, err := t.setSchedule(&job, args); err != nil {
+			return "", fmt.Errorf("cron edit: %v", err)
+		}
+		job, err = t.scheduler.Update(job.ID, func(j *cron.Job) { *j = job })
+		if err != nil {
+			return "", fmt.Errorf("cron edit: %v", err)
+		}
+		next := "next run " + formatTime(job.FireAt, t.location(job))
+		if job.Paused {
+			next = "paused"
+		}
+		return fmt.Sprintf("Updated job %q (id: %s), %s, %s.", job.Name, job.ID, job.Describe(), next), nil
+
+	case "history":
+		id := ""
+		if jobRef(args) != "" {
+			job, err := t.find(action, args)
+			if err != nil {
+				return "", err
+			}
+			id = job.ID
+		}
+		all, err := t.scheduler.History(id)
+		if err != nil {
+			return "", fmt.Errorf("cron history: %v", err)
+		}
+		var runs []cron.Run
+		for _, r := range all {
+			if r.Channel == t.channel && r.ChatID == t.chatID {
+				runs = append(runs, r)
+			}
+		}
+		if len(runs) == 0 {
+			return "No runs logged.", nil
+		}
+		if len(runs) > 10 {
+			runs = runs[len(runs)-10:]
 		}
-		if t.scheduler.CancelByName(name) {
-			return fmt.Sprintf("Cancelled job %q.", name), nil
+		loc, _ := t.scheduler.Location("")
+		var sb strings.Builder
+		sb.WriteString(fmt.Sprintf("Last %d run(s):\n", len(runs)))
+		for _, r := range runs {
+			sb.WriteString(fmt.Sprintf("- %s (%s) %s, %s, took %v: %s\n", r.Name, r.JobID, r.Start.In(loc).Format("2006-01-02 15:04"), r.Status, r.End.Sub(r.Start).Round(time.Second), r.Output))
+		}
+		return sb.String(), nil
+
+	default:
+		return "", fmt.Errorf("cron: unknown action %q (use add, list, cancel, pause, resume, edit, run or history)", action)
+	}
+}
+
+// jobRef is the id or, failing that, the name in args.
+func jobRef(args map[string]interface{}) string {
+	if id, _ := args["id"].(string); id != "" {
+		return id
+	}
+	name, _ := args["name"].(string)
+	return name
+}
+
+// find returns the job args refer to by id or name.
+func (t *CronTool) find(action string, args map[string]interface{}) (cron.Job, error) {
+	ref := jobRef(args)
+	if ref == "" {
+		return cron.Job{}, fmt.Errorf("cron %s: 'name' or 'id' is required", action)
+	}
+	job, ok := t.lookup(ref)
+	if !ok {
+		return cron.Job{}, fmt.Errorf("cron %s: no job found with name or id %q", action, ref)
+	}
+	return job, nil
+}
+
+// jobs returns the pending jobs of the current chat.
+func (t *CronTool) jobs() []cron.Job {
+	var result []cron.Job
+	for _, j := range t.scheduler.List() {
+		if j.Channel == t.channel && j.ChatID == t.chatID {
+			result = append(result, j)
 		}
-		return fmt.Sprintf("No job found with name %q.", name), nil
+	}
+	return result
+}
+
+// lookup finds a job of the current chat by id or, failing that, by name.
+func (t *CronTool) lookup(ref string) (cron.Job, bool) {
+	jobs := t.jobs()
+	for _, j := range jobs {
+		if j.ID == ref {
+			return j, true
+		}
+	}
+	for _, j := range jobs {
+		if j.Name == ref {
+			return j, true
+		}
+	}
+	return cron.Job{}, false
+}
+
+// location is the time zone a job's times are shown in.
+func (t *CronTool) location(j cron.Job) *time.Location {
+	loc, err := t.scheduler.Location(j.TimeZone)
+	if err != nil {
+		return time.Local
+	}
+	return loc
+}
+
+// setSchedule replaces the job's schedule with the one in args, if any:
+// one of delay, at or cron, plus recurring and interval. It reports whether
+// args had a schedule. An interval alone changes a recurring job's
+// interval.
+func (t *CronTool) setSchedule(job *cron.Job, args map[string]interface{}) (bool, error) {
+	delayStr, _ := args["delay"].(string)
+	atStr, _ := args["at"].(string)
+	expr, _ := args["cron"].(string)
+	recurring, _ := args["recurring"].(bool)
+	intervalStr, _ := args["interval"].(string)
+
+	given := 0
+	for _, v := range []string{delayStr, atStr, expr} {
+		if v != "" {
+			given++
+		}
+	}
+	switch {
+	case given > 1:
+		return false, fmt.Errorf("give only one of 'delay' (e.g. '2m', '1h'), 'at' or 'cron'")
+	case given == 0 && intervalStr != "" && job.Recurring && job.Cron == "":
+		recurring = true
+	case given == 0:
+		return false, nil
+	}
+	loc, err := t.scheduler.Location(job.TimeZone)
+	if err != nil {
+		return false, fmt.Errorf("unknown time zone %q", job.TimeZone)
+	}
+	job.Cron, job.Recurring, job.Interval = "", false, 0
 
+	switch {
+	case expr != "":
+		e, err := cron.ParseExpr(expr)
+		if err != nil {
+			return false, err
+		}
+		// same minimum as recurring intervals below
+		if gap := e.MinGap(time.Now().In(loc)); gap > 0 && gap < 2*time.Minute {
+			return false, fmt.Errorf("cron expression %q runs every %v; runs must be at least 2m apart", expr, gap)
+		}
+		job.Cron, job.FireAt = expr, time.Time{}
+		return true, nil
+	case atStr != "":
+		at, err := parseTime(atStr, loc)
+		if err != nil {
+			return false, err
+		}
+		job.FireAt = at
+	case delayStr != "":
+		delay, err := time.ParseDuration(delayStr)
+		if err != nil {
+			return false, fmt.Errorf("invalid delay %q: %v", delayStr, err)
+		}
+		if delay <= 0 {
+			return false, fmt.Errorf("delay must be positive")
+		}
+		job.FireAt = time.Now().Add(delay)
 	default:
-		return "", fmt.Errorf("cron: unknown action %q (use add, list, or cancel)", action)
+		job.FireAt = time.Time{} // one interval from now
 	}
+
+	// Handle recurring jobs
+	if recurring {
+		if intervalStr == "" {
+			intervalStr = delayStr // use delay as interval if not specified
+		}
+		interval, err := time.ParseDuration(intervalStr)
+		if err != nil {
+			return false, fmt.Errorf("invalid interval %q: %v", intervalStr, err)
+		}
+		// Enforce minimum 2-minute interval to prevent abuse
+		if interval < 2*time.Minute {
+			return false, fmt.Errorf("recurring interval must be at least 2m (got %v)", interval)
+		}
+		job.Recurring, job.Interval = true, interval
+	}
+	return true, nil
+}
+
+// checkTool makes sure a tool job can run: the tool exists, isn't one that
+// needs a conversation, and the sender may call it with these arguments.
+func (t *CronTool) checkTool(ctx context.Context, name string, args map[string]interface{}) error {
+	if name == "" {
+		return fmt.Errorf("'tool' is required for kind tool")
+	}
+	if t.registry == nil {
+		return nil
+	}
+	tool := t.registry.Get(name)
+	if tool == nil {
+		return fmt.Errorf("unknown tool %q", name)
+	}
+	switch name {
+	case "cron", "message", "spawn":
+		return fmt.Errorf("tool %q can't run as a scheduled job", name)
+	}
+	return PolicyFromContext(ctx).Check(tool, args)
+}
+
+// localLayouts are the forms accepted for times without a UTC offset.
+var localLayouts = []string{"2006-01-02T15:04:05", "2006-01-02T15:04", "2006-01-02 15:04:05", "2006-01-02 15:04"}
+
+// parseTime reads an RFC3339 time, or a time without offset in loc.
+func parseTime(s string, loc *time.Location) (time.Time, error) {
+	if t, err := time.Parse(time.RFC3339, s); err == nil {
+		return t, nil
+	}
+	for _, layout := range localLayouts {
+		if t, err := time.ParseInLocation(layout, s, loc); err == nil {
+			return t, nil
+		}
+	}
+	return time.Time{}, fmt.Errorf("invalid time %q (use RFC3339 like 2026-03-03T14:00:00+01:00, or 2026-03-03T14:00)", s)
+}
+
+// formatTime shows t in loc along with how far away it is.
+func formatTime(t time.Time, loc *time.Location) string {
+	return fmt.Sprintf("%s (in %v)", t.In(loc).Format("Mon 2006-01-02 15:04 MST"), time.Until(t).Round(time.Second))
 }
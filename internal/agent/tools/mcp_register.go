@@ -7,7 +7,9 @@ import (
 	"log"
 	"os"
 	"path/filepath"
+	"reflect"
 	"strings"
+	"sync"
 	"time"
 
 	"github.com/local/picobot/internal/config"
@@ -20,111 +22,190 @@ import (
 // into the provided registry. Each server's tools are registered with names
 // prefixed by "mcp.<server>.<tool>".
 func RegisterMCPFromConfig(reg *Registry, cfg *config.ToolsConfig) {
-	if cfg.MCP == nil || !cfg.MCP.Enabled {
-		return
-	}
+	NewMCPServers(reg).Sync(cfg)
+}
 
-	for srvName, srv := range cfg.MCP.Servers {
-		// build transport
-		var tr transport.Interface
-		switch strings.ToLower(srv.Transport) {
-		case "stdio":
-			// expand ~ in command
-			cmd := srv.Command
-			if strings.HasPrefix(cmd, "~/") {
-				if h, err := os.UserHomeDir(); err == nil {
-					cmd = filepath.Join(h, cmd[2:])
-				}
-			}
-			tr = transport.NewStdio(cmd, nil, srv.Args...)
-			log.Printf("mcp: starting stdio transport for %s: %s %v\n", srvName, cmd, srv.Args)
-		case "http":
-			// convert headers
-			hdr := make(map[string]string)
-			for k, v := range srv.Headers {
-				hdr[k] = v
-			}
-			// create streamable HTTP transport (SDK transport factory)
-			t, err := transport.NewStreamableHTTP(srv.URL, transport.WithHTTPHeaders(hdr))
-			if err != nil {
-				log.Printf("mcp: failed to create http transport for %s: %v", srvName, err)
-				continue
-			}
-			tr = t
-		default:
-			log.Printf("mcp: unknown transport %q for server %s", srv.Transport, srvName)
+// MCPServers keeps track of the MCP servers whose tools are registered in a
+// registry, so servers can be added, changed and removed while running.
+type MCPServers struct {
+	reg     *Registry
+	mu      sync.Mutex
+	servers map[string]*mcpServer
+}
+
+type mcpServer struct {
+	cfg    config.MCPServerConfig
+	client *mcpclient.Client
+	tools  []*mcpRemoteTool
+}
+
+// NewMCPServers returns an empty set of servers registering into reg.
+func NewMCPServers(reg *Registry) *MCPServers {
+	return &MCPServers{reg: reg, servers: make(map[string]*mcpServer)}
+}
+
+// Sync connects the servers in cfg that aren't connected yet, reconnects
+// servers whose config changed and disconnects servers that were removed
+// (or all of them, if MCP is disabled). It returns the names of the servers
+// started and stopped.
+func (m *MCPServers) Sync(cfg *config.ToolsConfig) (started, stopped []string) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	want := map[string]config.MCPServerConfig{}
+	if cfg != nil && cfg.MCP != nil && cfg.MCP.Enabled {
+		want = cfg.MCP.Servers
+	}
+	for name, s := range m.servers {
+		if srv, ok := want[name]; ok && reflect.DeepEqual(srv, s.cfg) {
 			continue
 		}
-
-		// create client
-		cli := mcpclient.NewClient(tr)
-		ctx := context.Background()
-		if err := cli.Start(ctx); err != nil {
-			log.Printf("mcp: failed to start client for %s: %v", srvName, err)
+		m.stop(name, s)
+		stopped = append(stopped, name)
+	}
+	for name, srv := range want {
+		if _, ok := m.servers[name]; ok {
+			continue
+		}
+		s, err := startMCPServer(name, srv)
+		if err != nil {
+			log.Printf("mcp: %v", err)
 			continue
 		}
+		for _, rt := range s.tools {
+			m.reg.Register(rt)
+		}
+		m.servers[name] = s
+		started = append(started, name)
+	}
+	return started, stopped
+}
 
-		// Initialize the MCP session in a goroutine to avoid blocking stdio read/write loops
-		initDone := make(chan error, 1)
-		go func() {
-			initRequest := mcp.InitializeRequest{
-				Params: mcp.InitializeParams{
-					ProtocolVersion: mcp.LATEST_PROTOCOL_VERSION,
-					Capabilities:    mcp.ClientCapabilities{},
-					ClientInfo: mcp.Implementation{
-						Name:    "picobot",
-						Version: "1.0.0",
-					},
-				},
-			}
-			initResult, err := cli.Initialize(ctx, initRequest)
-			if err != nil {
-				log.Printf("Failed to initialize: %v", err)
-			} else {
-				log.Printf(
-					"Initialized with server: %s %s\n\n",
-					initResult.ServerInfo.Name,
-					initResult.ServerInfo.Version,
-				)
-			}
-			initDone <- err
-		}()
-
-		// Wait for initialize to complete (with timeout)
-		initCtx, cancel := context.WithTimeout(ctx, 10*time.Second)
-		select {
-		case err := <-initDone:
-			cancel()
-			if err != nil {
-				log.Printf("mcp: initialize failed for %s: %v", srvName, err)
-				// continue - client may still work for simple calls
+// stop unregisters the server's tools and closes its client. Callers hold m.mu.
+func (m *MCPServers) stop(name string, s *mcpServer) {
+	for _, rt := range s.tools {
+		// another server may have registered a tool with the same name since
+		if m.reg.Get(rt.name) == Tool(rt) {
+			m.reg.Unregister(rt.name)
+		}
+	}
+	if err := s.client.Close(); err != nil {
+		log.Printf("mcp: closing %s: %v", name, err)
+	}
+	delete(m.servers, name)
+	log.Printf("mcp: stopped server %s", name)
+}
+
+// ProbeMCPServer starts one server, lists its tools and shuts it down again.
+// It returns the number of tools the server offers.
+func ProbeMCPServer(name string, srv config.MCPServerConfig) (int, error) {
+	s, err := startMCPServer(name, srv)
+	if err != nil {
+		return 0, err
+	}
+	s.client.Close()
+	return len(s.tools), nil
+}
+
+// startMCPServer connects to one server and lists its tools.
+func startMCPServer(srvName string, srv config.MCPServerConfig) (*mcpServer, error) {
+	// build transport
+	var tr transport.Interface
+	switch strings.ToLower(srv.Transport) {
+	case "stdio":
+		// expand ~ in command
+		cmd := srv.Command
+		if strings.HasPrefix(cmd, "~/") {
+			if h, err := os.UserHomeDir(); err == nil {
+				cmd = filepath.Join(h, cmd[2:])
 			}
-		case <-initCtx.Done():
-			cancel()
-			log.Printf("mcp: initialize timeout for %s", srvName)
-			continue
 		}
+		tr = transport.NewStdio(cmd, nil, srv.Args...)
+		log.Printf("mcp: starting stdio transport for %s: %s %v\n", srvName, cmd, srv.Args)
+	case "http":
+		// convert headers
+		hdr := make(map[string]string)
+		for k, v := range srv.Headers {
+			hdr[k] = v
+		}
+		// create streamable HTTP transport (SDK transport factory)
+		t, err := transport.NewStreamableHTTP(srv.URL, transport.WithHTTPHeaders(hdr))
+		if err != nil {
+			return nil, fmt.Errorf("failed to create http transport for %s: %w", srvName, err)
+		}
+		tr = t
+	default:
+		return nil, fmt.Errorf("unknown transport %q for server %s", srv.Transport, srvName)
+	}
+
+	// create client
+	cli := mcpclient.NewClient(tr)
+	ctx := context.Background()
+	if err := cli.Start(ctx); err != nil {
+		return nil, fmt.Errorf("failed to start client for %s: %w", srvName, err)
+	}
 
-		// list tools exposed by server
-		toolsRes, err := cli.ListTools(ctx, mcp.ListToolsRequest{})
+	// Initialize the MCP session in a goroutine to avoid blocking stdio read/write loops
+	initDone := make(chan error, 1)
+	go func() {
+		initRequest := mcp.InitializeRequest{
+			Params: mcp.InitializeParams{
+				ProtocolVersion: mcp.LATEST_PROTOCOL_VERSION,
+				Capabilities:    mcp.ClientCapabilities{},
+				ClientInfo: mcp.Implementation{
+					Name:    "picobot",
+					Version: "1.0.0",
+				},
+			},
+		}
+		initResult, err := cli.Initialize(ctx, initRequest)
 		if err != nil {
-			log.Printf("mcp: failed to list tools for %s: %v", srvName, err)
-			continue
+			log.Printf("Failed to initialize: %v", err)
+		} else {
+			log.Printf(
+				"Initialized with server: %s %s\n\n",
+				initResult.ServerInfo.Name,
+				initResult.ServerInfo.Version,
+			)
 		}
+		initDone <- err
+	}()
+
+	// Wait for initialize to complete (with timeout)
+	initCtx, cancel := context.WithTimeout(ctx, 10*time.Second)
+	select {
+	case err := <-initDone:
+		cancel()
+		if err != nil {
+			log.Printf("mcp: initialize failed for %s: %v", srvName, err)
+			// continue - client may still work for simple calls
+		}
+	case <-initCtx.Done():
+		cancel()
+		cli.Close()
+		return nil, fmt.Errorf("initialize timeout for %s", srvName)
+	}
 
-		for _, t := range toolsRes.Tools {
-			// try to convert the tool input schema into a generic map for provider tooling
-			var params map[string]interface{}
-			if b, err := json.Marshal(t.InputSchema); err == nil {
-				_ = json.Unmarshal(b, &params)
-			}
+	// list tools exposed by server
+	toolsRes, err := cli.ListTools(ctx, mcp.ListToolsRequest{})
+	if err != nil {
+		cli.Close()
+		return nil, fmt.Errorf("failed to list tools for %s: %w", srvName, err)
+	}
 
-			// register each remote tool using its original name so model tool-calls match
-			regName := t.Name
-			rt := &mcpRemoteTool{client: cli, server: srvName, toolName: t.Name, description: t.Description, parameters: params}
-			reg.Register(rt.withName(regName))
+	s := &mcpServer{cfg: srv, client: cli}
+	for _, t := range toolsRes.Tools {
+		// try to convert the tool input schema into a generic map for provider tooling
+		var params map[string]interface{}
+		if b, err := json.Marshal(t.InputSchema); err == nil {
+			_ = json.Unmarshal(b, &params)
 		}
+
+		// register each remote tool using its original name so model tool-calls match
+		rt := &mcpRemoteTool{client: cli, server: srvName, toolName: t.Name, name: t.Name, description: t.Description, parameters: params}
+		s.tools = append(s.tools, rt)
 	}
+	return s, nil
 }
 
 type mcpRemoteTool struct {
@@ -136,11 +217,6 @@ type mcpRemoteTool struct {
 	parameters  map[string]interface{}
 }
 
-func (m *mcpRemoteTool) withName(n string) Tool {
-	m.name = n
-	return m
-}
-
 func (m *mcpRemoteTool) Name() string                       { return m.name }
 func (m *mcpRemoteTool) Description() string                { return m.description }
 func (m *mcpRemoteTool) Parameters() map[string]interface{} { return m.parameters }
@@ -36,12 +36,30 @@ func (m *MessageTool) Parameters() map[string]interface{} {
 			"channel": map[string]interface{}{
 				"type":        "string",
 				"description": "The channel to send the message to",
-				"enum":        []string{"telegram", "ntfy"}, // TODO: dynamically populate based on registered channels
+				"enum":        []string{"telegram", "ntfy", "matrix", "email", "slack", "signal", "mqtt"}, // TODO: dynamically populate based on registered channels
 			},
 			"chatID": map[string]interface{}{
 				"type":        "string",
 				"description": "The chat ID or topic to send the message to",
 			},
+			"buttons": map[string]interface{}{
+				"type":        "array",
+				"description": "Optional quick-reply buttons, e.g. [\"Yes\", \"No\"] to ask for confirmation. The label of the clicked button comes back as the user's next message. Rendered on Slack; ignored elsewhere.",
+				"items": map[string]interface{}{
+					"type": "string",
+				},
+			},
+			"ntfy": map[string]interface{}{
+				"type":        "object",
+				"description": "Optional ntfy notification options, used only on the ntfy channel: title, priority (1-5 or min/low/default/high/max), tags (list of tag or emoji names), click (URL opened on tap), actions (ntfy action buttons, e.g. \"view, Open, https://example.com\").",
+				"properties": map[string]interface{}{
+					"title":    map[string]interface{}{"type": "string"},
+					"priority": map[string]interface{}{"type": "string"},
+					"tags":     map[string]interface{}{"type": "array", "items": map[string]interface{}{"type": "string"}},
+					"click":    map[string]interface{}{"type": "string"},
+					"actions":  map[string]interface{}{"type": "string"},
+				},
+			},
 		},
 		"required": []string{"content"},
 	}
@@ -87,6 +105,25 @@ func (m *MessageTool) Execute(ctx context.Context, args map[string]interface{})
 		ChatID:  chatID,
 		Content: content,
 	}
+	if raw, ok := args["buttons"].([]interface{}); ok && len(raw) > 0 {
+		buttons := make([]string, 0, len(raw))
+		for _, b := range raw {
+			if label, ok := b.(string); ok && label != "" {
+				buttons = append(buttons, label)
+			}
+		}
+		out.Metadata = map[string]interface{}{"buttons": buttons}
+	}
+	if opts, ok := args["ntfy"].(map[string]interface{}); ok && channel == "ntfy" {
+		if out.Metadata == nil {
+			out.Metadata = map[string]interface{}{}
+		}
+		for _, key := range []string{"title", "priority", "tags", "click", "actions"} {
+			if v, ok := opts[key]; ok {
+				out.Metadata[key] = v
+			}
+		}
+	}
 
 	select {
 	case m.hub.Out <- out:
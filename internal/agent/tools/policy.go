@@ -0,0 +1,215 @@
+package tools
+
+import (
+	"context"
+	"fmt"
+	"path"
+	"regexp"
+	"sort"
+	"strings"
+
+	"github.com/local/picobot/internal/config"
+)
+
+// role is a compiled RoleConfig.
+type role struct {
+	name  string
+	allow []string
+	deny  []string
+	args  map[string]map[string]*regexp.Regexp
+}
+
+// Permissions holds the compiled roles from config.
+type Permissions struct {
+	defaultRole   string
+	heartbeatRole string
+	roles         map[string]*role
+}
+
+// NewPermissions compiles the permissions config, validating role names and
+// argument patterns. Patterns must match the whole argument.
+func NewPermissions(cfg config.PermissionsConfig) (*Permissions, error) {
+	p := &Permissions{defaultRole: cfg.DefaultRole, heartbeatRole: cfg.HeartbeatRole, roles: make(map[string]*role)}
+	for name, rc := range cfg.Roles {
+		r := &role{name: name, allow: rc.Allow, deny: rc.Deny, args: make(map[string]map[string]*regexp.Regexp)}
+		for _, pat := range append(append([]string{}, rc.Allow...), rc.Deny...) {
+			if _, err := path.Match(strings.TrimPrefix(pat, "mcp:"), ""); err != nil {
+				return nil, fmt.Errorf("role %q: invalid tool pattern %q", name, pat)
+			}
+		}
+		for tool, args := range rc.Args {
+			r.args[tool] = make(map[string]*regexp.Regexp)
+			for arg, expr := range args {
+				re, err := regexp.Compile("^(?:" + expr + ")$")
+				if err != nil {
+					return nil, fmt.Errorf("role %q: tool %s argument %s: %w", name, tool, arg, err)
+				}
+				r.args[tool][arg] = re
+			}
+		}
+		p.roles[name] = r
+	}
+	if p.defaultRole != "" && p.roles[p.defaultRole] == nil {
+		return nil, fmt.Errorf("default role %q is not defined", p.defaultRole)
+	}
+	if p.heartbeatRole != "" && p.roles[p.heartbeatRole] == nil {
+		return nil, fmt.Errorf("heartbeat role %q is not defined", p.heartbeatRole)
+	}
+	return p, nil
+}
+
+// HeartbeatPolicy returns the policy HEARTBEAT.md tasks run under: the
+// heartbeat role, or the default role if none is set. The file can be
+// edited through tools, so the heartbeat gets no more than it is given here.
+func (p *Permissions) HeartbeatPolicy() *Policy {
+	if p == nil {
+		return nil
+	}
+	var roles []string
+	if p.heartbeatRole != "" {
+		roles = []string{p.heartbeatRole}
+	}
+	return p.PolicyFor(roles)
+}
+
+// PolicyFor returns the policy for a sender holding the given roles. Roles
+// that aren't configured are ignored; a sender left without any falls back
+// to the default role. A nil policy means no restrictions.
+func (p *Permissions) PolicyFor(roles []string) *Policy {
+	if p == nil {
+		return nil
+	}
+	pol := &Policy{}
+	for _, name := range roles {
+		if r := p.roles[name]; r != nil {
+			pol.roles = append(pol.roles, r)
+		}
+	}
+	if len(pol.roles) == 0 {
+		r := p.roles[p.defaultRole]
+		if r == nil {
+			return nil
+		}
+		pol.roles = append(pol.roles, r)
+	}
+	return pol
+}
+
+// Policy restricts the tools one request may use. A tool is usable if any
+// of the sender's roles allows it, with that role's argument constraints.
+type Policy struct {
+	roles []*role
+}
+
+// String lists the policy's role names, for logs and error messages.
+func (p *Policy) String() string {
+	names := make([]string, len(p.roles))
+	for i, r := range p.roles {
+		names[i] = r.name
+	}
+	sort.Strings(names)
+	return strings.Join(names, ", ")
+}
+
+type policyKey struct{}
+
+// WithPolicy returns a context carrying the policy for the current request.
+func WithPolicy(ctx context.Context, p *Policy) context.Context {
+	return context.WithValue(ctx, policyKey{}, p)
+}
+
+// PolicyFromContext returns the request's policy, or nil if unrestricted.
+func PolicyFromContext(ctx context.Context) *Policy {
+	p, _ := ctx.Value(policyKey{}).(*Policy)
+	return p
+}
+
+// toolMatches reports whether a tool matches an allow/deny entry.
+func toolMatches(pattern string, t Tool) bool {
+	if server, ok := strings.CutPrefix(pattern, "mcp:"); ok {
+		rt, isMCP := t.(*mcpRemoteTool)
+		if !isMCP {
+			return false
+		}
+		m, _ := path.Match(server, rt.server)
+		return m
+	}
+	m, _ := path.Match(pattern, t.Name())
+	return m
+}
+
+func (r *role) permits(t Tool) bool {
+	for _, pat := range r.deny {
+		if toolMatches(pat, t) {
+			return false
+		}
+	}
+	if len(r.allow) == 0 {
+		return true
+	}
+	for _, pat := range r.allow {
+		if toolMatches(pat, t) {
+			return true
+		}
+	}
+	return false
+}
+
+// checkArgs returns an error if args violate the role's constraints for t.
+// A missing argument is checked as "", so leaving it out to get the tool's
+// default doesn't get around the constraint. File paths are cleaned first, so
+// "notes/../SOUL.md" is checked as "SOUL.md".
+func (r *role) checkArgs(t Tool, args map[string]interface{}) error {
+	for arg, re := range r.args[t.Name()] {
+		var s string
+		switch v := args[arg].(type) {
+		case nil:
+		case string:
+			s = v
+		default:
+			s = fmt.Sprint(v)
+		}
+		if arg == "path" && s != "" {
+			s = path.Clean(s)
+		}
+		if !re.MatchString(s) {
+			return fmt.Errorf("argument %q of tool %s is not allowed (must match %s)", arg, t.Name(), re)
+		}
+	}
+	return nil
+}
+
+// Allows reports whether the policy exposes t at all.
+func (p *Policy) Allows(t Tool) bool {
+	if p == nil {
+		return true
+	}
+	for _, r := range p.roles {
+		if r.permits(t) {
+			return true
+		}
+	}
+	return false
+}
+
+// Check returns an error unless some role permits calling t with args.
+func (p *Policy) Check(t Tool, args map[string]interface{}) error {
+	if p == nil {
+		return nil
+	}
+	var argErr error
+	for _, r := range p.roles {
+		if !r.permits(t) {
+			continue
+		}
+		if err := r.checkArgs(t, args); err != nil {
+			argErr = err
+			continue
+		}
+		return nil
+	}
+	if argErr != nil {
+		return argErr
+	}
+	return fmt.Errorf("tool %s is not permitted for role %s", t.Name(), p)
+}
@@ -36,6 +36,13 @@ func (r *Registry) Register(t Tool) {
 	r.tools[t.Name()] = t
 }
 
+// Unregister removes a tool from the registry.
+func (r *Registry) Unregister(name string) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	delete(r.tools, name)
+}
+
 // Get returns a tool by name (or nil if not found).
 func (r *Registry) Get(name string) Tool {
 	r.mu.RLock()
@@ -43,12 +50,17 @@ func (r *Registry) Get(name string) Tool {
 	return r.tools[name]
 }
 
-// Definitions returns the list of tool definitions to expose to the model.
-func (r *Registry) Definitions() []providers.ToolDefinition {
+// Definitions returns the list of tool definitions to expose to the model,
+// leaving out tools the request's policy (see WithPolicy) doesn't allow.
+func (r *Registry) Definitions(ctx context.Context) []providers.ToolDefinition {
+	policy := PolicyFromContext(ctx)
 	r.mu.RLock()
 	defer r.mu.RUnlock()
 	defs := make([]providers.ToolDefinition, 0, len(r.tools))
 	for _, t := range r.tools {
+		if !policy.Allows(t) {
+			continue
+		}
 		defs = append(defs, providers.ToolDefinition{
 			Name:        t.Name(),
 			Description: t.Description(),
@@ -59,6 +71,7 @@ func (r *Registry) Definitions() []providers.ToolDefinition {
 }
 
 // Execute executes a registered tool by name with args and returns result or error.
+// Calls the request's policy does not permit are rejected.
 func (r *Registry) Execute(ctx context.Context, name string, args map[string]interface{}) (string, error) {
 	if name == "" {
 		return "", errors.New("tool name is required")
@@ -69,5 +82,8 @@ func (r *Registry) Execute(ctx context.Context, name string, args map[string]int
 	if !ok {
 		return "", errors.New("tool not found")
 	}
+	if err := PolicyFromContext(ctx).Check(t, args); err != nil {
+		return "", err
+	}
 	return t.Execute(ctx, args)
 }
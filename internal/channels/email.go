@@ -0,0 +1,454 @@
+package channels
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha1"
+	"crypto/tls"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"mime"
+	"mime/multipart"
+	"mime/quotedprintable"
+	"net"
+	"net/mail"
+	"net/smtp"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+	"unicode/utf8"
+
+	"github.com/inbucket/html2text"
+
+	"github.com/local/picobot/internal/chat"
+	"github.com/local/picobot/internal/config"
+)
+
+// emailThread is what's needed to reply within a conversation.
+type emailThread struct {
+	To         string `json:"to"`
+	Subject    string `json:"subject"`
+	MessageID  string `json:"messageId"` // Message-ID of the latest message in the thread
+	References string `json:"references,omitempty"`
+}
+
+type emailChannel struct {
+	cfg         config.EmailConfig
+	from        string
+	allowed     map[string]struct{}
+	mediaDir    string
+	threadsFile string
+
+	mu      sync.Mutex
+	threads map[string]emailThread // chat ID -> thread
+	ignored map[uint32]bool        // UIDs from unauthorized senders, left unread
+}
+
+// StartEmail polls an IMAP mailbox for unread mail from allowed senders and
+// replies over SMTP. Each email thread (identified by its root Message-ID, taken
+// from References/In-Reply-To) is one session. Threads are persisted under
+// workspace so replies and scheduled deliveries still reach them after a restart.
+func StartEmail(ctx context.Context, hub *chat.Hub, cfg config.EmailConfig, workspace string) error {
+	if cfg.IMAPHost == "" || cfg.SMTPHost == "" {
+		return fmt.Errorf("email imapHost and smtpHost are required")
+	}
+	if cfg.Username == "" || cfg.Password == "" {
+		return fmt.Errorf("email username/password not provided")
+	}
+	if cfg.IMAPPort == 0 {
+		cfg.IMAPPort = 993
+	}
+	if cfg.SMTPPort == 0 {
+		cfg.SMTPPort = 587
+	}
+	if cfg.Mailbox == "" {
+		cfg.Mailbox = "INBOX"
+	}
+	interval := time.Duration(cfg.PollIntervalS) * time.Second
+	if interval <= 0 {
+		interval = 60 * time.Second
+	}
+	if strings.HasPrefix(workspace, "~/") {
+		if home, err := os.UserHomeDir(); err == nil {
+			workspace = filepath.Join(home, workspace[2:])
+		}
+	}
+	allowed := make(map[string]struct{}, len(cfg.AllowFrom))
+	for _, a := range cfg.AllowFrom {
+		allowed[strings.ToLower(strings.TrimSpace(a))] = struct{}{}
+	}
+
+	ec := &emailChannel{
+		cfg:         cfg,
+		from:        cfg.From,
+		allowed:     allowed,
+		mediaDir:    filepath.Join(workspace, "media", "email"),
+		threadsFile: filepath.Join(workspace, "email_threads.json"),
+		threads:     make(map[string]emailThread),
+		ignored:     make(map[uint32]bool),
+	}
+	if ec.from == "" {
+		ec.from = cfg.Username
+	}
+	if b, err := os.ReadFile(ec.threadsFile); err == nil {
+		if err := json.Unmarshal(b, &ec.threads); err != nil {
+			log.Printf("email: ignoring unreadable %s: %v", ec.threadsFile, err)
+		}
+	}
+
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			if err := ec.poll(hub); err != nil {
+				log.Printf("email: poll error: %v", err)
+			}
+			select {
+			case <-ctx.Done():
+				log.Println("email: stopping inbound polling")
+				return
+			case <-ticker.C:
+			}
+		}
+	}()
+
+	go func() {
+		for {
+			select {
+			case <-ctx.Done():
+				log.Println("email: stopping outbound sender")
+				return
+			case out := <-hub.EmailOut:
+				if err := ec.send(out); err != nil {
+					log.Printf("email: send error: %v", err)
+				}
+			}
+		}
+	}()
+
+	log.Printf("email channel started for %s (polling %s every %v)", cfg.Username, cfg.Mailbox, interval)
+	return nil
+}
+
+// poll fetches all unseen messages, forwards those from allowed senders and marks them read.
+func (ec *emailChannel) poll(hub *chat.Hub) error {
+	c, err := dialIMAP(ec.cfg.IMAPHost, ec.cfg.IMAPPort, ec.cfg.InsecureIMAP)
+	if err != nil {
+		return err
+	}
+	defer c.logout()
+	if err := c.login(ec.cfg.Username, ec.cfg.Password); err != nil {
+		return err
+	}
+	if err := c.selectMailbox(ec.cfg.Mailbox); err != nil {
+		return err
+	}
+	uids, err := c.searchUnseen()
+	if err != nil {
+		return err
+	}
+	for _, uid := range uids {
+		if ec.ignored[uid] {
+			continue
+		}
+		raw, err := c.fetchRaw(uid)
+		if err != nil {
+			log.Printf("email: fetch %d failed: %v", uid, err)
+			continue
+		}
+		in, ok := ec.parse(raw)
+		if !ok {
+			// leave unauthorized mail unread for the human, but don't fetch it again
+			ec.ignored[uid] = true
+			continue
+		}
+		if err := c.markSeen(uid); err != nil {
+			log.Printf("email: failed to mark %d as seen: %v", uid, err)
+		}
+		hub.In <- in
+	}
+	return nil
+}
+
+// parse turns a raw message into an Inbound and records its thread for replies.
+// It returns false for senders that aren't allowed.
+func (ec *emailChannel) parse(raw []byte) (chat.Inbound, bool) {
+	msg, err := mail.ReadMessage(bytes.NewReader(raw))
+	if err != nil {
+		log.Printf("email: unparsable message: %v", err)
+		return chat.Inbound{}, false
+	}
+	from, err := mail.ParseAddress(msg.Header.Get("From"))
+	if err != nil {
+		log.Printf("email: invalid From header %q", msg.Header.Get("From"))
+		return chat.Inbound{}, false
+	}
+	sender := strings.ToLower(from.Address)
+	if len(ec.allowed) > 0 {
+		if _, ok := ec.allowed[sender]; !ok {
+			log.Printf("email: ignoring message from unauthorized sender %s", sender)
+			return chat.Inbound{}, false
+		}
+	}
+
+	dec := new(mime.WordDecoder)
+	subject, err := dec.DecodeHeader(msg.Header.Get("Subject"))
+	if err != nil {
+		subject = msg.Header.Get("Subject")
+	}
+	messageID := strings.TrimSpace(msg.Header.Get("Message-Id"))
+	references := strings.TrimSpace(msg.Header.Get("References"))
+
+	// The thread root is the first reference, else the message being replied to, else this message.
+	root := messageID
+	if refs := strings.Fields(references); len(refs) > 0 {
+		root = refs[0]
+	} else if irt := strings.TrimSpace(msg.Header.Get("In-Reply-To")); irt != "" {
+		root = irt
+	}
+	if root == "" {
+		root = sender + "|" + subject
+	}
+	sum := sha1.Sum([]byte(root))
+	chatID := hex.EncodeToString(sum[:8])
+
+	replyTo := from.Address
+	if rt, err := mail.ParseAddress(msg.Header.Get("Reply-To")); err == nil {
+		replyTo = rt.Address
+	}
+	ec.mu.Lock()
+	ec.threads[chatID] = emailThread{To: replyTo, Subject: subject, MessageID: messageID, References: references}
+	b, err := json.Marshal(ec.threads)
+	if err == nil {
+		err = os.WriteFile(ec.threadsFile, b, 0o600)
+	}
+	ec.mu.Unlock()
+	if err != nil {
+		log.Printf("email: failed to persist threads: %v", err)
+	}
+
+	text, html, attachments := walkMIME(mailHeader(msg.Header), msg.Body)
+	if strings.TrimSpace(text) == "" && html != "" {
+		if t, err := html2text.FromString(html, html2text.Options{PrettyTables: true}); err == nil {
+			text = t
+		}
+	}
+
+	var media []string
+	for i, a := range attachments {
+		path, err := ec.saveAttachment(messageID, i, a)
+		if err != nil {
+			log.Printf("email: failed to save attachment %s: %v", a.name, err)
+			continue
+		}
+		media = append(media, path)
+	}
+
+	content := fmt.Sprintf("Subject: %s\n\n%s", subject, strings.TrimSpace(text))
+	for _, p := range media {
+		content += "\n\n[attachment saved: " + p + "]"
+	}
+
+	return chat.Inbound{
+		Channel:   "email",
+		SenderID:  sender,
+		ChatID:    chatID,
+		Content:   content,
+		Timestamp: time.Now(),
+		Media:     media,
+		Metadata:  map[string]interface{}{"subject": subject, "message_id": messageID},
+	}, true
+}
+
+type emailAttachment struct {
+	name string
+	data []byte
+}
+
+// mailHeader adapts mail.Header to the MIME header map used by multipart parts.
+func mailHeader(h mail.Header) map[string][]string { return h }
+
+// walkMIME collects the text and HTML bodies and any attachments of a message part, recursively.
+func walkMIME(header map[string][]string, body io.Reader) (text, html string, attachments []emailAttachment) {
+	get := func(k string) string {
+		if v := header[k]; len(v) > 0 {
+			return v[0]
+		}
+		return ""
+	}
+	mediaType, params, err := mime.ParseMediaType(get("Content-Type"))
+	if err != nil {
+		mediaType = "text/plain"
+	}
+
+	if strings.HasPrefix(mediaType, "multipart/") {
+		mr := multipart.NewReader(body, params["boundary"])
+		for {
+			part, err := mr.NextPart()
+			if err != nil {
+				break
+			}
+			t, h, a := walkMIME(part.Header, part)
+			text += t
+			if html == "" {
+				html = h
+			}
+			attachments = append(attachments, a...)
+		}
+		return text, html, attachments
+	}
+
+	data, err := io.ReadAll(decodeTransfer(get("Content-Transfer-Encoding"), body))
+	if err != nil {
+		return "", "", nil
+	}
+	disposition, dparams, _ := mime.ParseMediaType(get("Content-Disposition"))
+	filename := dparams["filename"]
+	if filename == "" {
+		filename = params["name"]
+	}
+	if disposition == "attachment" || (filename != "" && !strings.HasPrefix(mediaType, "text/")) {
+		if filename == "" {
+			filename = "attachment"
+		}
+		return "", "", []emailAttachment{{name: filename, data: data}}
+	}
+	switch mediaType {
+	case "text/plain":
+		return toUTF8(data, params["charset"]), "", nil
+	case "text/html":
+		return "", toUTF8(data, params["charset"]), nil
+	}
+	return "", "", nil
+}
+
+func decodeTransfer(encoding string, r io.Reader) io.Reader {
+	switch strings.ToLower(strings.TrimSpace(encoding)) {
+	case "base64":
+		return base64.NewDecoder(base64.StdEncoding, r)
+	case "quoted-printable":
+		return quotedprintable.NewReader(r)
+	}
+	return r
+}
+
+// toUTF8 converts Latin-1 style bodies to UTF-8; other charsets are passed through.
+func toUTF8(b []byte, charset string) string {
+	switch strings.ToLower(charset) {
+	case "iso-8859-1", "latin1", "windows-1252", "us-ascii":
+		if utf8.Valid(b) {
+			return string(b)
+		}
+		runes := make([]rune, len(b))
+		for i, c := range b {
+			runes[i] = rune(c)
+		}
+		return string(runes)
+	}
+	return string(b)
+}
+
+// saveAttachment writes the index-th attachment of a message to the media
+// dir. The index keeps attachments with the same name apart.
+func (ec *emailChannel) saveAttachment(messageID string, index int, a emailAttachment) (string, error) {
+	if err := os.MkdirAll(ec.mediaDir, 0o755); err != nil {
+		return "", err
+	}
+	sum := sha1.Sum([]byte(messageID))
+	name := filepath.Base(a.name)
+	path := filepath.Join(ec.mediaDir, fmt.Sprintf("%s-%d-%s", hex.EncodeToString(sum[:4]), index+1, name))
+	return path, os.WriteFile(path, a.data, 0o644)
+}
+
+// send replies to the thread identified by out.ChatID. A ChatID containing "@"
+// is treated as a recipient address and starts a new thread.
+func (ec *emailChannel) send(out chat.Outbound) error {
+	ec.mu.Lock()
+	th, ok := ec.threads[out.ChatID]
+	ec.mu.Unlock()
+	if !ok {
+		if !strings.Contains(out.ChatID, "@") {
+			return fmt.Errorf("unknown email thread %s", out.ChatID)
+		}
+		th = emailThread{To: out.ChatID, Subject: "Message from picobot"}
+	}
+	subject := th.Subject
+	if subject == "" {
+		subject = "(no subject)"
+	}
+	if th.MessageID != "" && !strings.HasPrefix(strings.ToLower(subject), "re:") {
+		subject = "Re: " + subject
+	}
+
+	domain := "picobot.local"
+	if at := strings.LastIndex(ec.from, "@"); at != -1 {
+		domain = ec.from[at+1:]
+	}
+	var hdr strings.Builder
+	fmt.Fprintf(&hdr, "From: %s\r\n", ec.from)
+	fmt.Fprintf(&hdr, "To: %s\r\n", th.To)
+	fmt.Fprintf(&hdr, "Subject: %s\r\n", mime.QEncoding.Encode("utf-8", subject))
+	fmt.Fprintf(&hdr, "Date: %s\r\n", time.Now().Format(time.RFC1123Z))
+	fmt.Fprintf(&hdr, "Message-ID: <%s@%s>\r\n", randomID(), domain)
+	if th.MessageID != "" {
+		fmt.Fprintf(&hdr, "In-Reply-To: %s\r\n", th.MessageID)
+		fmt.Fprintf(&hdr, "References: %s\r\n", strings.TrimSpace(th.References+" "+th.MessageID))
+	}
+	hdr.WriteString("MIME-Version: 1.0\r\n")
+	hdr.WriteString("Content-Type: text/plain; charset=utf-8\r\n")
+	hdr.WriteString("Content-Transfer-Encoding: quoted-printable\r\n\r\n")
+
+	var body bytes.Buffer
+	qp := quotedprintable.NewWriter(&body)
+	qp.Write([]byte(out.Content))
+	qp.Close()
+
+	return ec.sendMail(th.To, append([]byte(hdr.String()), body.Bytes()...))
+}
+
+// sendMail delivers msg via SMTP, using implicit TLS on port 465 and STARTTLS elsewhere when offered.
+func (ec *emailChannel) sendMail(to string, msg []byte) error {
+	addr := net.JoinHostPort(ec.cfg.SMTPHost, strconv.Itoa(ec.cfg.SMTPPort))
+	auth := smtp.PlainAuth("", ec.cfg.Username, ec.cfg.Password, ec.cfg.SMTPHost)
+	if ec.cfg.SMTPPort != 465 {
+		return smtp.SendMail(addr, auth, ec.from, []string{to}, msg)
+	}
+
+	conn, err := tls.Dial("tcp", addr, &tls.Config{ServerName: ec.cfg.SMTPHost})
+	if err != nil {
+		return err
+	}
+	c, err := smtp.NewClient(conn, ec.cfg.SMTPHost)
+	if err != nil {
+		conn.Close()
+		return err
+	}
+	defer c.Close()
+	if err := c.Auth(auth); err != nil {
+		return err
+	}
+	if err := c.Mail(ec.from); err != nil {
+		return err
+	}
+	if err := c.Rcpt(to); err != nil {
+		return err
+	}
+	w, err := c.Data()
+	if err != nil {
+		return err
+	}
+	if _, err := w.Write(msg); err != nil {
+		return err
+	}
+	if err := w.Close(); err != nil {
+		return err
+	}
+	return c.Quit()
+}
@@ -0,0 +1,454 @@
+package channels
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/hex"
+	"encoding/json"
+	"expvar"
+	"fmt"
+	"log"
+	"net"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/local/picobot/internal/chat"
+	"github.com/local/picobot/internal/config"
+)
+
+// httpTurnTimeout bounds how long a request waits for the agent's final reply.
+const httpTurnTimeout = 5 * time.Minute
+
+// replyRouter hands outbound messages for a chat ID to whoever is waiting on
+// that chat. Turns on the same chat are serialized so replies can't interleave.
+type replyRouter struct {
+	mu      sync.Mutex
+	waiters map[string]*replyWaiter
+	locks   map[string]*chatLock
+}
+
+// chatLock serializes the turns of one chat. It is dropped from the router
+// once no turn holds or waits for it, so unique session names don't pile up.
+type chatLock struct {
+	sync.Mutex
+	refs int
+}
+
+// replyWaiter is the turn currently waiting for replies on a chat.
+type replyWaiter struct {
+	turn string
+	ch   chan chat.Outbound
+}
+
+func newReplyRouter() *replyRouter {
+	return &replyRouter{waiters: make(map[string]*replyWaiter), locks: make(map[string]*chatLock)}
+}
+
+// acquire locks chatID for the turn with the given ID and returns the channel
+// its replies arrive on. The returned release func must be called when the
+// turn is over.
+func (r *replyRouter) acquire(chatID, turn string) (<-chan chat.Outbound, func()) {
+	r.mu.Lock()
+	l, ok := r.locks[chatID]
+	if !ok {
+		l = &chatLock{}
+		r.locks[chatID] = l
+	}
+	l.refs++
+	r.mu.Unlock()
+
+	l.Lock()
+	w := &replyWaiter{turn: turn, ch: make(chan chat.Outbound, 16)}
+	r.mu.Lock()
+	r.waiters[chatID] = w
+	r.mu.Unlock()
+	return w.ch, func() {
+		r.mu.Lock()
+		delete(r.waiters, chatID)
+		if l.refs--; l.refs == 0 {
+			delete(r.locks, chatID)
+		}
+		r.mu.Unlock()
+		l.Unlock()
+	}
+}
+
+// deliver routes msg to the waiter for its chat. Replies the agent marked with
+// another turn's ID belong to an abandoned request and are not delivered;
+// unmarked ones (e.g. from the message tool) go to the current turn. Returns
+// false if the message was not delivered.
+func (r *replyRouter) deliver(msg chat.Outbound) bool {
+	r.mu.Lock()
+	w, ok := r.waiters[msg.ChatID]
+	r.mu.Unlock()
+	if !ok {
+		return false
+	}
+	if turn, ok := msg.Metadata[chat.MetaTurn].(string); ok && turn != w.turn {
+		return false
+	}
+	select {
+	case w.ch <- msg:
+		return true
+	default:
+		return false
+	}
+}
+
+// isFinal reports whether msg is the agent's last reply for the current turn.
+func isFinal(msg chat.Outbound) bool {
+	final, _ := msg.Metadata[chat.MetaFinal].(bool)
+	return final
+}
+
+// isThrottled reports whether msg is the rate limiter's refusal rather than an answer.
+func isThrottled(msg chat.Outbound) bool {
+	throttled, _ := msg.Metadata[chat.MetaThrottled].(bool)
+	return throttled
+}
+
+// writeThrottled answers a refused turn with 429.
+func writeThrottled(w http.ResponseWriter, reason string) {
+	w.Header().Set("Retry-After", "60")
+	writeJSONError(w, http.StatusTooManyRequests, reason)
+}
+
+// StartHTTP serves a small REST API and an OpenAI-compatible chat completions
+// endpoint on cfg.Listen. Every request must carry "Authorization: Bearer <cfg.Token>".
+// Session names are cleaned like the web channel's, since they name the
+// session files.
+//
+//	POST /api/messages          {"session": "...", "message": "..."}
+//	POST /v1/chat/completions   OpenAI request body, "stream": true supported
+//	GET  /v1/models
+//	GET  /debug/vars            expvar counters, e.g. rate limiting
+//
+// Messages are routed through the hub like any other channel, so the agent
+// keeps its memory, skills and per-session history.
+func StartHTTP(ctx context.Context, hub *chat.Hub, cfg config.HTTPConfig) error {
+	if cfg.Token == "" {
+		return fmt.Errorf("http token not provided")
+	}
+	listen := cfg.Listen
+	if listen == "" {
+		listen = "127.0.0.1:8088"
+	}
+
+	router := newReplyRouter()
+	go func() {
+		for {
+			select {
+			case <-ctx.Done():
+				log.Println("http: stopping outbound dispatcher")
+				return
+			case out := <-hub.HTTPOut:
+				if !router.deliver(out) {
+					log.Printf("http: no pending request for this turn of session %s, dropping message", out.ChatID)
+				}
+			}
+		}
+	}()
+
+	h := &httpChannel{hub: hub, router: router}
+	mux := http.NewServeMux()
+	mux.HandleFunc("POST /api/messages", h.handleMessage)
+	mux.HandleFunc("POST /v1/chat/completions", h.handleChatCompletions)
+	mux.HandleFunc("GET /v1/models", h.handleModels)
+	mux.Handle("GET /debug/vars", expvar.Handler())
+
+	srv := &http.Server{Addr: listen, Handler: requireBearer(cfg.Token, mux)}
+	if err := serve(ctx, "http", srv); err != nil {
+		return err
+	}
+
+	log.Printf("http channel listening on %s", listen)
+	return nil
+}
+
+// requireBearer rejects requests that don't present the expected bearer token.
+func requireBearer(token string, next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		got, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+		if !ok || subtle.ConstantTimeCompare([]byte(got), []byte(token)) != 1 {
+			writeJSONError(w, http.StatusUnauthorized, "invalid or missing bearer token")
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+type httpChannel struct {
+	hub    *chat.Hub
+	router *replyRouter
+}
+
+// turn submits content for chatID and calls onReply for every outbound message
+// until the final reply arrives, the request is cancelled or httpTurnTimeout
+// passes.
+func (h *httpChannel) turn(ctx context.Context, chatID, content string, onReply func(chat.Outbound)) error {
+	ctx, cancel := context.WithTimeout(ctx, httpTurnTimeout)
+	defer cancel()
+	turn := randomID()
+	replies, release := h.router.acquire(chatID, turn)
+	defer release()
+
+	select {
+	case h.hub.In <- chat.Inbound{
+		Channel:   "http",
+		SenderID:  "api",
+		ChatID:    chatID,
+		Content:   content,
+		Timestamp: time.Now(),
+		Metadata:  map[string]interface{}{chat.MetaTurn: turn},
+	}:
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+
+	for {
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case out := <-replies:
+			onReply(out)
+			if isFinal(out) {
+				return nil
+			}
+		}
+	}
+}
+
+func (h *httpChannel) handleMessage(w http.ResponseWriter, r *http.Request) {
+	var req struct {
+		Session string `json:"session"`
+		Message string `json:"message"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeJSONError(w, http.StatusBadRequest, "invalid JSON body")
+		return
+	}
+	if strings.TrimSpace(req.Message) == "" {
+		writeJSONError(w, http.StatusBadRequest, "'message' is required")
+		return
+	}
+	req.Session = sanitizeSessionName(req.Session)
+
+	var reply string
+	throttled := false
+	messages := []string{}
+	err := h.turn(r.Context(), req.Session, req.Message, func(out chat.Outbound) {
+		if isFinal(out) {
+			reply = out.Content
+			throttled = isThrottled(out)
+		} else {
+			messages = append(messages, out.Content)
+		}
+	})
+	if err != nil {
+		writeJSONError(w, http.StatusGatewayTimeout, err.Error())
+		return
+	}
+	if throttled {
+		writeThrottled(w, reply)
+		return
+	}
+	writeJSON(w, http.StatusOK, map[string]interface{}{
+		"session":  req.Session,
+		"reply":    reply,
+		"messages": messages,
+	})
+}
+
+type openAIChatRequest struct {
+	Model    string `json:"model"`
+	Messages []struct {
+		Role    string          `json:"role"`
+		Content json.RawMessage `json:"content"`
+	} `json:"messages"`
+	Stream bool   `json:"stream"`
+	User   string `json:"user"`
+}
+
+// lastUserMessage extracts the text of the most recent user message. Content
+// may be a plain string or a list of {"type": "text", "text": ...} parts.
+func (req *openAIChatRequest) lastUserMessage() string {
+	for i := len(req.Messages) - 1; i >= 0; i-- {
+		m := req.Messages[i]
+		if m.Role != "user" {
+			continue
+		}
+		var s string
+		if err := json.Unmarshal(m.Content, &s); err == nil {
+			return s
+		}
+		var parts []struct {
+			Type string `json:"type"`
+			Text string `json:"text"`
+		}
+		if err := json.Unmarshal(m.Content, &parts); err == nil {
+			var sb strings.Builder
+			for _, p := range parts {
+				if p.Type == "text" {
+					sb.WriteString(p.Text)
+				}
+			}
+			return sb.String()
+		}
+	}
+	return ""
+}
+
+// handleChatCompletions implements the OpenAI chat completions API on top of the
+// agent. Only the latest user message is forwarded; earlier turns come from the
+// agent's own session history, keyed by the "user" field or X-Session-Id header.
+func (h *httpChannel) handleChatCompletions(w http.ResponseWriter, r *http.Request) {
+	var req openAIChatRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeJSONError(w, http.StatusBadRequest, "invalid JSON body")
+		return
+	}
+	content := req.lastUserMessage()
+	if strings.TrimSpace(content) == "" {
+		writeJSONError(w, http.StatusBadRequest, "no user message found")
+		return
+	}
+	session := r.Header.Get("X-Session-Id")
+	if session == "" {
+		session = req.User
+	}
+	session = sanitizeSessionName(session)
+	model := req.Model
+	if model == "" {
+		model = "picobot"
+	}
+	id := "chatcmpl-" + randomID()
+	created := time.Now().Unix()
+
+	if !req.Stream {
+		var parts []string
+		throttled := ""
+		err := h.turn(r.Context(), session, content, func(out chat.Outbound) {
+			if isThrottled(out) {
+				throttled = out.Content
+				return
+			}
+			parts = append(parts, out.Content)
+		})
+		if err != nil {
+			writeJSONError(w, http.StatusGatewayTimeout, err.Error())
+			return
+		}
+		if throttled != "" {
+			writeThrottled(w, throttled)
+			return
+		}
+		writeJSON(w, http.StatusOK, map[string]interface{}{
+			"id":      id,
+			"object":  "chat.completion",
+			"created": created,
+			"model":   model,
+			"choices": []map[string]interface{}{{
+				"index":         0,
+				"message":       map[string]string{"role": "assistant", "content": strings.Join(parts, "\n\n")},
+				"finish_reason": "stop",
+			}},
+		})
+		return
+	}
+
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		writeJSONError(w, http.StatusInternalServerError, "streaming not supported")
+		return
+	}
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("Connection", "keep-alive")
+
+	sendChunk := func(delta map[string]string, finish interface{}) {
+		b, _ := json.Marshal(map[string]interface{}{
+			"id":      id,
+			"object":  "chat.completion.chunk",
+			"created": created,
+			"model":   model,
+			"choices": []map[string]interface{}{{"index": 0, "delta": delta, "finish_reason": finish}},
+		})
+		fmt.Fprintf(w, "data: %s\n\n", b)
+		flusher.Flush()
+	}
+
+	// Each message the agent produces (intermediate message-tool sends and the
+	// final reply) is streamed as soon as it is available.
+	sendChunk(map[string]string{"role": "assistant"}, nil)
+	first := true
+	err := h.turn(r.Context(), session, content, func(out chat.Outbound) {
+		text := out.Content
+		if !first {
+			text = "\n\n" + text
+		}
+		first = false
+		sendChunk(map[string]string{"content": text}, nil)
+	})
+	if err != nil {
+		log.Printf("http: stream for session %s ended early: %v", session, err)
+		return
+	}
+	sendChunk(map[string]string{}, "stop")
+	fmt.Fprint(w, "data: [DONE]\n\n")
+	flusher.Flush()
+}
+
+func (h *httpChannel) handleModels(w http.ResponseWriter, r *http.Request) {
+	writeJSON(w, http.StatusOK, map[string]interface{}{
+		"object": "list",
+		"data": []map[string]interface{}{{
+			"id":       "picobot",
+			"object":   "model",
+			"owned_by": "picobot",
+		}},
+	})
+}
+
+// serve binds srv's address and serves it until ctx is done. Binding happens
+// before serve returns, so a busy address is reported to the caller instead
+// of only being logged.
+func serve(ctx context.Context, name string, srv *http.Server) error {
+	ln, err := net.Listen("tcp", srv.Addr)
+	if err != nil {
+		return err
+	}
+	go func() {
+		<-ctx.Done()
+		shutdownCtx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		srv.Shutdown(shutdownCtx)
+	}()
+	go func() {
+		if err := srv.Serve(ln); err != nil && err != http.ErrServerClosed {
+			log.Printf("%s: server error: %v", name, err)
+		}
+	}()
+	return nil
+}
+
+func writeJSON(w http.ResponseWriter, status int, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(v)
+}
+
+// writeJSONError writes an error in the OpenAI error envelope so API clients can parse it.
+func writeJSONError(w http.ResponseWriter, status int, msg string) {
+	writeJSON(w, status, map[string]interface{}{
+		"error": map[string]string{"message": msg, "type": http.StatusText(status)},
+	})
+}
+
+func randomID() string {
+	b := make([]byte, 12)
+	rand.Read(b)
+	return hex.EncodeToString(b)
+}
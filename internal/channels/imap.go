@@ -0,0 +1,211 @@
+package channels
+
+import (
+	"bufio"
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// imapConn is a minimal IMAP4rev1 client covering what the email channel
+// needs: LOGIN, SELECT, UID SEARCH, UID FETCH, UID STORE and LOGOUT.
+type imapConn struct {
+	conn net.Conn
+	r    *bufio.Reader
+	tag  int
+}
+
+// dialIMAP connects to host:port, using implicit TLS on port 993 and
+// STARTTLS on other ports. A server that doesn't offer STARTTLS is refused,
+// so credentials never cross the network in cleartext, unless insecure is set.
+func dialIMAP(host string, port int, insecure bool) (*imapConn, error) {
+	addr := net.JoinHostPort(host, strconv.Itoa(port))
+	dialer := &net.Dialer{Timeout: 30 * time.Second}
+	var conn net.Conn
+	var err error
+	if port == 993 {
+		conn, err = tls.DialWithDialer(dialer, "tcp", addr, &tls.Config{ServerName: host})
+	} else {
+		conn, err = dialer.Dial("tcp", addr)
+	}
+	if err != nil {
+		return nil, err
+	}
+	c := &imapConn{conn: conn, r: bufio.NewReader(conn)}
+	conn.SetDeadline(time.Now().Add(time.Minute))
+	greeting, _, err := c.readLine()
+	if err != nil {
+		conn.Close()
+		return nil, err
+	}
+	if !strings.HasPrefix(greeting, "* OK") && !strings.HasPrefix(greeting, "* PREAUTH") {
+		conn.Close()
+		return nil, fmt.Errorf("imap: unexpected greeting %q", greeting)
+	}
+	if port == 993 {
+		return c, nil
+	}
+	if err := c.startTLS(host); err != nil {
+		if !insecure || err != errIMAPNoStartTLS {
+			conn.Close()
+			return nil, err
+		}
+	}
+	return c, nil
+}
+
+var errIMAPNoStartTLS = errors.New("imap: server does not offer STARTTLS; set insecureIMAP to log in without TLS")
+
+// startTLS upgrades the connection when the server advertises STARTTLS.
+func (c *imapConn) startTLS(host string) error {
+	lines, _, err := c.cmd("CAPABILITY")
+	if err != nil {
+		return err
+	}
+	offered := false
+	for _, l := range lines {
+		if rest, ok := strings.CutPrefix(l, "* CAPABILITY "); ok {
+			for _, capability := range strings.Fields(rest) {
+				offered = offered || strings.EqualFold(capability, "STARTTLS")
+			}
+		}
+	}
+	if !offered {
+		return errIMAPNoStartTLS
+	}
+	if _, _, err := c.cmd("STARTTLS"); err != nil {
+		return err
+	}
+	tlsConn := tls.Client(c.conn, &tls.Config{ServerName: host})
+	tlsConn.SetDeadline(time.Now().Add(time.Minute))
+	if err := tlsConn.Handshake(); err != nil {
+		return err
+	}
+	c.conn = tlsConn
+	c.r = bufio.NewReader(tlsConn)
+	return nil
+}
+
+// readLine reads one response line, inlining any {n} literals it announces.
+// Literal contents are returned separately, in order.
+func (c *imapConn) readLine() (string, [][]byte, error) {
+	var sb strings.Builder
+	var literals [][]byte
+	for {
+		line, err := c.r.ReadString('\n')
+		if err != nil {
+			return "", nil, err
+		}
+		line = strings.TrimRight(line, "\r\n")
+		sb.WriteString(line)
+		// a line ending in {n} is followed by exactly n bytes of literal data
+		if !strings.HasSuffix(line, "}") {
+			return sb.String(), literals, nil
+		}
+		open := strings.LastIndex(line, "{")
+		if open == -1 {
+			return sb.String(), literals, nil
+		}
+		n, err := strconv.Atoi(line[open+1 : len(line)-1])
+		if err != nil {
+			return sb.String(), literals, nil
+		}
+		lit := make([]byte, n)
+		if _, err := io.ReadFull(c.r, lit); err != nil {
+			return "", nil, err
+		}
+		literals = append(literals, lit)
+	}
+}
+
+// cmd sends a tagged command and collects untagged lines and literals until
+// the tagged completion. A NO or BAD completion is returned as an error.
+func (c *imapConn) cmd(format string, args ...interface{}) ([]string, [][]byte, error) {
+	c.tag++
+	tag := fmt.Sprintf("a%d", c.tag)
+	c.conn.SetDeadline(time.Now().Add(2 * time.Minute))
+	if _, err := fmt.Fprintf(c.conn, "%s %s\r\n", tag, fmt.Sprintf(format, args...)); err != nil {
+		return nil, nil, err
+	}
+	var lines []string
+	var literals [][]byte
+	for {
+		line, lits, err := c.readLine()
+		if err != nil {
+			return nil, nil, err
+		}
+		literals = append(literals, lits...)
+		if rest, ok := strings.CutPrefix(line, tag+" "); ok {
+			if !strings.HasPrefix(rest, "OK") {
+				return lines, literals, fmt.Errorf("imap: %s", rest)
+			}
+			return lines, literals, nil
+		}
+		lines = append(lines, line)
+	}
+}
+
+// imapQuote renders s as an IMAP quoted string.
+func imapQuote(s string) string {
+	s = strings.ReplaceAll(s, `\`, `\\`)
+	s = strings.ReplaceAll(s, `"`, `\"`)
+	return `"` + s + `"`
+}
+
+func (c *imapConn) login(user, pass string) error {
+	_, _, err := c.cmd("LOGIN %s %s", imapQuote(user), imapQuote(pass))
+	return err
+}
+
+func (c *imapConn) selectMailbox(name string) error {
+	_, _, err := c.cmd("SELECT %s", imapQuote(name))
+	return err
+}
+
+// searchUnseen returns the UIDs of all messages without the \Seen flag.
+func (c *imapConn) searchUnseen() ([]uint32, error) {
+	lines, _, err := c.cmd("UID SEARCH UNSEEN")
+	if err != nil {
+		return nil, err
+	}
+	var uids []uint32
+	for _, l := range lines {
+		rest, ok := strings.CutPrefix(l, "* SEARCH")
+		if !ok {
+			continue
+		}
+		for _, f := range strings.Fields(rest) {
+			if n, err := strconv.ParseUint(f, 10, 32); err == nil {
+				uids = append(uids, uint32(n))
+			}
+		}
+	}
+	return uids, nil
+}
+
+// fetchRaw returns the full RFC 822 message without setting \Seen.
+func (c *imapConn) fetchRaw(uid uint32) ([]byte, error) {
+	_, literals, err := c.cmd("UID FETCH %d BODY.PEEK[]", uid)
+	if err != nil {
+		return nil, err
+	}
+	if len(literals) == 0 {
+		return nil, fmt.Errorf("imap: message %d has no body", uid)
+	}
+	return literals[0], nil
+}
+
+func (c *imapConn) markSeen(uid uint32) error {
+	_, _, err := c.cmd(`UID STORE %d +FLAGS.SILENT (\Seen)`, uid)
+	return err
+}
+
+func (c *imapConn) logout() {
+	c.cmd("LOGOUT")
+	c.conn.Close()
+}
@@ -0,0 +1,160 @@
+package channels
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"os"
+	"reflect"
+	"sync"
+	"time"
+
+	"github.com/local/picobot/internal/chat"
+	"github.com/local/picobot/internal/config"
+	"github.com/local/picobot/internal/cron"
+)
+
+// restartDelay gives a stopped channel time to close its connections and
+// listeners before it is started again with a new config.
+const restartDelay = time.Second
+
+// channelSpec describes how to run one channel from the channels config.
+type channelSpec struct {
+	name    string
+	enabled func(config.ChannelsConfig) bool
+	section func(config.ChannelsConfig) interface{}
+	start   func(ctx context.Context, m *Manager, cfg config.ChannelsConfig) error
+}
+
+var channelSpecs = []channelSpec{
+	{"telegram",
+		func(c config.ChannelsConfig) bool { return c.Telegram.Enabled },
+		func(c config.ChannelsConfig) interface{} { return c.Telegram },
+		func(ctx context.Context, m *Manager, c config.ChannelsConfig) error {
+			return StartTelegram(ctx, m.hub, c.Telegram)
+		}},
+	{"ntfy",
+		func(c config.ChannelsConfig) bool { return c.Ntfy.Enabled },
+		func(c config.ChannelsConfig) interface{} { return c.Ntfy },
+		func(ctx context.Context, m *Manager, c config.ChannelsConfig) error {
+			return StartNtfy(ctx, m.hub, c.Ntfy)
+		}},
+	{"http",
+		func(c config.ChannelsConfig) bool { return c.HTTP.Enabled },
+		func(c config.ChannelsConfig) interface{} { return c.HTTP },
+		func(ctx context.Context, m *Manager, c config.ChannelsConfig) error {
+			return StartHTTP(ctx, m.hub, c.HTTP)
+		}},
+	{"web ui",
+		func(c config.ChannelsConfig) bool { return c.Web.Enabled },
+		func(c config.ChannelsConfig) interface{} { return c.Web },
+		func(ctx context.Context, m *Manager, c config.ChannelsConfig) error {
+			return StartWeb(ctx, m.hub, c.Web, m.workspace, m.scheduler)
+		}},
+	{"matrix",
+		func(c config.ChannelsConfig) bool { return c.Matrix.Enabled },
+		func(c config.ChannelsConfig) interface{} { return c.Matrix },
+		func(ctx context.Context, m *Manager, c config.ChannelsConfig) error {
+			return StartMatrix(ctx, m.hub, c.Matrix, m.workspace)
+		}},
+	{"email",
+		func(c config.ChannelsConfig) bool { return c.Email.Enabled },
+		func(c config.ChannelsConfig) interface{} { return c.Email },
+		func(ctx context.Context, m *Manager, c config.ChannelsConfig) error {
+			return StartEmail(ctx, m.hub, c.Email, m.workspace)
+		}},
+	{"slack",
+		func(c config.ChannelsConfig) bool { return c.Slack.Enabled },
+		func(c config.ChannelsConfig) interface{} { return c.Slack },
+		func(ctx context.Context, m *Manager, c config.ChannelsConfig) error {
+			return StartSlack(ctx, m.hub, c.Slack)
+		}},
+	{"signal",
+		func(c config.ChannelsConfig) bool { return c.Signal.Enabled },
+		func(c config.ChannelsConfig) interface{} { return c.Signal },
+		func(ctx context.Context, m *Manager, c config.ChannelsConfig) error {
+			return StartSignal(ctx, m.hub, c.Signal, m.workspace)
+		}},
+	{"webhooks",
+		func(c config.ChannelsConfig) bool { return c.Webhooks.Enabled },
+		func(c config.ChannelsConfig) interface{} { return c.Webhooks },
+		func(ctx context.Context, m *Manager, c config.ChannelsConfig) error {
+			return StartWebhooks(ctx, m.hub, c.Webhooks)
+		}},
+	{"mqtt",
+		func(c config.ChannelsConfig) bool { return c.MQTT.Enabled },
+		func(c config.ChannelsConfig) interface{} { return c.MQTT },
+		func(ctx context.Context, m *Manager, c config.ChannelsConfig) error {
+			return StartMQTT(ctx, m.hub, c.MQTT)
+		}},
+}
+
+// running is a started channel and the config section it was started with.
+type running struct {
+	section interface{}
+	cancel  context.CancelFunc
+}
+
+// Manager runs the enabled channels and applies config changes to them:
+// a channel whose section changed is restarted with the new settings, and
+// channels are started or stopped as they are enabled or disabled.
+type Manager struct {
+	ctx       context.Context
+	hub       *chat.Hub
+	workspace string
+	scheduler *cron.Scheduler
+
+	mu      sync.Mutex
+	running map[string]*running
+}
+
+// NewManager returns a manager whose channels run until ctx is canceled.
+// scheduler may be nil.
+func NewManager(ctx context.Context, hub *chat.Hub, workspace string, scheduler *cron.Scheduler) *Manager {
+	return &Manager{ctx: ctx, hub: hub, workspace: workspace, scheduler: scheduler, running: make(map[string]*running)}
+}
+
+// Apply brings the running channels in line with cfg. A channel that fails
+// to start is reported and left stopped; the next Apply tries it again.
+func (m *Manager) Apply(cfg config.ChannelsConfig) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	var restarting bool
+	for _, spec := range channelSpecs {
+		r, ok := m.running[spec.name]
+		if !ok {
+			continue
+		}
+		if spec.enabled(cfg) && reflect.DeepEqual(spec.section(cfg), r.section) {
+			continue
+		}
+		if spec.enabled(cfg) {
+			log.Printf("channels: restarting %s with new settings", spec.name)
+			restarting = true
+		} else {
+			log.Printf("channels: stopping %s", spec.name)
+		}
+		r.cancel()
+		delete(m.running, spec.name)
+	}
+	if restarting {
+		time.Sleep(restartDelay)
+	}
+
+	for _, spec := range channelSpecs {
+		if !spec.enabled(cfg) {
+			continue
+		}
+		if _, ok := m.running[spec.name]; ok {
+			continue
+		}
+		ctx, cancel := context.WithCancel(m.ctx)
+		if err := spec.start(ctx, m, cfg); err != nil {
+			cancel()
+			fmt.Fprintf(os.Stderr, "failed to start %s: %v\n", spec.name, err)
+			continue
+		}
+		m.running[spec.name] = &running{section: spec.section(cfg), cancel: cancel}
+	}
+}
@@ -0,0 +1,358 @@
+package channels
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/local/picobot/internal/chat"
+	"github.com/local/picobot/internal/config"
+)
+
+// matrixMaxMedia caps the size of a downloaded attachment.
+const matrixMaxMedia = 50 << 20
+
+// matrixEvent is the subset of a Matrix room event picobot cares about.
+type matrixEvent struct {
+	Type    string `json:"type"`
+	EventID string `json:"event_id"`
+	Sender  string `json:"sender"`
+	Content struct {
+		MsgType   string `json:"msgtype"`
+		Body      string `json:"body"`
+		URL       string `json:"url"`
+		RelatesTo *struct {
+			RelType string `json:"rel_type"`
+			EventID string `json:"event_id"`
+		} `json:"m.relates_to"`
+	} `json:"content"`
+}
+
+type matrixSyncResponse struct {
+	NextBatch string `json:"next_batch"`
+	Rooms     struct {
+		Join map[string]struct {
+			Timeline struct {
+				Events []matrixEvent `json:"events"`
+			} `json:"timeline"`
+		} `json:"join"`
+		Invite map[string]json.RawMessage `json:"invite"`
+	} `json:"rooms"`
+}
+
+type matrixChannel struct {
+	base      string
+	token     string
+	userID    string
+	client    *http.Client
+	stateFile string
+	mediaDir  string
+
+	rooms   map[string]struct{}
+	allowed map[string]struct{}
+
+	mu     sync.Mutex
+	warned map[string]bool
+}
+
+// StartMatrix connects to a Matrix homeserver using the client-server API.
+// It long-polls /sync, persisting the next_batch token under workspace so a
+// restart resumes where it left off. Unthreaded messages in a room share one
+// session keyed by the room ID; each thread is its own session, keyed as
+// "roomID/threadRootEventID", and is answered in that thread. End-to-end
+// encrypted rooms are not supported.
+func StartMatrix(ctx context.Context, hub *chat.Hub, cfg config.MatrixConfig, workspace string) error {
+	if cfg.Homeserver == "" {
+		return fmt.Errorf("matrix homeserver not provided")
+	}
+	if cfg.AccessToken == "" {
+		return fmt.Errorf("matrix access token not provided")
+	}
+	if strings.HasPrefix(workspace, "~/") {
+		if home, err := os.UserHomeDir(); err == nil {
+			workspace = filepath.Join(home, workspace[2:])
+		}
+	}
+
+	mc := &matrixChannel{
+		base:      strings.TrimRight(cfg.Homeserver, "/"),
+		token:     cfg.AccessToken,
+		client:    &http.Client{Timeout: 60 * time.Second},
+		stateFile: filepath.Join(workspace, "matrix_next_batch"),
+		mediaDir:  filepath.Join(workspace, "media", "matrix"),
+		rooms:     toSet(cfg.AllowRooms),
+		allowed:   toSet(cfg.AllowFrom),
+		warned:    make(map[string]bool),
+	}
+
+	var who struct {
+		UserID string `json:"user_id"`
+	}
+	if err := mc.do(ctx, "GET", "/_matrix/client/v3/account/whoami", nil, &who); err != nil {
+		return fmt.Errorf("matrix whoami: %w", err)
+	}
+	mc.userID = who.UserID
+	log.Printf("matrix: logged in as %s", mc.userID)
+
+	go mc.syncLoop(ctx, hub)
+
+	go func() {
+		for {
+			select {
+			case <-ctx.Done():
+				log.Println("matrix: stopping outbound sender")
+				return
+			case out := <-hub.MatrixOut:
+				if err := mc.send(ctx, out); err != nil {
+					log.Printf("matrix: send error: %v", err)
+				}
+			}
+		}
+	}()
+
+	return nil
+}
+
+// do performs an authenticated JSON request against the homeserver.
+func (mc *matrixChannel) do(ctx context.Context, method, path string, body, out interface{}) error {
+	var rd io.Reader
+	if body != nil {
+		b, err := json.Marshal(body)
+		if err != nil {
+			return err
+		}
+		rd = bytes.NewReader(b)
+	}
+	req, err := http.NewRequestWithContext(ctx, method, mc.base+path, rd)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Authorization", "Bearer "+mc.token)
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	resp, err := mc.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		b, _ := io.ReadAll(io.LimitReader(resp.Body, 512))
+		return fmt.Errorf("%s %s: status %d: %s", method, path, resp.StatusCode, strings.TrimSpace(string(b)))
+	}
+	if out == nil {
+		io.Copy(io.Discard, resp.Body)
+		return nil
+	}
+	return json.NewDecoder(resp.Body).Decode(out)
+}
+
+func (mc *matrixChannel) roomAllowed(roomID string) bool {
+	if len(mc.rooms) == 0 {
+		return true
+	}
+	_, ok := mc.rooms[roomID]
+	return ok
+}
+
+func (mc *matrixChannel) syncLoop(ctx context.Context, hub *chat.Hub) {
+	since := ""
+	if b, err := os.ReadFile(mc.stateFile); err == nil {
+		since = strings.TrimSpace(string(b))
+	}
+	// Without a stored token the first sync returns recent history; record the
+	// position but don't answer old messages.
+	skipHistory := since == ""
+
+	for {
+		select {
+		case <-ctx.Done():
+			log.Println("matrix: stopping sync loop")
+			return
+		default:
+		}
+
+		v := url.Values{}
+		v.Set("timeout", "30000")
+		if since != "" {
+			v.Set("since", since)
+		}
+		var sr matrixSyncResponse
+		if err := mc.do(ctx, "GET", "/_matrix/client/v3/sync?"+v.Encode(), nil, &sr); err != nil {
+			if ctx.Err() != nil {
+				continue
+			}
+			log.Printf("matrix: sync error: %v", err)
+			time.Sleep(5 * time.Second)
+			continue
+		}
+
+		for roomID := range sr.Rooms.Invite {
+			if !mc.roomAllowed(roomID) {
+				continue
+			}
+			if err := mc.do(ctx, "POST", "/_matrix/client/v3/join/"+url.PathEscape(roomID), map[string]string{}, nil); err != nil {
+				log.Printf("matrix: failed to join %s: %v", roomID, err)
+			} else {
+				log.Printf("matrix: joined %s", roomID)
+			}
+		}
+
+		if !skipHistory {
+			for roomID, room := range sr.Rooms.Join {
+				if !mc.roomAllowed(roomID) {
+					continue
+				}
+				for _, ev := range room.Timeline.Events {
+					mc.handleEvent(ctx, hub, roomID, ev)
+				}
+			}
+		}
+		skipHistory = false
+
+		since = sr.NextBatch
+		if err := os.WriteFile(mc.stateFile, []byte(since), 0o600); err != nil {
+			log.Printf("matrix: failed to persist sync token: %v", err)
+		}
+	}
+}
+
+func (mc *matrixChannel) handleEvent(ctx context.Context, hub *chat.Hub, roomID string, ev matrixEvent) {
+	if ev.Sender == mc.userID {
+		return
+	}
+	if ev.Type == "m.room.encrypted" {
+		mc.mu.Lock()
+		warned := mc.warned[roomID]
+		mc.warned[roomID] = true
+		mc.mu.Unlock()
+		if !warned {
+			log.Printf("matrix: WARNING room %s is end-to-end encrypted; encrypted rooms are not supported and messages there are ignored", roomID)
+		}
+		return
+	}
+	if ev.Type != "m.room.message" {
+		return
+	}
+	if len(mc.allowed) > 0 {
+		if _, ok := mc.allowed[ev.Sender]; !ok {
+			log.Printf("matrix: dropping message from unauthorized user %s", ev.Sender)
+			return
+		}
+	}
+
+	content := ev.Content.Body
+	var media []string
+	switch ev.Content.MsgType {
+	case "m.image", "m.file", "m.audio", "m.video":
+		path, err := mc.download(ctx, ev)
+		if err != nil {
+			log.Printf("matrix: media download failed: %v", err)
+		} else {
+			media = append(media, path)
+			content = fmt.Sprintf("[%s attached: %s]", strings.TrimPrefix(ev.Content.MsgType, "m."), path)
+		}
+	}
+
+	chatID := roomID
+	metadata := map[string]interface{}{"event_id": ev.EventID}
+	if rel := ev.Content.RelatesTo; rel != nil && rel.RelType == "m.thread" && rel.EventID != "" {
+		chatID = roomID + "/" + rel.EventID
+		metadata["thread_id"] = rel.EventID
+	}
+
+	hub.In <- chat.Inbound{
+		Channel:   "matrix",
+		SenderID:  ev.Sender,
+		ChatID:    chatID,
+		Content:   content,
+		Timestamp: time.Now(),
+		Media:     media,
+		Metadata:  metadata,
+	}
+}
+
+// download saves an mxc:// attachment under the workspace media directory.
+func (mc *matrixChannel) download(ctx context.Context, ev matrixEvent) (string, error) {
+	serverAndID, ok := strings.CutPrefix(ev.Content.URL, "mxc://")
+	if !ok {
+		return "", fmt.Errorf("unsupported media url %q", ev.Content.URL)
+	}
+	// Authenticated media endpoint (Matrix v1.11+), falling back to the legacy one.
+	var resp *http.Response
+	for _, p := range []string{"/_matrix/client/v1/media/download/", "/_matrix/media/v3/download/"} {
+		req, err := http.NewRequestWithContext(ctx, "GET", mc.base+p+serverAndID, nil)
+		if err != nil {
+			return "", err
+		}
+		req.Header.Set("Authorization", "Bearer "+mc.token)
+		r, err := mc.client.Do(req)
+		if err != nil {
+			return "", err
+		}
+		if r.StatusCode == http.StatusOK {
+			resp = r
+			break
+		}
+		r.Body.Close()
+	}
+	if resp == nil {
+		return "", fmt.Errorf("media %s not available", ev.Content.URL)
+	}
+	defer resp.Body.Close()
+
+	if err := os.MkdirAll(mc.mediaDir, 0o755); err != nil {
+		return "", err
+	}
+	name := filepath.Base(ev.Content.Body)
+	if name == "." || name == "/" || name == "" {
+		name = "attachment"
+	}
+	path := filepath.Join(mc.mediaDir, strings.TrimPrefix(ev.EventID, "$")+"-"+name)
+	f, err := os.Create(path)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+	n, err := io.Copy(f, io.LimitReader(resp.Body, matrixMaxMedia+1))
+	if err == nil && n > matrixMaxMedia {
+		err = fmt.Errorf("media %s is larger than %d bytes", ev.Content.URL, matrixMaxMedia)
+	}
+	if err != nil {
+		os.Remove(path)
+		return "", err
+	}
+	return path, nil
+}
+
+func (mc *matrixChannel) send(ctx context.Context, out chat.Outbound) error {
+	body := map[string]interface{}{
+		"msgtype": "m.text",
+		"body":    out.Content,
+	}
+	// Server names can't contain "/", so the first one separates the room from
+	// the thread root.
+	roomID, root, threaded := strings.Cut(out.ChatID, "/")
+	if threaded {
+		body["m.relates_to"] = map[string]interface{}{
+			"rel_type":        "m.thread",
+			"event_id":        root,
+			"is_falling_back": true,
+			"m.in_reply_to":   map[string]string{"event_id": root},
+		}
+	}
+	txnID := "picobot" + strconv.FormatInt(time.Now().UnixNano(), 10)
+	path := fmt.Sprintf("/_matrix/client/v3/rooms/%s/send/m.room.message/%s", url.PathEscape(roomID), txnID)
+	return mc.do(ctx, "PUT", path, body, nil)
+}
@@ -0,0 +1,390 @@
+package channels
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha1"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net"
+	"net/url"
+	"os"
+	"strings"
+	"sync"
+	"text/template"
+	"time"
+
+	"github.com/local/picobot/internal/chat"
+	"github.com/local/picobot/internal/config"
+)
+
+// defaultMQTTTemplate is used for topics without a template of their own.
+const defaultMQTTTemplate = "MQTT message on {{.Topic}}:\n{{.Raw}}"
+
+// mqttQueueSize is how many received messages may wait for the agent before
+// new ones are dropped.
+const mqttQueueSize = 256
+
+type mqttTopic struct {
+	filter     string
+	replyTopic string
+	tmpl       *template.Template
+}
+
+type mqttChannel struct {
+	opts       mqttConnectOptions
+	qos        byte
+	replyTopic string
+	topics     []mqttTopic
+
+	mu   sync.Mutex
+	conn *mqttConn
+
+	// received messages waiting to be handed to the agent, so the connection's
+	// read loop never waits on it
+	inbound chan mqttMessage
+
+	// hashes of messages we published, so subscriptions that overlap a reply
+	// topic don't feed the agent its own replies
+	sentMu  sync.Mutex
+	sentIDs map[string]struct{}
+	sentLog []string
+}
+
+// mqttTemplateData is what topic templates are rendered with.
+type mqttTemplateData struct {
+	Topic   string
+	Payload interface{} // decoded JSON, or the raw string if the payload isn't JSON
+	Raw     string
+}
+
+// StartMQTT connects to an MQTT broker, subscribes to the configured topics
+// and hands each message to the agent, rendered through the topic's template.
+// Each concrete topic is its own session, with the topic path-escaped as its
+// chat ID (see mqttChatID). Replies go to the topic's reply topic; a chat ID
+// that matches no subscription is published to as a topic, so the agent can
+// also drive devices (e.g. "zigbee2mqtt/lamp/set").
+func StartMQTT(ctx context.Context, hub *chat.Hub, cfg config.MQTTConfig) error {
+	if cfg.Broker == "" {
+		return fmt.Errorf("mqtt broker not provided")
+	}
+	if len(cfg.Topics) == 0 {
+		return fmt.Errorf("mqtt: no topics configured")
+	}
+	if cfg.QoS < 0 || cfg.QoS > 2 {
+		return fmt.Errorf("mqtt: qos must be 0, 1 or 2")
+	}
+	addr, tlsCfg, err := mqttBrokerAddr(cfg)
+	if err != nil {
+		return err
+	}
+	clientID := cfg.ClientID
+	if clientID == "" {
+		clientID = "picobot"
+	}
+	replyTopic := cfg.ReplyTopic
+	if replyTopic == "" {
+		replyTopic = "picobot/reply"
+	}
+
+	mc := &mqttChannel{
+		opts: mqttConnectOptions{
+			Addr:      addr,
+			TLS:       tlsCfg,
+			ClientID:  clientID,
+			Username:  cfg.Username,
+			Password:  cfg.Password,
+			KeepAlive: 60 * time.Second,
+		},
+		qos:        byte(cfg.QoS),
+		replyTopic: replyTopic,
+		sentIDs:    make(map[string]struct{}),
+		inbound:    make(chan mqttMessage, mqttQueueSize),
+	}
+	for _, tc := range cfg.Topics {
+		if tc.Topic == "" {
+			return fmt.Errorf("mqtt: topic entry without a topic")
+		}
+		text := tc.Template
+		if text == "" {
+			text = defaultMQTTTemplate
+		}
+		tmpl, err := template.New(tc.Topic).Funcs(template.FuncMap{"json": webhookJSON}).Parse(text)
+		if err != nil {
+			return fmt.Errorf("mqtt topic %q: invalid template: %w", tc.Topic, err)
+		}
+		mc.topics = append(mc.topics, mqttTopic{filter: tc.Topic, replyTopic: tc.ReplyTopic, tmpl: tmpl})
+	}
+
+	go mc.run(ctx)
+	go mc.deliver(ctx, hub)
+
+	go func() {
+		for {
+			select {
+			case <-ctx.Done():
+				log.Println("mqtt: stopping outbound sender")
+				return
+			case out := <-hub.MQTTOut:
+				if err := mc.send(out); err != nil {
+					log.Printf("mqtt: send error: %v", err)
+				}
+			}
+		}
+	}()
+
+	log.Printf("mqtt channel started for %s (%d topics)", cfg.Broker, len(mc.topics))
+	return nil
+}
+
+// mqttBrokerAddr parses the broker URL into host:port and an optional TLS config.
+// tcp:// and mqtt:// are plain (default port 1883); ssl://, tls:// and
+// mqtts:// use TLS (default port 8883).
+func mqttBrokerAddr(cfg config.MQTTConfig) (string, *tls.Config, error) {
+	broker := cfg.Broker
+	if !strings.Contains(broker, "://") {
+		broker = "tcp://" + broker
+	}
+	u, err := url.Parse(broker)
+	if err != nil {
+		return "", nil, fmt.Errorf("mqtt: invalid broker %q: %w", cfg.Broker, err)
+	}
+	var useTLS bool
+	switch u.Scheme {
+	case "tcp", "mqtt":
+	case "ssl", "tls", "mqtts":
+		useTLS = true
+	default:
+		return "", nil, fmt.Errorf("mqtt: unsupported broker scheme %q", u.Scheme)
+	}
+	port := u.Port()
+	if port == "" {
+		port = "1883"
+		if useTLS {
+			port = "8883"
+		}
+	}
+	addr := net.JoinHostPort(u.Hostname(), port)
+	if !useTLS {
+		return addr, nil, nil
+	}
+
+	tlsCfg := &tls.Config{ServerName: u.Hostname(), InsecureSkipVerify: cfg.InsecureSkipVerify}
+	if cfg.CAFile != "" {
+		pem, err := os.ReadFile(cfg.CAFile)
+		if err != nil {
+			return "", nil, fmt.Errorf("mqtt: reading caFile: %w", err)
+		}
+		pool, err := x509.SystemCertPool()
+		if err != nil {
+			pool = x509.NewCertPool()
+		}
+		if !pool.AppendCertsFromPEM(pem) {
+			return "", nil, fmt.Errorf("mqtt: no certificates found in %s", cfg.CAFile)
+		}
+		tlsCfg.RootCAs = pool
+	}
+	if cfg.CertFile != "" || cfg.KeyFile != "" {
+		cert, err := tls.LoadX509KeyPair(cfg.CertFile, cfg.KeyFile)
+		if err != nil {
+			return "", nil, fmt.Errorf("mqtt: loading client certificate: %w", err)
+		}
+		tlsCfg.Certificates = []tls.Certificate{cert}
+	}
+	return addr, tlsCfg, nil
+}
+
+// run keeps a broker connection open, resubscribing after every reconnect.
+func (mc *mqttChannel) run(ctx context.Context) {
+	filters := make([]string, len(mc.topics))
+	for i, t := range mc.topics {
+		filters[i] = t.filter
+	}
+	backoff := time.Second
+	for {
+		select {
+		case <-ctx.Done():
+			log.Println("mqtt: stopping subscriber")
+			return
+		default:
+		}
+
+		conn, err := dialMQTT(mc.opts, mc.enqueue)
+		if err == nil {
+			// set before subscribing, so replies to the first messages can be sent
+			mc.setConn(conn)
+			if err = conn.Subscribe(filters, mc.qos); err != nil {
+				mc.setConn(nil)
+				conn.Close()
+			}
+		}
+		if err != nil {
+			log.Printf("mqtt: connect error: %v (retrying in %v)", err, backoff)
+			select {
+			case <-ctx.Done():
+			case <-time.After(backoff):
+			}
+			if backoff < time.Minute {
+				backoff *= 2
+			}
+			continue
+		}
+		backoff = time.Second
+		log.Printf("mqtt: connected to %s", mc.opts.Addr)
+
+		select {
+		case <-ctx.Done():
+			conn.Close()
+		case <-conn.Done():
+			log.Printf("mqtt: connection lost: %v", conn.Err())
+		}
+
+		mc.setConn(nil)
+	}
+}
+
+func (mc *mqttChannel) setConn(conn *mqttConn) {
+	mc.mu.Lock()
+	mc.conn = conn
+	mc.mu.Unlock()
+}
+
+// enqueue is called on the connection's read loop. It must not block, or
+// acknowledgements and pings stall and the broker drops the connection.
+func (mc *mqttChannel) enqueue(m mqttMessage) {
+	select {
+	case mc.inbound <- m:
+	default:
+		log.Printf("mqtt: dropping message on %s, agent queue is full", m.Topic)
+	}
+}
+
+// deliver hands queued messages to the agent in the order they arrived.
+func (mc *mqttChannel) deliver(ctx context.Context, hub *chat.Hub) {
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case m := <-mc.inbound:
+			mc.handle(hub, m)
+		}
+	}
+}
+
+func (mc *mqttChannel) topicFor(topic string) (mqttTopic, bool) {
+	for _, t := range mc.topics {
+		if mqttTopicMatch(t.filter, topic) {
+			return t, true
+		}
+	}
+	return mqttTopic{}, false
+}
+
+func (mc *mqttChannel) handle(hub *chat.Hub, m mqttMessage) {
+	// retained messages are stale state replayed on subscribe, not new events
+	if m.Retained {
+		return
+	}
+	if mc.isOwn(m.Topic, m.Payload) {
+		return
+	}
+	t, ok := mc.topicFor(m.Topic)
+	if !ok {
+		return
+	}
+
+	data := mqttTemplateData{Topic: m.Topic, Raw: string(m.Payload)}
+	if err := json.Unmarshal(m.Payload, &data.Payload); err != nil {
+		data.Payload = data.Raw
+	}
+	var buf bytes.Buffer
+	if err := t.tmpl.Execute(&buf, data); err != nil {
+		log.Printf("mqtt: template for %s: %v", t.filter, err)
+		return
+	}
+	content := strings.TrimSpace(buf.String())
+	if content == "" {
+		return
+	}
+
+	hub.In <- chat.Inbound{
+		Channel:   "mqtt",
+		SenderID:  m.Topic,
+		ChatID:    mqttChatID(m.Topic),
+		Content:   content,
+		Timestamp: time.Now(),
+		Metadata:  map[string]interface{}{"topic": m.Topic},
+	}
+}
+
+// mqttChatID is the chat ID for messages on topic. Chat IDs name session
+// files, so the "/" separating topic levels is escaped.
+func mqttChatID(topic string) string {
+	return url.PathEscape(topic)
+}
+
+// mqttChatTopic is the topic a chat ID stands for. Plain topics, e.g. from
+// the message tool, are returned unchanged.
+func mqttChatTopic(chatID string) string {
+	if topic, err := url.PathUnescape(chatID); err == nil {
+		return topic
+	}
+	return chatID
+}
+
+func (mc *mqttChannel) send(out chat.Outbound) error {
+	topic := mqttChatTopic(out.ChatID)
+	if t, ok := mc.topicFor(topic); ok {
+		topic = t.replyTopic
+		if topic == "" {
+			topic = mc.replyTopic
+		}
+	}
+	if topic == "" {
+		topic = mc.replyTopic
+	}
+	if strings.ContainsAny(topic, "+#") {
+		return fmt.Errorf("cannot publish to wildcard topic %q", topic)
+	}
+
+	mc.mu.Lock()
+	conn := mc.conn
+	mc.mu.Unlock()
+	if conn == nil {
+		return fmt.Errorf("not connected to broker, dropping reply for %s", out.ChatID)
+	}
+	payload := []byte(out.Content)
+	mc.rememberSent(topic, payload)
+	return conn.Publish(topic, payload, mc.qos, false)
+}
+
+func mqttMessageID(topic string, payload []byte) string {
+	h := sha1.New()
+	h.Write([]byte(topic))
+	h.Write([]byte{0})
+	h.Write(payload)
+	return hex.EncodeToString(h.Sum(nil))
+}
+
+func (mc *mqttChannel) rememberSent(topic string, payload []byte) {
+	id := mqttMessageID(topic, payload)
+	mc.sentMu.Lock()
+	defer mc.sentMu.Unlock()
+	mc.sentIDs[id] = struct{}{}
+	mc.sentLog = append(mc.sentLog, id)
+	if len(mc.sentLog) > maxSentIDs {
+		delete(mc.sentIDs, mc.sentLog[0])
+		mc.sentLog = mc.sentLog[1:]
+	}
+}
+
+func (mc *mqttChannel) isOwn(topic string, payload []byte) bool {
+	mc.sentMu.Lock()
+	defer mc.sentMu.Unlock()
+	_, ok := mc.sentIDs[mqttMessageID(topic, payload)]
+	return ok
+}
@@ -0,0 +1,309 @@
+package channels
+
+import (
+	"bufio"
+	"context"
+	"encoding/binary"
+	"net"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/local/picobot/internal/chat"
+	"github.com/local/picobot/internal/config"
+)
+
+// testBroker is a minimal in-process MQTT 3.1.1 broker: it accepts clients
+// with the username "picobot" and password "secret", routes PUBLISH packets
+// to matching subscriptions at the lower of the two QoS levels, and records
+// what clients publish and subscribe to.
+type testBroker struct {
+	ln        net.Listener
+	published chan mqttMessage
+	subscribe chan []string
+
+	mu      sync.Mutex
+	clients []*testBrokerClient
+}
+
+type testBrokerClient struct {
+	c    *mqttConn // used for its packet framing only
+	mu   sync.Mutex
+	subs map[string]byte
+	id   uint16
+}
+
+func newTestBroker(t *testing.T) *testBroker {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	b := &testBroker{ln: ln, published: make(chan mqttMessage, 16), subscribe: make(chan []string, 4)}
+	t.Cleanup(func() { ln.Close() })
+	go func() {
+		for {
+			conn, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			t.Cleanup(func() { conn.Close() })
+			go b.serve(conn)
+		}
+	}()
+	return b
+}
+
+func (b *testBroker) addr() string { return b.ln.Addr().String() }
+
+func (b *testBroker) serve(conn net.Conn) {
+	cl := &testBrokerClient{c: &mqttConn{conn: conn, r: bufio.NewReader(conn)}, subs: map[string]byte{}}
+	header, body, err := cl.c.readPacket()
+	if err != nil || header>>4 != mqttConnect {
+		conn.Close()
+		return
+	}
+	if !testBrokerAuth(body) {
+		cl.c.writePacket(mqttConnack<<4, []byte{0, 4})
+		conn.Close()
+		return
+	}
+	cl.c.writePacket(mqttConnack<<4, []byte{0, 0})
+	b.mu.Lock()
+	b.clients = append(b.clients, cl)
+	b.mu.Unlock()
+
+	for {
+		header, body, err := cl.c.readPacket()
+		if err != nil {
+			return
+		}
+		switch header >> 4 {
+		case mqttSubscribe:
+			var filters []string
+			granted := body[:2]
+			for rest := body[2:]; len(rest) > 2; {
+				n := int(binary.BigEndian.Uint16(rest))
+				filter, qos := string(rest[2:2+n]), rest[2+n]
+				rest = rest[3+n:]
+				cl.mu.Lock()
+				cl.subs[filter] = qos
+				cl.mu.Unlock()
+				filters = append(filters, filter)
+				granted = append(granted, qos)
+			}
+			cl.c.writePacket(mqttSuback<<4, granted)
+			b.subscribe <- filters
+		case mqttPublish:
+			qos := (header >> 1) & 0x03
+			n := int(binary.BigEndian.Uint16(body))
+			m := mqttMessage{Topic: string(body[2 : 2+n]), QoS: qos, Retained: header&0x01 != 0}
+			rest := body[2+n:]
+			switch qos {
+			case 1:
+				cl.c.writePacket(mqttPuback<<4, rest[:2])
+				rest = rest[2:]
+			case 2:
+				cl.c.writePacket(mqttPubrec<<4, rest[:2])
+				rest = rest[2:]
+			}
+			m.Payload = append([]byte(nil), rest...)
+			b.published <- m
+			b.route(m)
+		case mqttPubrel:
+			cl.c.writePacket(mqttPubcomp<<4, body[:2])
+		case mqttPubrec:
+			cl.c.writePacket(mqttPubrel<<4|0x02, body[:2])
+		case mqttPingreq:
+			cl.c.writePacket(mqttPingresp<<4, nil)
+		case mqttDisconnect:
+			conn.Close()
+			return
+		}
+	}
+}
+
+// testBrokerAuth checks the credentials in a CONNECT packet body.
+func testBrokerAuth(body []byte) bool {
+	str := func(b []byte) (string, []byte) {
+		if len(b) < 2 || len(b) < 2+int(binary.BigEndian.Uint16(b)) {
+			return "", nil
+		}
+		n := int(binary.BigEndian.Uint16(b))
+		return string(b[2 : 2+n]), b[2+n:]
+	}
+	_, rest := str(body) // protocol name
+	if len(rest) < 4 {
+		return false
+	}
+	flags := rest[1]
+	_, rest = str(rest[4:]) // client ID
+	var user, pass string
+	if flags&0x80 != 0 {
+		user, rest = str(rest)
+	}
+	if flags&0x40 != 0 {
+		pass, _ = str(rest)
+	}
+	return user == "picobot" && pass == "secret"
+}
+
+// route delivers m to every client subscribed to a matching filter.
+func (b *testBroker) route(m mqttMessage) {
+	b.mu.Lock()
+	clients := append([]*testBrokerClient(nil), b.clients...)
+	b.mu.Unlock()
+	for _, cl := range clients {
+		cl.mu.Lock()
+		qos, ok := byte(0), false
+		for filter, q := range cl.subs {
+			if mqttTopicMatch(filter, m.Topic) {
+				qos, ok = max(qos, q), true
+			}
+		}
+		cl.mu.Unlock()
+		if !ok {
+			continue
+		}
+		qos = min(qos, m.QoS)
+		header := byte(mqttPublish<<4) | qos<<1
+		if m.Retained {
+			header |= 0x01
+		}
+		body := appendMQTTString(nil, m.Topic)
+		if qos > 0 {
+			cl.mu.Lock()
+			cl.id++
+			body = binary.BigEndian.AppendUint16(body, cl.id)
+			cl.mu.Unlock()
+		}
+		cl.c.writePacket(header, append(body, m.Payload...))
+	}
+}
+
+// inject publishes a message to subscribers as if another client sent it.
+func (b *testBroker) inject(topic, payload string, retained bool) {
+	b.route(mqttMessage{Topic: topic, Payload: []byte(payload), QoS: 1, Retained: retained})
+}
+
+func (b *testBroker) waitSubscribe(t *testing.T) []string {
+	t.Helper()
+	select {
+	case filters := <-b.subscribe:
+		return filters
+	case <-time.After(5 * time.Second):
+		t.Fatal("client did not subscribe")
+	}
+	return nil
+}
+
+func (b *testBroker) waitPublish(t *testing.T) mqttMessage {
+	t.Helper()
+	select {
+	case m := <-b.published:
+		return m
+	case <-time.After(5 * time.Second):
+		t.Fatal("client did not publish")
+	}
+	return mqttMessage{}
+}
+
+func TestMQTTConn(t *testing.T) {
+	b := newTestBroker(t)
+	opts := mqttConnectOptions{Addr: b.addr(), ClientID: "test", Username: "picobot", Password: "wrong"}
+	if _, err := dialMQTT(opts, func(mqttMessage) {}); err == nil || !strings.Contains(err.Error(), "bad username or password") {
+		t.Fatalf("dial with a wrong password: got %v", err)
+	}
+
+	opts.Password = "secret"
+	received := make(chan mqttMessage, 4)
+	conn, err := dialMQTT(opts, func(m mqttMessage) { received <- m })
+	if err != nil {
+		t.Fatalf("dial: %v", err)
+	}
+	defer conn.Close()
+	if err := conn.Subscribe([]string{"test/#"}, 2); err != nil {
+		t.Fatalf("subscribe: %v", err)
+	}
+	b.waitSubscribe(t)
+
+	for qos := byte(0); qos <= 2; qos++ {
+		payload := []byte{'q', '0' + qos}
+		if err := conn.Publish("test/qos", payload, qos, false); err != nil {
+			t.Fatalf("publish at QoS %d: %v", qos, err)
+		}
+		if m := b.waitPublish(t); m.QoS != qos || string(m.Payload) != string(payload) {
+			t.Errorf("broker got %+v, want QoS %d payload %q", m, qos, payload)
+		}
+		select {
+		case m := <-received:
+			if m.Topic != "test/qos" || m.QoS != qos || string(m.Payload) != string(payload) {
+				t.Errorf("received %+v, want QoS %d payload %q", m, qos, payload)
+			}
+		case <-time.After(5 * time.Second):
+			t.Fatalf("QoS %d message not received", qos)
+		}
+	}
+}
+
+func TestMQTTChannel(t *testing.T) {
+	b := newTestBroker(t)
+	hub := chat.NewHub(8)
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	err := StartMQTT(ctx, hub, config.MQTTConfig{
+		Enabled:    true,
+		Broker:     "tcp://" + b.addr(),
+		Username:   "picobot",
+		Password:   "secret",
+		QoS:        1,
+		ReplyTopic: "picobot/reply",
+		Topics: []config.MQTTTopicConfig{
+			{Topic: "home/+/contact", Template: "{{.Topic}} contact={{.Payload.contact}}", ReplyTopic: "home/notify"},
+			{Topic: "picobot/#"},
+		},
+	})
+	if err != nil {
+		t.Fatalf("StartMQTT: %v", err)
+	}
+	b.waitSubscribe(t)
+
+	receive := func() chat.Inbound {
+		t.Helper()
+		select {
+		case in := <-hub.In:
+			return in
+		case <-time.After(5 * time.Second):
+			t.Fatal("no inbound message")
+		}
+		return chat.Inbound{}
+	}
+
+	// retained messages are skipped
+	b.inject("home/door/contact", `{"contact": true}`, true)
+	b.inject("home/door/contact", `{"contact": false}`, false)
+	in := receive()
+	if in.ChatID != "home%2Fdoor%2Fcontact" || in.Content != "home/door/contact contact=false" || in.Metadata["topic"] != "home/door/contact" {
+		t.Errorf("got chat %q content %q metadata %v", in.ChatID, in.Content, in.Metadata)
+	}
+
+	send := func(chatID, wantTopic string) {
+		t.Helper()
+		hub.MQTTOut <- chat.Outbound{Channel: "mqtt", ChatID: chatID, Content: "reply to " + chatID}
+		m := b.waitPublish(t)
+		if m.Topic != wantTopic || string(m.Payload) != "reply to "+chatID {
+			t.Errorf("reply to %s published %q on %s, want it on %s", chatID, m.Payload, m.Topic, wantTopic)
+		}
+	}
+	// replies go to the subscription's reply topic, other chat IDs are topics
+	send(in.ChatID, "home/notify")
+	send("zigbee2mqtt/lamp/set", "zigbee2mqtt/lamp/set")
+	// this reply goes to picobot/reply, which picobot/# also covers; the
+	// echo must not reach the agent
+	send("picobot%2Fask", "picobot/reply")
+	b.inject("picobot/ask", "hello", false)
+	if in := receive(); in.ChatID != "picobot%2Fask" || !strings.HasSuffix(in.Content, "hello") {
+		t.Errorf("got chat %q content %q, want the injected message and not the echo", in.ChatID, in.Content)
+	}
+}
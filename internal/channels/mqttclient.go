@@ -0,0 +1,437 @@
+package channels
+
+import (
+	"bufio"
+	"crypto/tls"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"strings"
+	"sync"
+	"time"
+)
+
+// MQTT 3.1.1 control packet types (upper nibble of the fixed header).
+const (
+	mqttConnect     = 1
+	mqttConnack     = 2
+	mqttPublish     = 3
+	mqttPuback      = 4
+	mqttPubrec      = 5
+	mqttPubrel      = 6
+	mqttPubcomp     = 7
+	mqttSubscribe   = 8
+	mqttSuback      = 9
+	mqttPingreq     = 12
+	mqttPingresp    = 13
+	mqttDisconnect  = 14
+	mqttMaxPacketSz = 4 << 20
+)
+
+// mqttMessage is an application message received from the broker.
+type mqttMessage struct {
+	Topic    string
+	Payload  []byte
+	QoS      byte
+	Retained bool
+}
+
+// mqttConn is a minimal MQTT 3.1.1 client covering what the MQTT channel
+// needs: CONNECT with credentials, SUBSCRIBE, PUBLISH at QoS 0-2 in both
+// directions, and keepalive pings. It does not persist sessions; callers
+// reconnect with a clean session and resubscribe.
+type mqttConn struct {
+	conn      net.Conn
+	r         *bufio.Reader
+	keepAlive time.Duration
+
+	wmu    sync.Mutex // serializes writes
+	mu     sync.Mutex
+	nextID uint16
+	acks   map[uint16]chan byte // packet id -> ack type, for our in-flight packets
+	qos2   map[uint16]struct{}  // inbound QoS 2 ids awaiting PUBREL
+	onMsg  func(mqttMessage)
+	closed chan struct{}
+	err    error
+}
+
+type mqttConnectOptions struct {
+	Addr      string // host:port
+	TLS       *tls.Config
+	ClientID  string
+	Username  string
+	Password  string
+	KeepAlive time.Duration
+}
+
+// dialMQTT connects and completes the CONNECT/CONNACK handshake. onMsg is
+// called from the read loop for every PUBLISH received.
+func dialMQTT(opts mqttConnectOptions, onMsg func(mqttMessage)) (*mqttConn, error) {
+	dialer := &net.Dialer{Timeout: 30 * time.Second}
+	var conn net.Conn
+	var err error
+	if opts.TLS != nil {
+		conn, err = tls.DialWithDialer(dialer, "tcp", opts.Addr, opts.TLS)
+	} else {
+		conn, err = dialer.Dial("tcp", opts.Addr)
+	}
+	if err != nil {
+		return nil, err
+	}
+	if opts.KeepAlive <= 0 {
+		opts.KeepAlive = 60 * time.Second
+	}
+	c := &mqttConn{
+		conn:      conn,
+		r:         bufio.NewReader(conn),
+		keepAlive: opts.KeepAlive,
+		acks:      make(map[uint16]chan byte),
+		qos2:      make(map[uint16]struct{}),
+		onMsg:     onMsg,
+		closed:    make(chan struct{}),
+	}
+
+	var vh []byte
+	vh = appendMQTTString(vh, "MQTT")
+	flags := byte(0x02) // clean session
+	if opts.Username != "" {
+		flags |= 0x80
+		if opts.Password != "" {
+			flags |= 0x40
+		}
+	}
+	vh = append(vh, 4, flags) // protocol level 4 = 3.1.1
+	vh = binary.BigEndian.AppendUint16(vh, uint16(opts.KeepAlive/time.Second))
+	vh = appendMQTTString(vh, opts.ClientID)
+	if opts.Username != "" {
+		vh = appendMQTTString(vh, opts.Username)
+		if opts.Password != "" {
+			vh = appendMQTTString(vh, opts.Password)
+		}
+	}
+
+	conn.SetDeadline(time.Now().Add(30 * time.Second))
+	if err := c.writePacket(mqttConnect<<4, vh); err != nil {
+		conn.Close()
+		return nil, err
+	}
+	typ, body, err := c.readPacket()
+	if err != nil {
+		conn.Close()
+		return nil, err
+	}
+	if typ>>4 != mqttConnack || len(body) < 2 {
+		conn.Close()
+		return nil, fmt.Errorf("mqtt: expected CONNACK, got packet type %d", typ>>4)
+	}
+	if body[1] != 0 {
+		conn.Close()
+		return nil, fmt.Errorf("mqtt: connection refused: %s", mqttConnackReason(body[1]))
+	}
+	conn.SetDeadline(time.Time{})
+
+	go c.readLoop()
+	go c.pingLoop()
+	return c, nil
+}
+
+func mqttConnackReason(code byte) string {
+	switch code {
+	case 1:
+		return "unacceptable protocol version"
+	case 2:
+		return "client identifier rejected"
+	case 3:
+		return "server unavailable"
+	case 4:
+		return "bad username or password"
+	case 5:
+		return "not authorized"
+	}
+	return fmt.Sprintf("code %d", code)
+}
+
+func appendMQTTString(b []byte, s string) []byte {
+	b = binary.BigEndian.AppendUint16(b, uint16(len(s)))
+	return append(b, s...)
+}
+
+func (c *mqttConn) writePacket(header byte, body []byte) error {
+	pkt := []byte{header}
+	// remaining length, 7 bits per byte with continuation bit
+	n := len(body)
+	for {
+		b := byte(n % 128)
+		n /= 128
+		if n > 0 {
+			b |= 0x80
+		}
+		pkt = append(pkt, b)
+		if n == 0 {
+			break
+		}
+	}
+	pkt = append(pkt, body...)
+	c.wmu.Lock()
+	defer c.wmu.Unlock()
+	_, err := c.conn.Write(pkt)
+	return err
+}
+
+func (c *mqttConn) readPacket() (byte, []byte, error) {
+	header, err := c.r.ReadByte()
+	if err != nil {
+		return 0, nil, err
+	}
+	n, mult := 0, 1
+	for i := 0; ; i++ {
+		b, err := c.r.ReadByte()
+		if err != nil {
+			return 0, nil, err
+		}
+		n += int(b&0x7f) * mult
+		if b&0x80 == 0 {
+			break
+		}
+		if i == 3 {
+			return 0, nil, errors.New("mqtt: malformed remaining length")
+		}
+		mult *= 128
+	}
+	if n > mqttMaxPacketSz {
+		return 0, nil, fmt.Errorf("mqtt: packet of %d bytes too large", n)
+	}
+	body := make([]byte, n)
+	if _, err := io.ReadFull(c.r, body); err != nil {
+		return 0, nil, err
+	}
+	return header, body, nil
+}
+
+func (c *mqttConn) readLoop() {
+	var err error
+	for {
+		var header byte
+		var body []byte
+		header, body, err = c.readPacket()
+		if err != nil {
+			break
+		}
+		switch header >> 4 {
+		case mqttPublish:
+			err = c.handlePublish(header, body)
+		case mqttPuback, mqttPubrec, mqttPubcomp, mqttSuback:
+			if len(body) >= 2 {
+				c.ack(binary.BigEndian.Uint16(body), header>>4)
+			}
+		case mqttPubrel:
+			if len(body) >= 2 {
+				id := binary.BigEndian.Uint16(body)
+				c.mu.Lock()
+				delete(c.qos2, id)
+				c.mu.Unlock()
+				c.writePacket(mqttPubcomp<<4, body[:2])
+			}
+		case mqttPingresp:
+		}
+		if err != nil {
+			break
+		}
+	}
+	c.shutdown(err)
+}
+
+func (c *mqttConn) handlePublish(header byte, body []byte) error {
+	qos := (header >> 1) & 0x03
+	if len(body) < 2 {
+		return errors.New("mqtt: short PUBLISH")
+	}
+	tl := int(binary.BigEndian.Uint16(body))
+	if len(body) < 2+tl {
+		return errors.New("mqtt: short PUBLISH topic")
+	}
+	msg := mqttMessage{Topic: string(body[2 : 2+tl]), QoS: qos, Retained: header&0x01 != 0}
+	rest := body[2+tl:]
+	var id []byte
+	if qos > 0 {
+		if len(rest) < 2 {
+			return errors.New("mqtt: PUBLISH without packet id")
+		}
+		id, rest = rest[:2], rest[2:]
+	}
+	msg.Payload = rest
+
+	switch qos {
+	case 0:
+		c.onMsg(msg)
+	case 1:
+		c.onMsg(msg)
+		return c.writePacket(mqttPuback<<4, id)
+	case 2:
+		// deliver once; a redelivery before PUBREL carries the same id
+		pid := binary.BigEndian.Uint16(id)
+		c.mu.Lock()
+		_, seen := c.qos2[pid]
+		c.qos2[pid] = struct{}{}
+		c.mu.Unlock()
+		if !seen {
+			c.onMsg(msg)
+		}
+		return c.writePacket(mqttPubrec<<4, id)
+	}
+	return nil
+}
+
+func (c *mqttConn) ack(id uint16, typ byte) {
+	c.mu.Lock()
+	ch, ok := c.acks[id]
+	c.mu.Unlock()
+	if ok {
+		select {
+		case ch <- typ:
+		default:
+		}
+	}
+}
+
+func (c *mqttConn) pingLoop() {
+	t := time.NewTicker(c.keepAlive / 2)
+	defer t.Stop()
+	for {
+		select {
+		case <-c.closed:
+			return
+		case <-t.C:
+			if err := c.writePacket(mqttPingreq<<4, nil); err != nil {
+				c.conn.Close()
+				return
+			}
+		}
+	}
+}
+
+func (c *mqttConn) shutdown(err error) {
+	c.mu.Lock()
+	select {
+	case <-c.closed:
+	default:
+		c.err = err
+		close(c.closed)
+	}
+	c.mu.Unlock()
+	c.conn.Close()
+}
+
+// Done is closed when the connection drops; Err then reports why.
+func (c *mqttConn) Done() <-chan struct{} { return c.closed }
+
+func (c *mqttConn) Err() error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.err
+}
+
+// newPacket registers a packet id whose acknowledgements arrive on the returned channel.
+func (c *mqttConn) newPacket() (uint16, chan byte) {
+	ch := make(chan byte, 2)
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	for {
+		c.nextID++
+		if c.nextID == 0 {
+			continue
+		}
+		if _, busy := c.acks[c.nextID]; !busy {
+			c.acks[c.nextID] = ch
+			return c.nextID, ch
+		}
+	}
+}
+
+func (c *mqttConn) release(id uint16) {
+	c.mu.Lock()
+	delete(c.acks, id)
+	c.mu.Unlock()
+}
+
+// await waits for an acknowledgement of the given type.
+func (c *mqttConn) await(ch chan byte, want byte) error {
+	select {
+	case typ := <-ch:
+		if typ != want {
+			return fmt.Errorf("mqtt: unexpected ack type %d", typ)
+		}
+		return nil
+	case <-c.closed:
+		return errors.New("mqtt: connection closed")
+	case <-time.After(30 * time.Second):
+		return errors.New("mqtt: timed out waiting for acknowledgement")
+	}
+}
+
+// Subscribe subscribes to the topic filters at the given QoS and waits for SUBACK.
+func (c *mqttConn) Subscribe(filters []string, qos byte) error {
+	id, ch := c.newPacket()
+	defer c.release(id)
+	body := binary.BigEndian.AppendUint16(nil, id)
+	for _, f := range filters {
+		body = appendMQTTString(body, f)
+		body = append(body, qos)
+	}
+	if err := c.writePacket(mqttSubscribe<<4|0x02, body); err != nil {
+		return err
+	}
+	return c.await(ch, mqttSuback)
+}
+
+// Publish sends a message and, for QoS 1 and 2, waits until the broker has it.
+func (c *mqttConn) Publish(topic string, payload []byte, qos byte, retain bool) error {
+	header := byte(mqttPublish<<4) | qos<<1
+	if retain {
+		header |= 0x01
+	}
+	body := appendMQTTString(nil, topic)
+	if qos == 0 {
+		return c.writePacket(header, append(body, payload...))
+	}
+
+	id, ch := c.newPacket()
+	defer c.release(id)
+	idb := binary.BigEndian.AppendUint16(nil, id)
+	body = append(append(body, idb...), payload...)
+	if err := c.writePacket(header, body); err != nil {
+		return err
+	}
+	if qos == 1 {
+		return c.await(ch, mqttPuback)
+	}
+	if err := c.await(ch, mqttPubrec); err != nil {
+		return err
+	}
+	if err := c.writePacket(mqttPubrel<<4|0x02, idb); err != nil {
+		return err
+	}
+	return c.await(ch, mqttPubcomp)
+}
+
+// Close sends DISCONNECT and closes the connection.
+func (c *mqttConn) Close() {
+	c.writePacket(mqttDisconnect<<4, nil)
+	c.shutdown(nil)
+}
+
+// mqttTopicMatch reports whether topic matches filter, honouring the + and # wildcards.
+func mqttTopicMatch(filter, topic string) bool {
+	f, t := strings.Split(filter, "/"), strings.Split(topic, "/")
+	for i, seg := range f {
+		if seg == "#" {
+			return true // also matches the parent level: "a/#" matches "a"
+		}
+		if i >= len(t) || (seg != "+" && seg != t[i]) {
+			return false
+		}
+	}
+	return len(f) == len(t)
+}
@@ -1,32 +1,65 @@
 package channels
 
 import (
+	"bufio"
 	"context"
+	"encoding/json"
 	"fmt"
+	"io"
 	"log"
 	"net/http"
+	"net/url"
+	"strconv"
 	"strings"
+	"sync"
 	"time"
 
 	"github.com/local/picobot/internal/chat"
+	"github.com/local/picobot/internal/config"
 )
 
+// maxSentIDs bounds the set of published message IDs remembered for echo filtering.
+const maxSentIDs = 512
+
 type NtfyChannel struct {
 	url    string
 	token  string
 	topic  string
 	client *http.Client
+
+	// IDs of messages we published, so the subscriber can skip our own
+	// echoes, and the messages being published whose ID isn't known yet,
+	// since the echo can arrive before the publish response
+	sentMu    sync.Mutex
+	sentIDs   map[string]struct{}
+	sentLog   []string
+	inFlight  map[string]int
+	allowFrom map[string]struct{} // topics whose messages reach the agent; empty allows all
+}
+
+// ntfyMessage is a single event from ntfy's JSON stream or publish response.
+type ntfyMessage struct {
+	ID       string   `json:"id"`
+	Time     int64    `json:"time"`
+	Event    string   `json:"event"` // "open", "keepalive", "message", "poll_request"
+	Topic    string   `json:"topic"`
+	Title    string   `json:"title"`
+	Message  string   `json:"message"`
+	Priority int      `json:"priority"`
+	Tags     []string `json:"tags"`
 }
 
-func StartNtfy(ctx context.Context, hub *chat.Hub, server, token string, topic string) error {
+func StartNtfy(ctx context.Context, hub *chat.Hub, cfg config.NtfyConfig) error {
+	server := cfg.Server
 	if server == "" {
 		server = "https://ntfy.sh"
 	}
-	if token == "" {
+	if cfg.Token == "" {
 		return fmt.Errorf("ntfy token not provided")
 	}
 
-	nc := NewNtfyChannel(server, token, topic)
+	nc := NewNtfyChannel(server, cfg.Token, cfg.Topic)
+	nc.allowFrom = toSet(cfg.AllowFrom)
 
 	// Start a goroutine to listen for outbound messages and send them via ntfy
 	go func() {
@@ -36,42 +69,69 @@ func StartNtfy(ctx context.Context, hub *chat.Hub, server, token string, topic s
 				log.Println("ntfy: stopping outbound sender")
 				return
 			case msg := <-hub.NtfyOut:
-				title := "Picobot"
-				if err := nc.Send(title, msg.ChatID, msg.Content); err != nil {
+				if err := nc.Publish(msg); err != nil {
 					log.Printf("ntfy: failed to send message: %v", err)
 				}
 			}
 		}
 	}()
 
-	log.Printf("ntfy channel started with topic '%s'", topic)
+	if cfg.Subscribe {
+		topics := cfg.SubscribeTopics
+		if len(topics) == 0 {
+			topics = []string{cfg.Topic}
+		}
+		if len(nc.allowFrom) == 0 {
+			log.Printf("ntfy: allowFrom is empty, anyone who can publish to %v can talk to the agent", topics)
+		}
+		go nc.subscribe(ctx, hub, topics)
+	}
+
+	log.Printf("ntfy channel started with topic '%s'", cfg.Topic)
 	return nil
 }
 
 func NewNtfyChannel(server string, token string, topic string) *NtfyChannel {
 	return &NtfyChannel{
-		url:    server,
-		token:  token,
-		topic:  topic,
-		client: &http.Client{Timeout: 10 * time.Second},
+		url:      strings.TrimRight(server, "/"),
+		token:    token,
+		topic:    topic,
+		client:   &http.Client{Timeout: 10 * time.Second},
+		sentIDs:  make(map[string]struct{}),
+		inFlight: make(map[string]int),
 	}
 }
 
 func (nc *NtfyChannel) Send(title, chatID, message string) error {
+	return nc.Publish(chat.Outbound{ChatID: chatID, Content: message, Metadata: map[string]interface{}{"title": title}})
+}
+
+// Publish sends an outbound message. The following Metadata keys are mapped to
+// ntfy publish headers: "title", "priority" (1-5 or min/low/default/high/max),
+// "tags" ([]string or comma-separated string), "click" (URL) and "actions"
+// (a list of ntfy action objects, or a string in ntfy's short action format).
+func (nc *NtfyChannel) Publish(msg chat.Outbound) error {
 	topic := nc.topic
-	if chatID != "default" {
-		topic = chatID
+	if msg.ChatID != "" && msg.ChatID != "default" {
+		topic = msg.ChatID
 	}
 	endpoint := fmt.Sprintf("%s/%s", nc.url, topic)
 
-	body := strings.NewReader(message)
+	body := strings.NewReader(msg.Content)
 	req, err := http.NewRequest("POST", endpoint, body)
 	if err != nil {
 		return err
 	}
 
 	req.Header.Set("Authorization", "Bearer "+nc.token)
-	req.Header.Set("Title", title)
+	req.Header.Set("Title", "Picobot")
+	if err := applyNtfyMetadata(req.Header, msg.Metadata); err != nil {
+		return err
+	}
+
+	key := ntfyEchoKey(topic, msg.Content)
+	nc.expect(key, 1)
+	defer nc.expect(key, -1)
 
 	// Use the custom client to do the request
 	resp, err := nc.client.Do(req)
@@ -84,5 +144,193 @@ func (nc *NtfyChannel) Send(title, chatID, message string) error {
 		return fmt.Errorf("ntfy returned status %d", resp.StatusCode)
 	}
 
+	var published ntfyMessage
+	if err := json.NewDecoder(resp.Body).Decode(&published); err == nil && published.ID != "" {
+		nc.rememberSent(published.ID)
+	}
+	return nil
+}
+
+// applyNtfyMetadata translates outbound metadata into ntfy publish headers.
+func applyNtfyMetadata(h http.Header, md map[string]interface{}) error {
+	if v, ok := md["title"].(string); ok && v != "" {
+		h.Set("Title", v)
+	}
+	switch v := md["priority"].(type) {
+	case string:
+		h.Set("Priority", v)
+	case int:
+		h.Set("Priority", strconv.Itoa(v))
+	case float64:
+		h.Set("Priority", strconv.Itoa(int(v)))
+	}
+	switch v := md["tags"].(type) {
+	case string:
+		h.Set("Tags", v)
+	case []string:
+		h.Set("Tags", strings.Join(v, ","))
+	case []interface{}:
+		tags := make([]string, 0, len(v))
+		for _, t := range v {
+			tags = append(tags, fmt.Sprint(t))
+		}
+		h.Set("Tags", strings.Join(tags, ","))
+	}
+	if v, ok := md["click"].(string); ok && v != "" {
+		h.Set("Click", v)
+	}
+	switch v := md["actions"].(type) {
+	case nil:
+	case string:
+		h.Set("Actions", v)
+	default:
+		// ntfy accepts a JSON array of action objects in the Actions header
+		b, err := json.Marshal(v)
+		if err != nil {
+			return fmt.Errorf("ntfy: invalid actions: %w", err)
+		}
+		h.Set("Actions", string(b))
+	}
 	return nil
 }
+
+// ntfyEchoKey identifies a message by topic and text, for recognizing the
+// echo of a message whose publish response hasn't arrived yet.
+func ntfyEchoKey(topic, message string) string {
+	return topic + "\x00" + message
+}
+
+// expect adds delta to the count of messages with key being published.
+func (nc *NtfyChannel) expect(key string, delta int) {
+	nc.sentMu.Lock()
+	defer nc.sentMu.Unlock()
+	if nc.inFlight[key] += delta; nc.inFlight[key] <= 0 {
+		delete(nc.inFlight, key)
+	}
+}
+
+func (nc *NtfyChannel) rememberSent(id string) {
+	nc.sentMu.Lock()
+	defer nc.sentMu.Unlock()
+	nc.rememberLocked(id)
+}
+
+func (nc *NtfyChannel) rememberLocked(id string) {
+	if _, ok := nc.sentIDs[id]; ok {
+		return
+	}
+	nc.sentIDs[id] = struct{}{}
+	nc.sentLog = append(nc.sentLog, id)
+	if len(nc.sentLog) > maxSentIDs {
+		delete(nc.sentIDs, nc.sentLog[0])
+		nc.sentLog = nc.sentLog[1:]
+	}
+}
+
+// isOwn reports whether m is the echo of a message we published: one whose
+// ID we got back, or one still being published with the same topic and text.
+func (nc *NtfyChannel) isOwn(m *ntfyMessage) bool {
+	nc.sentMu.Lock()
+	defer nc.sentMu.Unlock()
+	if _, ok := nc.sentIDs[m.ID]; ok {
+		return true
+	}
+	if key := ntfyEchoKey(m.Topic, m.Message); nc.inFlight[key] > 0 {
+		// remember the ID, the response may still be on its way
+		nc.rememberLocked(m.ID)
+		return true
+	}
+	return false
+}
+
+// subscribe streams the given topics via ntfy's JSON endpoint and forwards
+// incoming messages to the hub. Dropped connections are re-established with
+// since=<last id> so no messages are missed in between.
+func (nc *NtfyChannel) subscribe(ctx context.Context, hub *chat.Hub, topics []string) {
+	// streaming requests must not be subject to the client timeout
+	streamClient := &http.Client{}
+	since := ""
+	backoff := time.Second
+	log.Printf("ntfy: subscribing to %v", topics)
+	for {
+		select {
+		case <-ctx.Done():
+			log.Println("ntfy: stopping inbound subscriber")
+			return
+		default:
+		}
+
+		endpoint := fmt.Sprintf("%s/%s/json", nc.url, strings.Join(topics, ","))
+		if since != "" {
+			endpoint += "?since=" + url.QueryEscape(since)
+		}
+		req, err := http.NewRequestWithContext(ctx, "GET", endpoint, nil)
+		if err != nil {
+			log.Printf("ntfy: invalid subscribe request: %v", err)
+			return
+		}
+		req.Header.Set("Authorization", "Bearer "+nc.token)
+
+		resp, err := streamClient.Do(req)
+		if err == nil && resp.StatusCode != http.StatusOK {
+			io.Copy(io.Discard, resp.Body)
+			resp.Body.Close()
+			err = fmt.Errorf("status %d", resp.StatusCode)
+		}
+		if err != nil {
+			if ctx.Err() != nil {
+				continue
+			}
+			log.Printf("ntfy: subscribe error: %v (retrying in %v)", err, backoff)
+			select {
+			case <-ctx.Done():
+				continue
+			case <-time.After(backoff):
+			}
+			if backoff < 30*time.Second {
+				backoff *= 2
+			}
+			continue
+		}
+		backoff = time.Second
+
+		scanner := bufio.NewScanner(resp.Body)
+		for scanner.Scan() {
+			var m ntfyMessage
+			if err := json.Unmarshal(scanner.Bytes(), &m); err != nil {
+				log.Printf("ntfy: invalid stream event: %v", err)
+				continue
+			}
+			if m.Event != "message" {
+				continue
+			}
+			since = m.ID
+			if nc.isOwn(&m) {
+				continue
+			}
+			if len(nc.allowFrom) > 0 {
+				if _, ok := nc.allowFrom[m.Topic]; !ok {
+					log.Printf("ntfy: dropping message from topic %s, not in allowFrom", m.Topic)
+					continue
+				}
+			}
+			hub.In <- chat.Inbound{
+				Channel:   "ntfy",
+				SenderID:  m.Topic,
+				ChatID:    m.Topic,
+				Content:   m.Message,
+				Timestamp: time.Unix(m.Time, 0),
+				Metadata: map[string]interface{}{
+					"id":       m.ID,
+					"title":    m.Title,
+					"priority": m.Priority,
+					"tags":     m.Tags,
+				},
+			}
+		}
+		resp.Body.Close()
+		if err := scanner.Err(); err != nil && ctx.Err() == nil {
+			log.Printf("ntfy: stream interrupted: %v", err)
+		}
+	}
+}
@@ -32,6 +32,57 @@ func StartProxy(ctx context.Context, hub *chat.Hub) error {
 					default:
 						log.Printf("ntfy channel full, dropping message for %s", msg.ChatID)
 					}
+				case "http":
+					select {
+					case hub.HTTPOut <- msg:
+						log.Printf("proxy: forwarded message to http channel for chatID %s", msg.ChatID)
+					default:
+						log.Printf("http channel full, dropping message for %s", msg.ChatID)
+					}
+				case "web":
+					select {
+					case hub.WebOut <- msg:
+						log.Printf("proxy: forwarded message to web channel for chatID %s", msg.ChatID)
+					default:
+						log.Printf("web channel full, dropping message for %s", msg.ChatID)
+					}
+				case "matrix":
+					select {
+					case hub.MatrixOut <- msg:
+						log.Printf("proxy: forwarded message to matrix channel for chatID %s", msg.ChatID)
+					default:
+						log.Printf("matrix channel full, dropping message for %s", msg.ChatID)
+					}
+				case "email":
+					select {
+					case hub.EmailOut <- msg:
+						log.Printf("proxy: forwarded message to email channel for chatID %s", msg.ChatID)
+					default:
+						log.Printf("email channel full, dropping message for %s", msg.ChatID)
+					}
+				case "slack":
+					select {
+					case hub.SlackOut <- msg:
+						log.Printf("proxy: forwarded message to slack channel for chatID %s", msg.ChatID)
+					default:
+						log.Printf("slack channel full, dropping message for %s", msg.ChatID)
+					}
+				case "signal":
+					select {
+					case hub.SignalOut <- msg:
+						log.Printf("proxy: forwarded message to signal channel for chatID %s", msg.ChatID)
+					default:
+						log.Printf("signal channel full, dropping message for %s", msg.ChatID)
+					}
+				case "mqtt":
+					select {
+					case hub.MQTTOut <- msg:
+						log.Printf("proxy: forwarded message to mqtt channel for chatID %s", msg.ChatID)
+					default:
+						log.Printf("mqtt channel full, dropping message for %s", msg.ChatID)
+					}
+				case "heartbeat":
+					// the heartbeat delivers its results itself, see heartbeat.StartHeartbeat
 				default:
 					log.Printf("unknown channel type: %s", msg.Channel)
 				}
@@ -0,0 +1,476 @@
+package channels
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"net"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/local/picobot/internal/chat"
+	"github.com/local/picobot/internal/config"
+)
+
+// signalEnvelope is the subset of a signal-cli "receive" notification picobot uses.
+type signalEnvelope struct {
+	Source       string `json:"source"`
+	SourceNumber string `json:"sourceNumber"`
+	SourceUUID   string `json:"sourceUuid"`
+	SourceName   string `json:"sourceName"`
+	DataMessage  *struct {
+		Message   string `json:"message"`
+		GroupInfo *struct {
+			GroupID string `json:"groupId"`
+		} `json:"groupInfo"`
+		Attachments []struct {
+			ID          string `json:"id"`
+			ContentType string `json:"contentType"`
+			Filename    string `json:"filename"`
+		} `json:"attachments"`
+	} `json:"dataMessage"`
+}
+
+type rpcResponse struct {
+	ID     string          `json:"id"`
+	Method string          `json:"method"`
+	Params json.RawMessage `json:"params"`
+	Result json.RawMessage `json:"result"`
+	Error  *struct {
+		Code    int    `json:"code"`
+		Message string `json:"message"`
+	} `json:"error"`
+}
+
+// signalChannel talks JSON-RPC to a signal-cli daemon, either over its HTTP
+// interface (--http) or a socket (--socket / --tcp).
+type signalChannel struct {
+	address        string
+	account        string
+	allowed        map[string]struct{}
+	allowedGroups  map[string]struct{}
+	attachmentsDir string
+	mediaDir       string
+	httpClient     *http.Client
+
+	nextID atomic.Int64
+
+	// socket mode: the live connection and calls awaiting a response
+	mu      sync.Mutex
+	conn    net.Conn
+	pending map[string]chan rpcResponse
+
+	// socket mode: received notifications waiting for the worker, in arrival order
+	queueMu sync.Mutex
+	queue   []json.RawMessage
+	queued  chan struct{}
+}
+
+// StartSignal connects to a local signal-cli daemon. Direct conversations are
+// keyed by the sender's number, groups by "group:<groupId>" with the group ID
+// in URL-safe base64, since chat IDs name session files.
+func StartSignal(ctx context.Context, hub *chat.Hub, cfg config.SignalConfig, workspace string) error {
+	if cfg.Address == "" {
+		return fmt.Errorf("signal-cli address not provided")
+	}
+	if cfg.Account == "" {
+		return fmt.Errorf("signal account not provided")
+	}
+	if strings.HasPrefix(workspace, "~/") {
+		if home, err := os.UserHomeDir(); err == nil {
+			workspace = filepath.Join(home, workspace[2:])
+		}
+	}
+	attachmentsDir := cfg.AttachmentsDir
+	if attachmentsDir == "" {
+		if home, err := os.UserHomeDir(); err == nil {
+			attachmentsDir = filepath.Join(home, ".local", "share", "signal-cli", "attachments")
+		}
+	}
+
+	sc := &signalChannel{
+		address:        strings.TrimRight(cfg.Address, "/"),
+		account:        cfg.Account,
+		allowed:        toSet(cfg.AllowFrom),
+		allowedGroups:  toSet(cfg.AllowGroups),
+		attachmentsDir: attachmentsDir,
+		mediaDir:       filepath.Join(workspace, "media", "signal"),
+		httpClient:     &http.Client{Timeout: 30 * time.Second},
+		pending:        make(map[string]chan rpcResponse),
+		queued:         make(chan struct{}, 1),
+	}
+
+	if sc.isHTTP() {
+		go sc.httpEvents(ctx, hub)
+	} else {
+		go sc.socketLoop(ctx, hub)
+	}
+
+	go func() {
+		for {
+			select {
+			case <-ctx.Done():
+				log.Println("signal: stopping outbound sender")
+				return
+			case out := <-hub.SignalOut:
+				if err := sc.send(ctx, out); err != nil {
+					log.Printf("signal: send error: %v", err)
+				}
+			}
+		}
+	}()
+
+	log.Printf("signal channel started for %s via %s", cfg.Account, cfg.Address)
+	return nil
+}
+
+func (sc *signalChannel) isHTTP() bool {
+	return strings.HasPrefix(sc.address, "http://") || strings.HasPrefix(sc.address, "https://")
+}
+
+// call performs a JSON-RPC request and decodes its result into out (if non-nil).
+func (sc *signalChannel) call(ctx context.Context, method string, params map[string]interface{}, out interface{}) error {
+	params["account"] = sc.account
+	id := fmt.Sprintf("picobot-%d", sc.nextID.Add(1))
+	req, err := json.Marshal(map[string]interface{}{"jsonrpc": "2.0", "id": id, "method": method, "params": params})
+	if err != nil {
+		return err
+	}
+
+	var resp rpcResponse
+	if sc.isHTTP() {
+		hreq, err := http.NewRequestWithContext(ctx, "POST", sc.address+"/api/v1/rpc", bytes.NewReader(req))
+		if err != nil {
+			return err
+		}
+		hreq.Header.Set("Content-Type", "application/json")
+		hresp, err := sc.httpClient.Do(hreq)
+		if err != nil {
+			return err
+		}
+		defer hresp.Body.Close()
+		if err := json.NewDecoder(hresp.Body).Decode(&resp); err != nil {
+			return fmt.Errorf("%s: invalid response (status %d)", method, hresp.StatusCode)
+		}
+	} else {
+		ch := make(chan rpcResponse, 1)
+		sc.mu.Lock()
+		conn := sc.conn
+		if conn == nil {
+			sc.mu.Unlock()
+			return fmt.Errorf("not connected to signal-cli")
+		}
+		sc.pending[id] = ch
+		_, err := conn.Write(append(req, '\n'))
+		sc.mu.Unlock()
+		defer func() {
+			sc.mu.Lock()
+			delete(sc.pending, id)
+			sc.mu.Unlock()
+		}()
+		if err != nil {
+			return err
+		}
+		select {
+		case resp = <-ch:
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(30 * time.Second):
+			return fmt.Errorf("%s: timed out", method)
+		}
+	}
+
+	if resp.Error != nil {
+		return fmt.Errorf("%s: %s (code %d)", method, resp.Error.Message, resp.Error.Code)
+	}
+	if out != nil && len(resp.Result) > 0 {
+		return json.Unmarshal(resp.Result, out)
+	}
+	return nil
+}
+
+// socketLoop keeps a JSON-RPC socket connection to signal-cli open. Each line
+// is either a response to one of our calls or a "receive" notification.
+func (sc *signalChannel) socketLoop(ctx context.Context, hub *chat.Hub) {
+	go sc.receiveWorker(ctx, hub)
+	network, addr := "tcp", sc.address
+	if strings.HasPrefix(addr, "/") || strings.HasPrefix(addr, "unix:") {
+		network, addr = "unix", strings.TrimPrefix(addr, "unix:")
+	}
+	for {
+		select {
+		case <-ctx.Done():
+			log.Println("signal: stopping socket reader")
+			return
+		default:
+		}
+		var d net.Dialer
+		conn, err := d.DialContext(ctx, network, addr)
+		if err != nil {
+			log.Printf("signal: connect error: %v (retrying)", err)
+			time.Sleep(5 * time.Second)
+			continue
+		}
+		stop := context.AfterFunc(ctx, func() { conn.Close() })
+		sc.mu.Lock()
+		sc.conn = conn
+		sc.mu.Unlock()
+
+		scanner := bufio.NewScanner(conn)
+		scanner.Buffer(make([]byte, 64*1024), 4*1024*1024)
+		for scanner.Scan() {
+			var msg rpcResponse
+			if err := json.Unmarshal(scanner.Bytes(), &msg); err != nil {
+				continue
+			}
+			if msg.Method == "receive" {
+				// handled off the reader: fetching attachments needs it to read responses
+				sc.queueMu.Lock()
+				sc.queue = append(sc.queue, msg.Params)
+				sc.queueMu.Unlock()
+				select {
+				case sc.queued <- struct{}{}:
+				default:
+				}
+				continue
+			}
+			sc.mu.Lock()
+			ch, ok := sc.pending[msg.ID]
+			sc.mu.Unlock()
+			if ok {
+				ch <- msg
+			}
+		}
+		stop()
+		sc.mu.Lock()
+		sc.conn = nil
+		sc.mu.Unlock()
+		conn.Close()
+		if ctx.Err() == nil {
+			log.Printf("signal: connection closed, reconnecting")
+			time.Sleep(time.Second)
+		}
+	}
+}
+
+// receiveWorker handles queued notifications one at a time, so messages reach
+// the agent in the order signal-cli delivered them. The queue is unbounded
+// because the reader must never wait on it while the worker waits on a response.
+func (sc *signalChannel) receiveWorker(ctx context.Context, hub *chat.Hub) {
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-sc.queued:
+		}
+		for {
+			sc.queueMu.Lock()
+			if len(sc.queue) == 0 {
+				sc.queueMu.Unlock()
+				break
+			}
+			params := sc.queue[0]
+			sc.queue = sc.queue[1:]
+			sc.queueMu.Unlock()
+			sc.handleReceive(ctx, hub, params)
+		}
+	}
+}
+
+// httpEvents follows signal-cli's server-sent event stream of received messages.
+func (sc *signalChannel) httpEvents(ctx context.Context, hub *chat.Hub) {
+	streamClient := &http.Client{}
+	for {
+		select {
+		case <-ctx.Done():
+			log.Println("signal: stopping event stream")
+			return
+		default:
+		}
+		req, err := http.NewRequestWithContext(ctx, "GET", sc.address+"/api/v1/events", nil)
+		if err != nil {
+			log.Printf("signal: invalid events request: %v", err)
+			return
+		}
+		resp, err := streamClient.Do(req)
+		if err == nil && resp.StatusCode != http.StatusOK {
+			io.Copy(io.Discard, resp.Body)
+			resp.Body.Close()
+			err = fmt.Errorf("status %d", resp.StatusCode)
+		}
+		if err != nil {
+			if ctx.Err() == nil {
+				log.Printf("signal: event stream error: %v (retrying)", err)
+				time.Sleep(5 * time.Second)
+			}
+			continue
+		}
+		scanner := bufio.NewScanner(resp.Body)
+		scanner.Buffer(make([]byte, 64*1024), 4*1024*1024)
+		for scanner.Scan() {
+			data, ok := strings.CutPrefix(scanner.Text(), "data:")
+			if !ok {
+				continue
+			}
+			raw := json.RawMessage(strings.TrimSpace(data))
+			// events may carry the bare params or a full JSON-RPC notification
+			var wrapped rpcResponse
+			if err := json.Unmarshal(raw, &wrapped); err == nil && wrapped.Method != "" {
+				raw = wrapped.Params
+			}
+			sc.handleReceive(ctx, hub, raw)
+		}
+		resp.Body.Close()
+	}
+}
+
+func (sc *signalChannel) handleReceive(ctx context.Context, hub *chat.Hub, params json.RawMessage) {
+	var p struct {
+		Envelope signalEnvelope `json:"envelope"`
+	}
+	if err := json.Unmarshal(params, &p); err != nil {
+		return
+	}
+	env := p.Envelope
+	dm := env.DataMessage
+	if dm == nil {
+		return // receipts, typing indicators, sync messages
+	}
+	sender := env.SourceNumber
+	if sender == "" {
+		sender = env.Source
+	}
+	if sender == "" {
+		sender = env.SourceUUID
+	}
+	if sender == sc.account {
+		return
+	}
+
+	senderAllowed := len(sc.allowed) == 0
+	for _, id := range []string{env.SourceNumber, env.SourceUUID, env.Source} {
+		if _, ok := sc.allowed[id]; ok && id != "" {
+			senderAllowed = true
+		}
+	}
+
+	chatID := sender
+	content := dm.Message
+	chatType := "private"
+	metadata := map[string]interface{}{}
+	if dm.GroupInfo != nil {
+		gid := dm.GroupInfo.GroupID
+		// Groups are authorized by group ID when a group allow-list is set,
+		// otherwise the sender must pass the regular allowFrom check.
+		if len(sc.allowedGroups) > 0 {
+			if _, ok := sc.allowedGroups[gid]; !ok {
+				log.Printf("signal: dropping message from unauthorized group %s", gid)
+				return
+			}
+		} else if !senderAllowed {
+			log.Printf("signal: dropping group message from unauthorized sender %s", sender)
+			return
+		}
+		chatID = "group:" + signalGroupKey(gid)
+		name := env.SourceName
+		if name == "" {
+			name = sender
+		}
+		metadata[chat.MetaSenderName] = name
+		chatType = "group"
+	} else if !senderAllowed {
+		log.Printf("signal: dropping message from unauthorized sender %s", sender)
+		return
+	}
+
+	var media []string
+	for _, a := range dm.Attachments {
+		path, err := sc.fetchAttachment(ctx, a.ID, a.Filename, env, dm.GroupInfo != nil)
+		if err != nil {
+			log.Printf("signal: attachment %s unavailable: %v", a.ID, err)
+			continue
+		}
+		media = append(media, path)
+		content += fmt.Sprintf("\n[%s attached: %s]", a.ContentType, path)
+	}
+	if strings.TrimSpace(content) == "" {
+		return
+	}
+	metadata["chat_type"] = chatType
+
+	hub.In <- chat.Inbound{
+		Channel:   "signal",
+		SenderID:  sender,
+		ChatID:    chatID,
+		Content:   content,
+		Timestamp: time.Now(),
+		Media:     media,
+		Metadata:  metadata,
+	}
+}
+
+// fetchAttachment saves an attachment into the workspace via the getAttachment
+// RPC, falling back to signal-cli's own attachment directory.
+func (sc *signalChannel) fetchAttachment(ctx context.Context, id, filename string, env signalEnvelope, group bool) (string, error) {
+	params := map[string]interface{}{"id": id}
+	if group {
+		params["groupId"] = env.DataMessage.GroupInfo.GroupID
+	} else {
+		params["recipient"] = env.SourceNumber
+	}
+	var res struct {
+		Data string `json:"data"`
+	}
+	if err := sc.call(ctx, "getAttachment", params, &res); err == nil && res.Data != "" {
+		data, err := base64.StdEncoding.DecodeString(res.Data)
+		if err != nil {
+			return "", err
+		}
+		if err := os.MkdirAll(sc.mediaDir, 0o755); err != nil {
+			return "", err
+		}
+		name := id
+		if filename != "" {
+			name = id + "-" + filepath.Base(filename)
+		}
+		path := filepath.Join(sc.mediaDir, name)
+		return path, os.WriteFile(path, data, 0o644)
+	}
+	path := filepath.Join(sc.attachmentsDir, id)
+	if _, err := os.Stat(path); err != nil {
+		return "", err
+	}
+	return path, nil
+}
+
+// signalGroupKey turns a group ID, which is standard base64 and may contain
+// "/", into its URL-safe form for use in chat IDs.
+func signalGroupKey(gid string) string {
+	return strings.NewReplacer("+", "-", "/", "_").Replace(gid)
+}
+
+// signalGroupID undoes signalGroupKey. Group IDs given in standard base64,
+// e.g. in heartbeat.deliverTo, are returned unchanged.
+func signalGroupID(key string) string {
+	return strings.NewReplacer("-", "+", "_", "/").Replace(key)
+}
+
+func (sc *signalChannel) send(ctx context.Context, out chat.Outbound) error {
+	params := map[string]interface{}{"message": out.Content}
+	if key, ok := strings.CutPrefix(out.ChatID, "group:"); ok {
+		params["groupId"] = signalGroupID(key)
+	} else {
+		params["recipient"] = []string{out.ChatID}
+	}
+	return sc.call(ctx, "send", params, nil)
+}
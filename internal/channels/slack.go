@@ -0,0 +1,390 @@
+package channels
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"golang.org/x/net/websocket"
+
+	"github.com/local/picobot/internal/chat"
+	"github.com/local/picobot/internal/config"
+)
+
+// slackEnvelope is a Socket Mode frame.
+type slackEnvelope struct {
+	Type       string          `json:"type"` // "hello", "events_api", "interactive", "disconnect"
+	EnvelopeID string          `json:"envelope_id"`
+	Payload    json.RawMessage `json:"payload"`
+}
+
+type slackEvent struct {
+	Type        string `json:"type"` // "app_mention" or "message"
+	Subtype     string `json:"subtype"`
+	ChannelType string `json:"channel_type"`
+	Channel     string `json:"channel"`
+	User        string `json:"user"`
+	BotID       string `json:"bot_id"`
+	Text        string `json:"text"`
+	TS          string `json:"ts"`
+	ThreadTS    string `json:"thread_ts"`
+}
+
+type slackChannel struct {
+	api      string
+	appToken string
+	botToken string
+	allowed  map[string]struct{}
+	botUser  string
+	client   *http.Client
+
+	// last post per Slack channel, to stay under the ~1 message/second limit
+	mu       sync.Mutex
+	lastPost map[string]time.Time
+}
+
+// StartSlack connects to Slack via Socket Mode, so no public endpoint is
+// needed. DMs and app mentions are forwarded to the agent; each thread is its
+// own session (ChatID "<channel>:<thread_ts>") and replies go to that thread.
+// Unthreaded DMs are one session per DM (ChatID "<channel>"), answered
+// unthreaded, so a DM keeps its conversation like any other chat.
+func StartSlack(ctx context.Context, hub *chat.Hub, cfg config.SlackConfig) error {
+	if cfg.AppToken == "" || cfg.BotToken == "" {
+		return fmt.Errorf("slack appToken and botToken are required")
+	}
+	api := strings.TrimRight(cfg.APIBase, "/")
+	if api == "" {
+		api = "https://slack.com/api"
+	}
+	sc := &slackChannel{
+		api:      api,
+		appToken: cfg.AppToken,
+		botToken: cfg.BotToken,
+		allowed:  toSet(cfg.AllowFrom),
+		client:   &http.Client{Timeout: 30 * time.Second},
+		lastPost: make(map[string]time.Time),
+	}
+
+	var auth struct {
+		UserID string `json:"user_id"`
+	}
+	if err := sc.call(ctx, sc.botToken, "auth.test", nil, &auth); err != nil {
+		return fmt.Errorf("slack auth.test: %w", err)
+	}
+	sc.botUser = auth.UserID
+
+	go sc.socketLoop(ctx, hub)
+
+	go func() {
+		for {
+			select {
+			case <-ctx.Done():
+				log.Println("slack: stopping outbound sender")
+				return
+			case out := <-hub.SlackOut:
+				if err := sc.post(ctx, out); err != nil {
+					log.Printf("slack: send error: %v", err)
+				}
+			}
+		}
+	}()
+
+	log.Printf("slack channel started as %s", sc.botUser)
+	return nil
+}
+
+// call invokes a Slack Web API method. Rate-limited calls (HTTP 429) are
+// retried after the Retry-After delay Slack asks for.
+func (sc *slackChannel) call(ctx context.Context, token, method string, body, out interface{}) error {
+	var payload []byte
+	if body != nil {
+		b, err := json.Marshal(body)
+		if err != nil {
+			return err
+		}
+		payload = b
+	}
+	for attempt := 0; ; attempt++ {
+		req, err := http.NewRequestWithContext(ctx, "POST", sc.api+"/"+method, bytes.NewReader(payload))
+		if err != nil {
+			return err
+		}
+		req.Header.Set("Authorization", "Bearer "+token)
+		req.Header.Set("Content-Type", "application/json; charset=utf-8")
+		resp, err := sc.client.Do(req)
+		if err != nil {
+			return err
+		}
+		if resp.StatusCode == http.StatusTooManyRequests && attempt < 3 {
+			wait, _ := strconv.Atoi(resp.Header.Get("Retry-After"))
+			if wait <= 0 {
+				wait = 1
+			}
+			resp.Body.Close()
+			log.Printf("slack: rate limited on %s, retrying in %ds", method, wait)
+			select {
+			case <-ctx.Done():
+				return ctx.Err()
+			case <-time.After(time.Duration(wait) * time.Second):
+			}
+			continue
+		}
+		b, err := io.ReadAll(resp.Body)
+		resp.Body.Close()
+		if err != nil {
+			return err
+		}
+		var res struct {
+			Ok    bool   `json:"ok"`
+			Error string `json:"error"`
+		}
+		if err := json.Unmarshal(b, &res); err != nil {
+			return fmt.Errorf("%s: invalid response (status %d)", method, resp.StatusCode)
+		}
+		if !res.Ok {
+			return fmt.Errorf("%s: %s", method, res.Error)
+		}
+		if out != nil {
+			return json.Unmarshal(b, out)
+		}
+		return nil
+	}
+}
+
+// socketLoop keeps a Socket Mode connection open, reconnecting on disconnects.
+func (sc *slackChannel) socketLoop(ctx context.Context, hub *chat.Hub) {
+	for {
+		select {
+		case <-ctx.Done():
+			log.Println("slack: stopping socket mode")
+			return
+		default:
+		}
+		if err := sc.runSocket(ctx, hub); err != nil && ctx.Err() == nil {
+			log.Printf("slack: socket error: %v (reconnecting)", err)
+			time.Sleep(3 * time.Second)
+		}
+	}
+}
+
+func (sc *slackChannel) runSocket(ctx context.Context, hub *chat.Hub) error {
+	var open struct {
+		URL string `json:"url"`
+	}
+	if err := sc.call(ctx, sc.appToken, "apps.connections.open", nil, &open); err != nil {
+		return err
+	}
+	wsCfg, err := websocket.NewConfig(open.URL, sc.api)
+	if err != nil {
+		return err
+	}
+	conn, err := wsCfg.DialContext(ctx)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+	// unblock the read below on shutdown
+	stop := context.AfterFunc(ctx, func() { conn.Close() })
+	defer stop()
+
+	for {
+		var env slackEnvelope
+		if err := websocket.JSON.Receive(conn, &env); err != nil {
+			return err
+		}
+		if env.EnvelopeID != "" {
+			// acknowledge within 3 seconds or Slack redelivers
+			if err := websocket.JSON.Send(conn, map[string]string{"envelope_id": env.EnvelopeID}); err != nil {
+				return err
+			}
+		}
+		switch env.Type {
+		case "hello":
+			log.Println("slack: socket mode connected")
+		case "disconnect":
+			return nil
+		case "events_api":
+			var p struct {
+				Event slackEvent `json:"event"`
+			}
+			if err := json.Unmarshal(env.Payload, &p); err == nil {
+				sc.handleEvent(hub, p.Event)
+			}
+		case "interactive":
+			sc.handleInteraction(hub, env.Payload)
+		}
+	}
+}
+
+var slackMentionRE = regexp.MustCompile(`<@[A-Z0-9]+>`)
+
+func (sc *slackChannel) handleEvent(hub *chat.Hub, ev slackEvent) {
+	if ev.BotID != "" || ev.User == "" || ev.User == sc.botUser || ev.Subtype != "" {
+		return
+	}
+	switch {
+	case ev.Type == "app_mention":
+	case ev.Type == "message" && ev.ChannelType == "im":
+	default:
+		return
+	}
+	if !sc.isAllowed(ev.User) {
+		log.Printf("slack: dropping message from unauthorized user %s", ev.User)
+		return
+	}
+	text := strings.TrimSpace(slackMentionRE.ReplaceAllStringFunc(ev.Text, func(m string) string {
+		if m == "<@"+sc.botUser+">" {
+			return ""
+		}
+		return m
+	}))
+	hub.In <- chat.Inbound{
+		Channel:   "slack",
+		SenderID:  ev.User,
+		ChatID:    slackChatID(ev.Channel, ev.ThreadTS, ev.TS, ev.ChannelType == "im"),
+		Content:   text,
+		Timestamp: time.Now(),
+		Metadata:  map[string]interface{}{"ts": ev.TS, "chat_type": slackChatType(ev.Channel)},
+	}
+}
+
+// handleInteraction turns a Block Kit button click into a message from the clicking user.
+func (sc *slackChannel) handleInteraction(hub *chat.Hub, payload json.RawMessage) {
+	var p struct {
+		Type string `json:"type"`
+		User struct {
+			ID string `json:"id"`
+		} `json:"user"`
+		Container struct {
+			ChannelID string `json:"channel_id"`
+			ThreadTS  string `json:"thread_ts"`
+			MessageTS string `json:"message_ts"`
+		} `json:"container"`
+		Actions []struct {
+			Value string `json:"value"`
+		} `json:"actions"`
+	}
+	if err := json.Unmarshal(payload, &p); err != nil || p.Type != "block_actions" || len(p.Actions) == 0 {
+		return
+	}
+	if !sc.isAllowed(p.User.ID) {
+		return
+	}
+	hub.In <- chat.Inbound{
+		Channel:   "slack",
+		SenderID:  p.User.ID,
+		ChatID:    slackChatID(p.Container.ChannelID, p.Container.ThreadTS, p.Container.MessageTS, slackChatType(p.Container.ChannelID) == "im"),
+		Content:   p.Actions[0].Value,
+		Timestamp: time.Now(),
+		Metadata:  map[string]interface{}{"button": true, "chat_type": slackChatType(p.Container.ChannelID)},
+	}
+}
+
+// slackChatID is the session a message belongs to: its thread, or the thread
+// it starts, except that unthreaded DMs share one session per DM.
+func slackChatID(channel, threadTS, ts string, dm bool) string {
+	switch {
+	case threadTS != "":
+		return channel + ":" + threadTS
+	case dm:
+		return channel
+	}
+	return channel + ":" + ts
+}
+
+// slackChatType tells direct messages (channel IDs starting with D) from channels.
+func slackChatType(channelID string) string {
+	if strings.HasPrefix(channelID, "D") {
+		return "im"
+	}
+	return "channel"
+}
+
+func (sc *slackChannel) isAllowed(user string) bool {
+	if len(sc.allowed) == 0 {
+		return true
+	}
+	_, ok := sc.allowed[user]
+	return ok
+}
+
+// post sends out to its thread, pacing posts per Slack channel. Outbound
+// metadata "buttons" ([]string) renders Block Kit buttons below the text.
+func (sc *slackChannel) post(ctx context.Context, out chat.Outbound) error {
+	channel, thread, _ := strings.Cut(out.ChatID, ":")
+
+	sc.mu.Lock()
+	wait := time.Until(sc.lastPost[channel].Add(time.Second))
+	sc.lastPost[channel] = time.Now().Add(max(wait, 0))
+	sc.mu.Unlock()
+	if wait > 0 {
+		time.Sleep(wait)
+	}
+
+	text := markdownToMrkdwn(out.Content)
+	body := map[string]interface{}{"channel": channel, "text": text}
+	if thread != "" {
+		body["thread_ts"] = thread
+	}
+	if buttons, ok := out.Metadata["buttons"].([]string); ok && len(buttons) > 0 {
+		elements := make([]map[string]interface{}, 0, len(buttons))
+		for i, label := range buttons {
+			elements = append(elements, map[string]interface{}{
+				"type":      "button",
+				"action_id": fmt.Sprintf("picobot_button_%d", i),
+				"text":      map[string]string{"type": "plain_text", "text": label},
+				"value":     label,
+			})
+		}
+		body["blocks"] = []map[string]interface{}{
+			{"type": "section", "text": map[string]string{"type": "mrkdwn", "text": text}},
+			{"type": "actions", "elements": elements},
+		}
+	}
+	return sc.call(ctx, sc.botToken, "chat.postMessage", body, nil)
+}
+
+var (
+	mdCodeRE    = regexp.MustCompile("(?s)```.*?```|`[^`\n]+`")
+	mdBoldRE    = regexp.MustCompile(`\*\*(.+?)\*\*|__(.+?)__`)
+	mdItalicRE  = regexp.MustCompile(`(^|[^*\w])\*([^*\n]+)\*`)
+	mdStrikeRE  = regexp.MustCompile(`~~(.+?)~~`)
+	mdLinkRE    = regexp.MustCompile(`\[([^\]]+)\]\(([^)\s]+)\)`)
+	mdHeadingRE = regexp.MustCompile(`(?m)^#{1,6}\s+(.+)$`)
+	mdBulletRE  = regexp.MustCompile(`(?m)^(\s*)[-*]\s+`)
+)
+
+// markdownToMrkdwn converts common Markdown to Slack's mrkdwn dialect and
+// escapes &, < and >. Code spans and blocks are otherwise left untouched.
+func markdownToMrkdwn(s string) string {
+	s = strings.NewReplacer("&", "&amp;", "<", "&lt;", ">", "&gt;").Replace(s)
+	var code []string
+	s = mdCodeRE.ReplaceAllStringFunc(s, func(m string) string {
+		code = append(code, m)
+		return fmt.Sprintf("\x00%d\x00", len(code)-1)
+	})
+
+	s = mdLinkRE.ReplaceAllString(s, "<$2|$1>")
+	s = mdHeadingRE.ReplaceAllString(s, "\x01$1\x01")
+	s = mdBulletRE.ReplaceAllString(s, "$1• ")
+	s = mdBoldRE.ReplaceAllStringFunc(s, func(m string) string {
+		return "\x01" + m[2:len(m)-2] + "\x01"
+	})
+	s = mdItalicRE.ReplaceAllString(s, "${1}_${2}_")
+	s = mdStrikeRE.ReplaceAllString(s, "~$1~")
+	s = strings.ReplaceAll(s, "\x01", "*")
+
+	for i, c := range code {
+		s = strings.Replace(s, fmt.Sprintf("\x00%d\x00", i), c, 1)
+	}
+	return s
+}
@@ -0,0 +1,185 @@
+package channels
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"golang.org/x/net/websocket"
+
+	"github.com/local/picobot/internal/chat"
+	"github.com/local/picobot/internal/config"
+)
+
+// fakeSlack is a local stand-in for the Slack Web API and a Socket Mode
+// server. Envelopes written to events are sent to the connected client;
+// acknowledged envelope IDs and chat.postMessage bodies are recorded.
+type fakeSlack struct {
+	srv    *httptest.Server
+	events chan slackEnvelope
+	acks   chan string
+	posts  chan map[string]interface{}
+}
+
+func newFakeSlack(t *testing.T) *fakeSlack {
+	f := &fakeSlack{
+		events: make(chan slackEnvelope, 8),
+		acks:   make(chan string, 8),
+		posts:  make(chan map[string]interface{}, 8),
+	}
+	mux := http.NewServeMux()
+	mux.HandleFunc("POST /auth.test", func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Authorization") != "Bearer xoxb-test" {
+			json.NewEncoder(w).Encode(map[string]interface{}{"ok": false, "error": "invalid_auth"})
+			return
+		}
+		json.NewEncoder(w).Encode(map[string]interface{}{"ok": true, "user_id": "UBOT"})
+	})
+	mux.HandleFunc("POST /apps.connections.open", func(w http.ResponseWriter, r *http.Request) {
+		url := "ws" + strings.TrimPrefix(f.srv.URL, "http") + "/socket"
+		json.NewEncoder(w).Encode(map[string]interface{}{"ok": true, "url": url})
+	})
+	mux.HandleFunc("POST /chat.postMessage", func(w http.ResponseWriter, r *http.Request) {
+		var body map[string]interface{}
+		json.NewDecoder(r.Body).Decode(&body)
+		f.posts <- body
+		json.NewEncoder(w).Encode(map[string]interface{}{"ok": true})
+	})
+	mux.Handle("/socket", websocket.Handler(func(conn *websocket.Conn) {
+		if err := websocket.JSON.Send(conn, slackEnvelope{Type: "hello"}); err != nil {
+			return
+		}
+		go func() {
+			for {
+				var ack struct {
+					EnvelopeID string `json:"envelope_id"`
+				}
+				if err := websocket.JSON.Receive(conn, &ack); err != nil {
+					return
+				}
+				f.acks <- ack.EnvelopeID
+			}
+		}()
+		for env := range f.events {
+			if err := websocket.JSON.Send(conn, env); err != nil {
+				return
+			}
+		}
+	}))
+	f.srv = httptest.NewServer(mux)
+	t.Cleanup(func() {
+		close(f.events)
+		f.srv.Close()
+	})
+	return f
+}
+
+// send delivers a message event to the client.
+func (f *fakeSlack) send(id string, ev slackEvent) {
+	payload, _ := json.Marshal(map[string]interface{}{"event": ev})
+	f.events <- slackEnvelope{Type: "events_api", EnvelopeID: id, Payload: payload}
+}
+
+func TestSlackSocketMode(t *testing.T) {
+	f := newFakeSlack(t)
+	hub := chat.NewHub(8)
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	err := StartSlack(ctx, hub, config.SlackConfig{
+		Enabled:   true,
+		AppToken:  "xapp-test",
+		BotToken:  "xoxb-test",
+		AllowFrom: []string{"U1"},
+		APIBase:   f.srv.URL,
+	})
+	if err != nil {
+		t.Fatalf("StartSlack: %v", err)
+	}
+
+	receive := func() chat.Inbound {
+		t.Helper()
+		select {
+		case in := <-hub.In:
+			return in
+		case <-time.After(5 * time.Second):
+			t.Fatal("no inbound message")
+		}
+		return chat.Inbound{}
+	}
+
+	tests := []struct {
+		name   string
+		ev     slackEvent
+		chatID string
+		text   string
+	}{
+		{
+			name:   "unthreaded DM is keyed by channel",
+			ev:     slackEvent{Type: "message", ChannelType: "im", Channel: "D1", User: "U1", Text: "hi", TS: "1.1"},
+			chatID: "D1",
+			text:   "hi",
+		},
+		{
+			name:   "threaded DM is keyed by thread",
+			ev:     slackEvent{Type: "message", ChannelType: "im", Channel: "D1", User: "U1", Text: "in thread", TS: "1.3", ThreadTS: "1.2"},
+			chatID: "D1:1.2",
+			text:   "in thread",
+		},
+		{
+			name:   "mention starts a thread",
+			ev:     slackEvent{Type: "app_mention", ChannelType: "channel", Channel: "C1", User: "U1", Text: "<@UBOT> status?", TS: "2.1"},
+			chatID: "C1:2.1",
+			text:   "status?",
+		},
+	}
+	for i, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			id := "env-" + tt.ev.TS
+			f.send(id, tt.ev)
+			in := receive()
+			if in.ChatID != tt.chatID || in.Content != tt.text || in.SenderID != "U1" {
+				t.Errorf("got chat %q content %q sender %q, want chat %q content %q", in.ChatID, in.Content, in.SenderID, tt.chatID, tt.text)
+			}
+			select {
+			case ack := <-f.acks:
+				if ack != id {
+					t.Errorf("acknowledged %q, want %q", ack, id)
+				}
+			case <-time.After(5 * time.Second):
+				t.Errorf("envelope %d not acknowledged", i)
+			}
+		})
+	}
+
+	// messages from users not in allowFrom, and the bot's own, are dropped
+	f.send("env-x", slackEvent{Type: "message", ChannelType: "im", Channel: "D2", User: "U2", Text: "let me in", TS: "3.1"})
+	f.send("env-y", slackEvent{Type: "message", ChannelType: "im", Channel: "D1", User: "UBOT", Text: "echo", TS: "3.2"})
+	f.send("env-z", slackEvent{Type: "message", ChannelType: "im", Channel: "D1", User: "U1", Text: "after", TS: "3.3"})
+	if in := receive(); in.Content != "after" {
+		t.Errorf("got %q, want only the allowed user's message", in.Content)
+	}
+
+	for _, tt := range []struct {
+		chatID string
+		thread interface{}
+	}{
+		{"D1", nil},
+		{"C1:2.1", "2.1"},
+	} {
+		hub.SlackOut <- chat.Outbound{Channel: "slack", ChatID: tt.chatID, Content: "**done**"}
+		select {
+		case body := <-f.posts:
+			channel, _, _ := strings.Cut(tt.chatID, ":")
+			if body["channel"] != channel || body["thread_ts"] != tt.thread || body["text"] != "*done*" {
+				t.Errorf("reply to %s posted %v", tt.chatID, body)
+			}
+		case <-time.After(5 * time.Second):
+			t.Fatalf("reply to %s not posted", tt.chatID)
+		}
+	}
+}
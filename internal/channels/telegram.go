@@ -8,11 +8,15 @@ import (
 	"log"
 	"net/http"
 	"net/url"
+	"regexp"
 	"strconv"
+	"strings"
 	"sync"
 	"time"
 
 	"github.com/local/picobot/internal/chat"
+	"github.com/local/picobot/internal/config"
+	"github.com/local/picobot/internal/pairing"
 )
 
 var (
@@ -22,31 +26,193 @@ var (
 
 // StartTelegram is a convenience wrapper that uses the real polling implementation
 // with the standard Telegram base URL.
-// allowFrom is a list of Telegram user IDs permitted to interact with the bot.
+// cfg.AllowFrom is a list of Telegram user IDs permitted to interact with the bot.
 // If empty, ALL users are allowed (open mode).
-func StartTelegram(ctx context.Context, hub *chat.Hub, token string, allowFrom []string) error {
-	if token == "" {
+func StartTelegram(ctx context.Context, hub *chat.Hub, cfg config.TelegramConfig) error {
+	if cfg.Token == "" {
 		return fmt.Errorf("telegram token not provided")
 	}
-	base := "https://api.telegram.org/bot" + token
-	return StartTelegramWithBase(ctx, hub, token, base, allowFrom)
+	base := "https://api.telegram.org/bot" + cfg.Token
+	return StartTelegramWithBase(ctx, hub, base, cfg)
+}
+
+// telegramUser is the subset of the Telegram User object picobot cares about.
+type telegramUser struct {
+	ID        int64  `json:"id"`
+	IsBot     bool   `json:"is_bot"`
+	FirstName string `json:"first_name"`
+	LastName  string `json:"last_name"`
+	Username  string `json:"username"`
+}
+
+// displayName returns a human readable name for sender attribution.
+func (u *telegramUser) displayName() string {
+	name := strings.TrimSpace(u.FirstName + " " + u.LastName)
+	if name == "" {
+		name = u.Username
+	}
+	if name == "" {
+		name = strconv.FormatInt(u.ID, 10)
+	}
+	return name
+}
+
+type telegramEntity struct {
+	Type   string        `json:"type"`
+	Offset int           `json:"offset"`
+	Length int           `json:"length"`
+	User   *telegramUser `json:"user,omitempty"`
+}
+
+type telegramMessage struct {
+	MessageID int64         `json:"message_id"`
+	From      *telegramUser `json:"from"`
+	Chat      struct {
+		ID    int64  `json:"id"`
+		Type  string `json:"type"` // "private", "group", "supergroup" or "channel"
+		Title string `json:"title"`
+	} `json:"chat"`
+	Text           string           `json:"text"`
+	Entities       []telegramEntity `json:"entities"`
+	ReplyToMessage *telegramMessage `json:"reply_to_message"`
+}
+
+// isGroup reports whether the message was sent in a group or supergroup.
+func (m *telegramMessage) isGroup() bool {
+	return m.Chat.Type == "group" || m.Chat.Type == "supergroup"
+}
+
+// telegramBot is the bot's own identity, from getMe.
+type telegramBot struct {
+	telegramUser
+	mention *regexp.Regexp // "@username" as a word, nil without a username
+}
+
+func newTelegramBot(u telegramUser) *telegramBot {
+	b := &telegramBot{telegramUser: u}
+	if u.Username != "" {
+		b.mention = regexp.MustCompile(`(?i)@` + regexp.QuoteMeta(u.Username) + `\b`)
+	}
+	return b
+}
+
+// telegramGetMe resolves the bot's identity.
+func telegramGetMe(client *http.Client, base string) (*telegramBot, error) {
+	resp, err := client.PostForm(base+"/getMe", url.Values{})
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	var me struct {
+		Ok     bool         `json:"ok"`
+		Result telegramUser `json:"result"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&me); err != nil || !me.Ok {
+		return nil, fmt.Errorf("invalid getMe response")
+	}
+	return newTelegramBot(me.Result), nil
+}
+
+// addressedTo reports whether a group message is meant for the bot: it mentions
+// the bot, replies to one of the bot's messages, or is a command (optionally
+// suffixed with @botname). The returned text has the bot mention stripped.
+// While the bot's identity is unknown (bot is nil) only commands without a
+// @botname suffix are accepted.
+func (m *telegramMessage) addressedTo(bot *telegramBot) (bool, string) {
+	text := m.Text
+	if strings.HasPrefix(text, "/") {
+		cmd := strings.Fields(text)[0]
+		if at := strings.Index(cmd, "@"); at != -1 {
+			// command addressed to a specific bot; only accept our own
+			return bot != nil && strings.EqualFold(cmd[at+1:], bot.Username), text
+		}
+		return true, text
+	}
+	if bot == nil {
+		return false, text
+	}
+	if m.ReplyToMessage != nil && m.ReplyToMessage.From != nil && m.ReplyToMessage.From.ID == bot.ID {
+		return true, text
+	}
+	// Entity offsets are in UTF-16 code units; match mentions by text instead.
+	for _, e := range m.Entities {
+		switch e.Type {
+		case "text_mention":
+			if e.User != nil && e.User.ID == bot.ID {
+				return true, text
+			}
+		case "mention":
+			if bot.mention != nil && bot.mention.MatchString(text) {
+				return true, strings.TrimSpace(bot.mention.ReplaceAllString(text, ""))
+			}
+		}
+	}
+	return false, text
 }
 
 // StartTelegramWithBase starts long-polling against the given base URL (e.g., https://api.telegram.org/bot<TOKEN> or a test server URL).
-// allowFrom restricts which Telegram user IDs may send messages. Empty means allow all.
-func StartTelegramWithBase(ctx context.Context, hub *chat.Hub, token, base string, allowFrom []string) error {
+// cfg.AllowFrom restricts which Telegram user IDs may send messages. Empty means allow all.
+// In group chats the bot only reacts when mentioned, replied to or addressed with a
+// command; cfg.AllowGroups and cfg.GroupAdmins restrict which groups and members may do so.
+func StartTelegramWithBase(ctx context.Context, hub *chat.Hub, base string, cfg config.TelegramConfig) error {
 	if base == "" {
 		return fmt.Errorf("base URL is required")
 	}
 
-	// Build a fast lookup set for allowed user IDs.
-	allowed := make(map[string]struct{}, len(allowFrom))
-	for _, id := range allowFrom {
-		allowed[id] = struct{}{}
+	// Build fast lookup sets for allowed user and group IDs.
+	allowed := toSet(cfg.AllowFrom)
+	allowedGroups := toSet(cfg.AllowGroups)
+	groupAdmins := toSet(cfg.GroupAdmins)
+
+	// With pairing, unknown users can ask for access; the users in allowFrom
+	// approve them and approved IDs go into the runtime allow-list file.
+	var pairs *pairing.Store
+	if cfg.Pairing {
+		if len(allowed) == 0 {
+			log.Printf("telegram: pairing needs at least one owner in allowFrom, disabling it")
+		} else {
+			pairs = pairing.Open(pairing.DefaultPath())
+		}
+	}
+	isAllowed := func(id string) bool {
+		if len(allowed) == 0 {
+			return true
+		}
+		if _, ok := allowed[id]; ok {
+			return true
+		}
+		return pairs != nil && pairs.IsPaired("telegram", id)
+	}
+	reply := func(chatID, text string) {
+		select {
+		case hub.TelegramOut <- chat.Outbound{Channel: "telegram", ChatID: chatID, Content: text}:
+		default:
+			log.Printf("telegram channel full, dropping message for %s", chatID)
+		}
 	}
 
 	client := &http.Client{Timeout: 45 * time.Second}
 
+	// Resolve the bot's own identity so group mentions and replies can be
+	// detected. If that fails, the poller retries now and then; until it
+	// succeeds, groups only get to use commands.
+	var bot *telegramBot
+	var lastGetMe time.Time
+	resolveBot := func() {
+		if bot != nil || time.Since(lastGetMe) < time.Minute {
+			return
+		}
+		lastGetMe = time.Now()
+		b, err := telegramGetMe(client, base)
+		if err != nil {
+			log.Printf("telegram getMe error: %v (groups can only use commands until it succeeds)", err)
+			return
+		}
+		bot = b
+		log.Printf("telegram: running as @%s", bot.Username)
+	}
+	resolveBot()
+
 	sendTyping := func(chatID string) {
 		u := base + "/sendChatAction"
 		v := url.Values{}
@@ -68,6 +234,13 @@ func StartTelegramWithBase(ctx context.Context, hub *chat.Hub, token, base strin
 			select {
 			case <-ctx.Done():
 				log.Println("telegram: stopping inbound polling")
+				// Confirm the updates handled so far, so a poller started
+				// after a config reload doesn't receive them again.
+				if offset > 0 {
+					if resp, err := client.PostForm(base+"/getUpdates", url.Values{"offset": {strconv.FormatInt(offset, 10)}, "timeout": {"0"}}); err == nil {
+						resp.Body.Close()
+					}
+				}
 				// Stop all typing indicators
 				typingMutex.Lock()
 				for _, stopCh := range typingStops {
@@ -79,12 +252,18 @@ func StartTelegramWithBase(ctx context.Context, hub *chat.Hub, token, base strin
 			default:
 			}
 
+			resolveBot()
 			values := url.Values{}
 			values.Set("offset", strconv.FormatInt(offset, 10))
 			values.Set("timeout", "30")
 			u := base + "/getUpdates"
-			resp, err := client.PostForm(u, values)
+			req, _ := http.NewRequestWithContext(ctx, http.MethodPost, u, strings.NewReader(values.Encode()))
+			req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+			resp, err := client.Do(req)
 			if err != nil {
+				if ctx.Err() != nil {
+					continue
+				}
 				log.Printf("telegram getUpdates error: %v", err)
 				time.Sleep(1 * time.Second)
 				continue
@@ -94,17 +273,8 @@ func StartTelegramWithBase(ctx context.Context, hub *chat.Hub, token, base strin
 			var gu struct {
 				Ok     bool `json:"ok"`
 				Result []struct {
-					UpdateID int64 `json:"update_id"`
-					Message  *struct {
-						MessageID int64 `json:"message_id"`
-						From      *struct {
-							ID int64 `json:"id"`
-						} `json:"from"`
-						Chat struct {
-							ID int64 `json:"id"`
-						} `json:"chat"`
-						Text string `json:"text"`
-					} `json:"message"`
+					UpdateID int64            `json:"update_id"`
+					Message  *telegramMessage `json:"message"`
 				} `json:"result"`
 			}
 			if err := json.Unmarshal(body, &gu); err != nil {
@@ -123,20 +293,66 @@ func StartTelegramWithBase(ctx context.Context, hub *chat.Hub, token, base strin
 				if m.From != nil {
 					fromID = strconv.FormatInt(m.From.ID, 10)
 				}
-				// Enforce allowFrom: if the list is non-empty, reject unknown senders.
-				if len(allowed) > 0 {
-					if _, ok := allowed[fromID]; !ok {
-						log.Printf("telegram: dropping message from unauthorized user %s", fromID)
+				chatID := strconv.FormatInt(m.Chat.ID, 10)
+				content := m.Text
+				metadata := map[string]interface{}{
+					"chat_type":  m.Chat.Type,
+					"message_id": m.MessageID,
+				}
+				if m.isGroup() {
+					// Groups are authorized by group ID when a group allow-list is set,
+					// otherwise the sender must pass the regular allowFrom check.
+					if len(allowedGroups) > 0 {
+						if _, ok := allowedGroups[chatID]; !ok {
+							log.Printf("telegram: dropping message from unauthorized group %s", chatID)
+							continue
+						}
+					} else if !isAllowed(fromID) {
+						log.Printf("telegram: dropping group message from unauthorized user %s", fromID)
+						continue
+					}
+					if len(groupAdmins) > 0 {
+						if _, ok := groupAdmins[fromID]; !ok {
+							log.Printf("telegram: dropping group message from non-admin user %s", fromID)
+							continue
+						}
+					}
+					addressed, text := m.addressedTo(bot)
+					if !addressed {
+						continue
+					}
+					// The agent attributes the sender so the shared group history stays readable.
+					sender := fromID
+					if m.From != nil {
+						sender = m.From.displayName()
+					}
+					content = text
+					metadata["group_title"] = m.Chat.Title
+					metadata[chat.MetaSenderName] = sender
+				} else {
+					if _, owner := allowed[fromID]; owner && pairs != nil {
+						if text, handled := telegramPairingCommand(pairs, m.Text, fromID, reply); handled {
+							reply(chatID, text)
+							continue
+						}
+					}
+					// Enforce allowFrom (plus paired users): if the list is non-empty, reject unknown senders.
+					if !isAllowed(fromID) {
+						if pairs != nil && m.From != nil {
+							requestPairing(pairs, m.From, chatID, allowed, reply)
+						} else {
+							log.Printf("telegram: dropping message from unauthorized user %s", fromID)
+						}
 						continue
 					}
 				}
-				chatID := strconv.FormatInt(m.Chat.ID, 10)
 				hub.In <- chat.Inbound{
 					Channel:   "telegram",
 					SenderID:  fromID,
 					ChatID:    chatID,
-					Content:   m.Text,
+					Content:   content,
 					Timestamp: time.Now(),
+					Metadata:  metadata,
 				}
 				// Start typing indicator
 				typingMutex.Lock()
@@ -202,3 +418,98 @@ func StartTelegramWithBase(ctx context.Context, hub *chat.Hub, token, base strin
 
 	return nil
 }
+
+// toSet builds a lookup set from a list of IDs.
+func toSet(ids []string) map[string]struct{} {
+	set := make(map[string]struct{}, len(ids))
+	for _, id := range ids {
+		set[id] = struct{}{}
+	}
+	return set
+}
+
+// requestPairing hands an unknown private-chat user a pairing code and tells
+// the owners (the users in allowFrom) how to approve it.
+func requestPairing(pairs *pairing.Store, from *telegramUser, chatID string, owners map[string]struct{}, reply func(chatID, text string)) {
+	fromID := strconv.FormatInt(from.ID, 10)
+	code, isNew, err := pairs.Request("telegram", fromID, chatID, from.displayName())
+	if err != nil {
+		log.Printf("telegram: pairing request from %s failed: %v", fromID, err)
+		return
+	}
+	if !isNew {
+		// already told; don't answer every message with the same code
+		return
+	}
+	log.Printf("telegram: pairing code %s issued to %s (%s)", code, from.displayName(), fromID)
+	reply(chatID, fmt.Sprintf("Hi! I don't know you yet. Ask my owner to approve pairing code %s. It is valid for %d minutes.", code, int(pairing.CodeTTL.Minutes())))
+	for owner := range owners {
+		reply(owner, fmt.Sprintf("%s (%s) wants to talk to me. Reply \"/approve %s\" to allow it, or run: picobot pairing approve %s", from.displayName(), fromID, code, code))
+	}
+}
+
+// telegramPairingCommand handles the owner commands /approve <code>,
+// /revoke <user id> and /pairing. It returns the answer for the owner and
+// whether text was such a command.
+func telegramPairingCommand(pairs *pairing.Store, text, ownerID string, reply func(chatID, text string)) (string, bool) {
+	fields := strings.Fields(text)
+	if len(fields) == 0 {
+		return "", false
+	}
+	cmd := strings.ToLower(fields[0])
+	if at := strings.Index(cmd, "@"); at != -1 {
+		cmd = cmd[:at]
+	}
+	switch cmd {
+	case "/approve":
+		if len(fields) != 2 {
+			return "Usage: /approve <code>", true
+		}
+		req, err := pairs.Approve(fields[1], "telegram:"+ownerID)
+		if err != nil {
+			return err.Error(), true
+		}
+		log.Printf("telegram: %s approved pairing of %s", ownerID, req.SenderID)
+		reply(req.ChatID, "You've been approved. Say hello!")
+		return fmt.Sprintf("Approved %s (%s).", req.Name, req.SenderID), true
+	case "/revoke":
+		if len(fields) != 2 {
+			return "Usage: /revoke <user id>", true
+		}
+		ok, err := pairs.Revoke("telegram", fields[1])
+		if err != nil {
+			return err.Error(), true
+		}
+		if !ok {
+			return fmt.Sprintf("%s is not a paired user.", fields[1]), true
+		}
+		log.Printf("telegram: %s revoked pairing of %s", ownerID, fields[1])
+		return fmt.Sprintf("Revoked %s.", fields[1]), true
+	case "/pairing":
+		pending, paired, err := pairs.List()
+		if err != nil {
+			return err.Error(), true
+		}
+		var sb strings.Builder
+		sb.WriteString("Pending requests:\n")
+		if len(pending) == 0 {
+			sb.WriteString("  none\n")
+		}
+		for _, r := range pending {
+			if r.Channel == "telegram" {
+				fmt.Fprintf(&sb, "  %s  %s (%s)\n", r.Code, r.Name, r.SenderID)
+			}
+		}
+		sb.WriteString("Paired users:\n")
+		if len(paired) == 0 {
+			sb.WriteString("  none\n")
+		}
+		for _, p := range paired {
+			if p.Channel == "telegram" {
+				fmt.Fprintf(&sb, "  %s (%s), since %s\n", p.Name, p.SenderID, p.Approved.Format("2006-01-02"))
+			}
+		}
+		return strings.TrimSpace(sb.String()), true
+	}
+	return "", false
+}
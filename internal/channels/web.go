@@ -0,0 +1,275 @@
+package channels
+
+import (
+	"context"
+	"crypto/subtle"
+	"encoding/json"
+	"fmt"
+	"io/fs"
+	"log"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"golang.org/x/net/websocket"
+
+	"github.com/local/picobot/embeds"
+	"github.com/local/picobot/internal/agent/memory"
+	"github.com/local/picobot/internal/agent/skills"
+	"github.com/local/picobot/internal/chat"
+	"github.com/local/picobot/internal/config"
+	"github.com/local/picobot/internal/cron"
+	"github.com/local/picobot/internal/session"
+)
+
+// webEvent is the JSON frame exchanged with the browser over the WebSocket.
+type webEvent struct {
+	Type     string             `json:"type"` // client: "message", "switch"; server: "message", "trace", "history", "error"
+	Session  string             `json:"session,omitempty"`
+	Content  string             `json:"content,omitempty"`
+	Final    bool               `json:"final,omitempty"`
+	Trace    *chat.ToolTrace    `json:"trace,omitempty"`
+	Messages []*session.Message `json:"messages,omitempty"`
+}
+
+// webClient is one browser connection, attached to a single session at a time.
+type webClient struct {
+	conn    *websocket.Conn
+	mu      sync.Mutex // serializes writes
+	session string
+}
+
+func (c *webClient) send(ev webEvent) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return websocket.JSON.Send(c.conn, ev)
+}
+
+type webChannel struct {
+	hub       *chat.Hub
+	token     string
+	workspace string
+	scheduler *cron.Scheduler
+
+	mu      sync.Mutex
+	clients map[*webClient]struct{}
+}
+
+// StartWeb serves the embedded web chat UI on cfg.Listen. Chat runs over a
+// WebSocket at /ws; the REST endpoints under /api expose sessions, long-term
+// memory, skills and cron jobs. Everything except the static assets requires
+// cfg.Token. scheduler may be nil.
+func StartWeb(ctx context.Context, hub *chat.Hub, cfg config.WebConfig, workspace string, scheduler *cron.Scheduler) error {
+	if cfg.Token == "" {
+		return fmt.Errorf("web token not provided")
+	}
+	listen := cfg.Listen
+	if listen == "" {
+		listen = "127.0.0.1:8089"
+	}
+	if strings.HasPrefix(workspace, "~/") {
+		if home, err := os.UserHomeDir(); err == nil {
+			workspace = filepath.Join(home, workspace[2:])
+		}
+	}
+
+	wc := &webChannel{hub: hub, token: cfg.Token, workspace: workspace, scheduler: scheduler, clients: make(map[*webClient]struct{})}
+
+	go func() {
+		for {
+			select {
+			case <-ctx.Done():
+				log.Println("web: stopping outbound dispatcher")
+				return
+			case out := <-hub.WebOut:
+				wc.broadcast(out)
+			}
+		}
+	}()
+
+	static, err := fs.Sub(embeds.Web, "web")
+	if err != nil {
+		return err
+	}
+	mux := http.NewServeMux()
+	mux.Handle("GET /", http.FileServerFS(static))
+	mux.Handle("GET /ws", wc.requireToken(websocket.Handler(wc.serveWS), true))
+	mux.Handle("GET /api/sessions", wc.requireToken(http.HandlerFunc(wc.handleSessions), false))
+	mux.Handle("GET /api/sessions/{id}", wc.requireToken(http.HandlerFunc(wc.handleSession), false))
+	mux.Handle("GET /api/memory", wc.requireToken(http.HandlerFunc(wc.handleMemory), false))
+	mux.Handle("GET /api/skills", wc.requireToken(http.HandlerFunc(wc.handleSkills), false))
+	mux.Handle("GET /api/cron", wc.requireToken(http.HandlerFunc(wc.handleCron), false))
+
+	srv := &http.Server{Addr: listen, Handler: mux}
+	if err := serve(ctx, "web", srv); err != nil {
+		return err
+	}
+
+	log.Printf("web UI listening on http://%s", listen)
+	return nil
+}
+
+// requireToken accepts the token as a bearer header or, if inQuery is set,
+// as a ?token= query parameter. Only the WebSocket, where browsers can't set
+// headers, takes it in the query, which ends up in logs and history.
+func (wc *webChannel) requireToken(next http.Handler, inQuery bool) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		got, _ := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+		if got == "" && inQuery {
+			got = r.URL.Query().Get("token")
+		}
+		if subtle.ConstantTimeCompare([]byte(got), []byte(wc.token)) != 1 {
+			writeJSONError(w, http.StatusUnauthorized, "invalid or missing token")
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// broadcast delivers an outbound message to every client viewing its session.
+func (wc *webChannel) broadcast(out chat.Outbound) {
+	ev := webEvent{Type: "message", Session: out.ChatID, Content: out.Content, Final: isFinal(out)}
+	if tr, ok := out.Metadata[chat.MetaTrace].(chat.ToolTrace); ok {
+		ev = webEvent{Type: "trace", Session: out.ChatID, Trace: &tr}
+	}
+	wc.mu.Lock()
+	targets := make([]*webClient, 0, len(wc.clients))
+	for c := range wc.clients {
+		if c.session == out.ChatID {
+			targets = append(targets, c)
+		}
+	}
+	wc.mu.Unlock()
+	if len(targets) == 0 {
+		log.Printf("web: no client viewing session %s, dropping message", out.ChatID)
+	}
+	for _, c := range targets {
+		if err := c.send(ev); err != nil {
+			log.Printf("web: send failed: %v", err)
+		}
+	}
+}
+
+func (wc *webChannel) serveWS(conn *websocket.Conn) {
+	c := &webClient{conn: conn, session: "default"}
+	wc.mu.Lock()
+	wc.clients[c] = struct{}{}
+	wc.mu.Unlock()
+	defer func() {
+		wc.mu.Lock()
+		delete(wc.clients, c)
+		wc.mu.Unlock()
+		conn.Close()
+	}()
+
+	for {
+		var ev webEvent
+		if err := websocket.JSON.Receive(conn, &ev); err != nil {
+			return
+		}
+		switch ev.Type {
+		case "switch":
+			name := sanitizeSessionName(ev.Session)
+			wc.mu.Lock()
+			c.session = name
+			wc.mu.Unlock()
+			c.send(webEvent{Type: "history", Session: name, Messages: wc.loadHistory(name)})
+		case "message":
+			if strings.TrimSpace(ev.Content) == "" {
+				continue
+			}
+			wc.mu.Lock()
+			name := c.session
+			wc.mu.Unlock()
+			wc.hub.In <- chat.Inbound{
+				Channel:   "web",
+				SenderID:  "web",
+				ChatID:    name,
+				Content:   ev.Content,
+				Timestamp: time.Now(),
+				Metadata:  map[string]interface{}{chat.MetaTrace: true},
+			}
+		default:
+			c.send(webEvent{Type: "error", Content: "unknown event type " + ev.Type})
+		}
+	}
+}
+
+// sanitizeSessionName keeps session names safe to use as file names.
+func sanitizeSessionName(name string) string {
+	name = strings.Map(func(r rune) rune {
+		switch {
+		case r >= 'a' && r <= 'z', r >= 'A' && r <= 'Z', r >= '0' && r <= '9', r == '-', r == '_':
+			return r
+		}
+		return -1
+	}, name)
+	if name == "" {
+		return "default"
+	}
+	return name
+}
+
+// loadHistory reads a web session's history from the workspace sessions dir.
+func (wc *webChannel) loadHistory(name string) []*session.Message {
+	b, err := os.ReadFile(filepath.Join(wc.workspace, "sessions", "web:"+name+".json"))
+	if err != nil {
+		return nil
+	}
+	var s session.Session
+	if err := json.Unmarshal(b, &s); err != nil {
+		return nil
+	}
+	return s.History
+}
+
+func (wc *webChannel) handleSessions(w http.ResponseWriter, r *http.Request) {
+	names := []string{}
+	entries, _ := os.ReadDir(filepath.Join(wc.workspace, "sessions"))
+	for _, e := range entries {
+		n := e.Name()
+		if strings.HasPrefix(n, "web:") && strings.HasSuffix(n, ".json") {
+			names = append(names, strings.TrimSuffix(strings.TrimPrefix(n, "web:"), ".json"))
+		}
+	}
+	sort.Strings(names)
+	writeJSON(w, http.StatusOK, map[string]interface{}{"sessions": names})
+}
+
+func (wc *webChannel) handleSession(w http.ResponseWriter, r *http.Request) {
+	name := sanitizeSessionName(r.PathValue("id"))
+	writeJSON(w, http.StatusOK, map[string]interface{}{"session": name, "messages": wc.loadHistory(name)})
+}
+
+func (wc *webChannel) handleMemory(w http.ResponseWriter, r *http.Request) {
+	mem := memory.NewMemoryStoreWithWorkspace(wc.workspace, 100)
+	long, err := mem.ReadLongTerm()
+	if err != nil {
+		writeJSONError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	today, _ := mem.ReadToday()
+	writeJSON(w, http.StatusOK, map[string]string{"long": long, "today": today})
+}
+
+func (wc *webChannel) handleSkills(w http.ResponseWriter, r *http.Request) {
+	loaded, err := skills.NewLoader(wc.workspace).LoadAll()
+	if err != nil {
+		writeJSONError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	writeJSON(w, http.StatusOK, map[string]interface{}{"skills": loaded})
+}
+
+func (wc *webChannel) handleCron(w http.ResponseWriter, r *http.Request) {
+	jobs := []cron.Job{}
+	if wc.scheduler != nil {
+		jobs = wc.scheduler.List()
+	}
+	sort.Slice(jobs, func(i, j int) bool { return jobs[i].FireAt.Before(jobs[j].FireAt) })
+	writeJSON(w, http.StatusOK, map[string]interface{}{"jobs": jobs})
+}
@@ -0,0 +1,174 @@
+package channels
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"strings"
+	"text/template"
+	"time"
+
+	"github.com/local/picobot/internal/chat"
+	"github.com/local/picobot/internal/config"
+)
+
+// defaultWebhookTemplate is used for hooks without a template of their own.
+const defaultWebhookTemplate = "A webhook event arrived. Summarize it for the user and point out anything that needs attention.\n\n```json\n{{json .}}\n```"
+
+// webhookQueueWait is how long a request waits for room in the agent's queue
+// before it is answered with 503.
+const webhookQueueWait = 2 * time.Second
+
+type webhook struct {
+	cfg  config.WebhookConfig
+	tmpl *template.Template
+}
+
+// StartWebhooks serves POST /hooks/<name> for each configured hook. A request
+// that passes the hook's secret or signature check has its JSON payload
+// rendered through the hook's template and handed to the agent as if it came
+// from the hook's target channel and chat, so the reply is delivered there.
+func StartWebhooks(ctx context.Context, hub *chat.Hub, cfg config.WebhooksConfig) error {
+	listen := cfg.Listen
+	if listen == "" {
+		listen = "127.0.0.1:8090"
+	}
+
+	hooks := make(map[string]*webhook, len(cfg.Hooks))
+	for _, hc := range cfg.Hooks {
+		if hc.Name == "" {
+			return fmt.Errorf("webhook without a name")
+		}
+		if hc.Secret == "" && hc.HMACSecret == "" {
+			return fmt.Errorf("webhook %q: secret or hmacSecret required", hc.Name)
+		}
+		if hc.Channel == "" || hc.ChatID == "" {
+			return fmt.Errorf("webhook %q: channel and chatId required", hc.Name)
+		}
+		text := hc.Template
+		if text == "" {
+			text = defaultWebhookTemplate
+		}
+		tmpl, err := template.New(hc.Name).Funcs(template.FuncMap{"json": webhookJSON}).Parse(text)
+		if err != nil {
+			return fmt.Errorf("webhook %q: invalid template: %w", hc.Name, err)
+		}
+		hooks[hc.Name] = &webhook{cfg: hc, tmpl: tmpl}
+	}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("POST /hooks/{name}", func(w http.ResponseWriter, r *http.Request) {
+		name := r.PathValue("name")
+		hook, ok := hooks[name]
+		if !ok {
+			writeJSONError(w, http.StatusNotFound, "unknown hook")
+			return
+		}
+		body, err := io.ReadAll(io.LimitReader(r.Body, 1<<20))
+		if err != nil {
+			writeJSONError(w, http.StatusBadRequest, "failed to read body")
+			return
+		}
+		if !hook.authorized(r, body) {
+			log.Printf("webhook: rejected request for %s from %s", name, r.RemoteAddr)
+			writeJSONError(w, http.StatusUnauthorized, "invalid secret or signature")
+			return
+		}
+		content, err := hook.render(body)
+		if err != nil {
+			log.Printf("webhook: %s: %v", name, err)
+			writeJSONError(w, http.StatusBadRequest, err.Error())
+			return
+		}
+
+		in := chat.Inbound{
+			Channel:   hook.cfg.Channel,
+			SenderID:  "webhook:" + name,
+			ChatID:    hook.cfg.ChatID,
+			Content:   fmt.Sprintf("[Webhook %s] %s", name, content),
+			Timestamp: time.Now(),
+		}
+		// Don't hold the sender's request while the agent is busy: senders
+		// time out and retry, which would queue the same event twice.
+		select {
+		case hub.In <- in:
+		case <-time.After(webhookQueueWait):
+			log.Printf("webhook: %s dropped, agent queue is full", name)
+			w.Header().Set("Retry-After", "60")
+			writeJSONError(w, http.StatusServiceUnavailable, "agent busy, try again later")
+			return
+		}
+		log.Printf("webhook: %s triggered, replying to %s:%s", name, hook.cfg.Channel, hook.cfg.ChatID)
+		writeJSON(w, http.StatusAccepted, map[string]string{"status": "accepted"})
+	})
+
+	srv := &http.Server{Addr: listen, Handler: mux}
+	if err := serve(ctx, "webhook", srv); err != nil {
+		return err
+	}
+
+	log.Printf("webhooks listening on %s (%d hooks)", listen, len(hooks))
+	return nil
+}
+
+// authorized checks the shared secret and/or the HMAC-SHA256 signature of
+// body. When both are configured, both must match.
+func (h *webhook) authorized(r *http.Request, body []byte) bool {
+	if h.cfg.Secret != "" {
+		got := r.Header.Get("X-Webhook-Secret")
+		if got == "" {
+			got = r.URL.Query().Get("secret")
+		}
+		if subtle.ConstantTimeCompare([]byte(got), []byte(h.cfg.Secret)) != 1 {
+			return false
+		}
+	}
+	if h.cfg.HMACSecret != "" {
+		header := h.cfg.SignatureHeader
+		if header == "" {
+			header = "X-Hub-Signature-256"
+		}
+		// GitHub sends "sha256=<hex>", Gitea and most others plain hex
+		sig, err := hex.DecodeString(strings.TrimPrefix(r.Header.Get(header), "sha256="))
+		if err != nil || len(sig) == 0 {
+			return false
+		}
+		mac := hmac.New(sha256.New, []byte(h.cfg.HMACSecret))
+		mac.Write(body)
+		if !hmac.Equal(sig, mac.Sum(nil)) {
+			return false
+		}
+	}
+	return true
+}
+
+// render executes the hook's template with the decoded JSON payload as its
+// data. Bodies that aren't JSON are passed to the template as a plain string.
+func (h *webhook) render(body []byte) (string, error) {
+	var payload interface{}
+	if err := json.Unmarshal(body, &payload); err != nil {
+		payload = string(body)
+	}
+	var buf bytes.Buffer
+	if err := h.tmpl.Execute(&buf, payload); err != nil {
+		return "", fmt.Errorf("template: %w", err)
+	}
+	return strings.TrimSpace(buf.String()), nil
+}
+
+// webhookJSON is the template "json" function: indented JSON of any value.
+func webhookJSON(v interface{}) string {
+	b, err := json.MarshalIndent(v, "", "  ")
+	if err != nil {
+		return fmt.Sprint(v)
+	}
+	return string(b)
+}
@@ -2,6 +2,63 @@ package chat
 
 import "time"
 
+// MetaFinal is the Outbound.Metadata key set on the agent's final reply to an
+// inbound message, so request/response channels know when a turn is complete.
+const MetaFinal = "final"
+
+// MetaTurn is the Inbound.Metadata key a request/response channel sets to
+// tell its turns apart. The agent copies its value onto the replies it sends
+// for that message, so a late reply to an abandoned request can be told
+// from a reply to the next one.
+const MetaTurn = "turn"
+
+// MetaThrottled is the Outbound.Metadata key marking the agent's reply to a
+// message the rate limiter refused, so request/response channels can answer
+// with 429 instead of a normal reply.
+const MetaThrottled = "throttled"
+
+// MetaSenderName is the Inbound.Metadata key group chat channels set to the
+// sender's display name. The agent puts it in front of the message in the
+// conversation, so a shared group history says who said what.
+const MetaSenderName = "sender_name"
+
+// MetaTrace is the Inbound.Metadata key a channel sets to ask for tool-call
+// traces. Traces are sent as Outbound messages carrying a ToolTrace under the
+// same key.
+const MetaTrace = "trace"
+
+// MetaJob is the Inbound.Metadata key on messages from scheduled jobs. Its
+// value is a *JobRun.
+const MetaJob = "job"
+
+// JobRun describes the scheduled job an inbound message comes from.
+type JobRun struct {
+	ID    string
+	Kind  string // "remind", "agent" or "tool"; "" for heartbeat tasks
+	Owner string // sender ID, on the message's channel, of whoever scheduled the job; the job runs with their permissions
+	Tool  string // for "tool" jobs: the tool to call with Args
+	Args  map[string]interface{}
+
+	// Done, if set, is called once the run has finished with what it sent
+	// and whether it failed.
+	Done func(output string, err error)
+}
+
+// Finish reports the end of the run to Done, if set.
+func (r *JobRun) Finish(output string, err error) {
+	if r != nil && r.Done != nil {
+		r.Done(output, err)
+	}
+}
+
+// ToolTrace describes a single tool call made while answering a message.
+type ToolTrace struct {
+	Tool   string                 `json:"tool"`
+	Args   map[string]interface{} `json:"args"`
+	Result string                 `json:"result"`
+	Error  bool                   `json:"error"`
+}
+
 // Inbound represents an incoming message to the agent.
 type Inbound struct {
 	Channel   string
@@ -30,6 +87,13 @@ type Hub struct {
 
 	TelegramOut chan Outbound
 	NtfyOut     chan Outbound
+	HTTPOut     chan Outbound
+	WebOut      chan Outbound
+	MatrixOut   chan Outbound
+	EmailOut    chan Outbound
+	SlackOut    chan Outbound
+	SignalOut   chan Outbound
+	MQTTOut     chan Outbound
 }
 
 // NewHub constructs a new Hub with the given buffer size.
@@ -39,6 +103,13 @@ func NewHub(buffer int) *Hub {
 		Out:         make(chan Outbound, buffer),
 		TelegramOut: make(chan Outbound, buffer),
 		NtfyOut:     make(chan Outbound, buffer),
+		HTTPOut:     make(chan Outbound, buffer),
+		WebOut:      make(chan Outbound, buffer),
+		MatrixOut:   make(chan Outbound, buffer),
+		EmailOut:    make(chan Outbound, buffer),
+		SlackOut:    make(chan Outbound, buffer),
+		SignalOut:   make(chan Outbound, buffer),
+		MQTTOut:     make(chan Outbound, buffer),
 	}
 }
 
@@ -48,4 +119,11 @@ func (h *Hub) Close() {
 	close(h.Out)
 	close(h.TelegramOut)
 	close(h.NtfyOut)
+	close(h.HTTPOut)
+	close(h.WebOut)
+	close(h.MatrixOut)
+	close(h.EmailOut)
+	close(h.SlackOut)
+	close(h.SignalOut)
+	close(h.MQTTOut)
 }
@@ -0,0 +1,234 @@
+package config
+
+import (
+	"fmt"
+	"os"
+	"reflect"
+	"strconv"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// Document is a config file as written, with its key order and (for YAML)
+// comments, for edits that shouldn't rewrite the rest of the file.
+// Environment overrides and references are not applied, so saving never
+// writes secrets into the file.
+type Document struct {
+	path string
+	root *yaml.Node
+}
+
+// OpenDocument reads the config file at path.
+func OpenDocument(path string) (*Document, error) {
+	root, err := readDocument(path)
+	if err != nil {
+		return nil, err
+	}
+	return &Document{path: path, root: root}, nil
+}
+
+// pathElem is one step of a key path: a key, or an index into a list.
+type pathElem struct {
+	key   string
+	index int // -1 for keys
+}
+
+// parseKeyPath splits "channels.telegram.allowFrom[0]" into its steps.
+func parseKeyPath(path string) ([]pathElem, error) {
+	var elems []pathElem
+	for _, part := range strings.Split(path, ".") {
+		key, rest, _ := strings.Cut(part, "[")
+		if key == "" && len(elems) == 0 {
+			return nil, fmt.Errorf("invalid key %q", path)
+		}
+		if key != "" {
+			elems = append(elems, pathElem{key: key, index: -1})
+		}
+		for rest != "" {
+			num, after, ok := strings.Cut(rest, "]")
+			i, err := strconv.Atoi(num)
+			if !ok || err != nil || i < 0 {
+				return nil, fmt.Errorf("invalid index in %q", path)
+			}
+			elems = append(elems, pathElem{index: i})
+			rest = strings.TrimPrefix(after, "[")
+		}
+	}
+	return elems, nil
+}
+
+// Get returns the value at a key path such as "agents.defaults.model".
+// Scalars are returned as they are; lists and objects as JSON.
+func (d *Document) Get(path string) (string, error) {
+	elems, err := parseKeyPath(path)
+	if err != nil {
+		return "", err
+	}
+	n := d.root
+	for _, e := range elems {
+		if n = child(n, e); n == nil {
+			return "", fmt.Errorf("%s is not set", path)
+		}
+	}
+	if n.Kind == yaml.ScalarNode {
+		return n.Value, nil
+	}
+	b, err := nodeToJSON(n)
+	return string(b), err
+}
+
+// Set stores value at a key path, creating missing objects on the way. The
+// value is parsed as YAML, so JSON works too: `true`, `42`, `"text"`,
+// `["a", "b"]`. Fields that hold text get the value as text even if it looks
+// like a number. Set refuses values the config schema doesn't accept.
+func (d *Document) Set(path, value string) error {
+	elems, err := parseKeyPath(path)
+	if err != nil {
+		return err
+	}
+	var parsed yaml.Node
+	if err := yaml.Unmarshal([]byte(value), &parsed); err != nil {
+		return fmt.Errorf("invalid value: %w", err)
+	}
+	val := scalarNode("!!str", "")
+	if len(parsed.Content) > 0 {
+		val = parsed.Content[0]
+	}
+	if t := typeAtPath(elems); t != nil {
+		coerceStrings(val, t)
+	}
+
+	n := d.root
+	for i, e := range elems {
+		last := i == len(elems)-1
+		next := child(n, e)
+		if next == nil {
+			switch {
+			case last:
+				next = val
+			case elems[i+1].index >= 0:
+				next = &yaml.Node{Kind: yaml.SequenceNode, Tag: "!!seq"}
+			default:
+				next = &yaml.Node{Kind: yaml.MappingNode, Tag: "!!map"}
+			}
+			if err := addChild(n, e, next, path); err != nil {
+				return err
+			}
+		} else if last {
+			// keep the comments attached to the old value
+			val.HeadComment, val.LineComment, val.FootComment = next.HeadComment, next.LineComment, next.FootComment
+			*next = *val
+		}
+		n = next
+	}
+
+	data, err := nodeToJSON(d.root)
+	if err != nil {
+		return err
+	}
+	for _, p := range CheckSchema(data) {
+		pp := p.(*Problem).Path
+		if pp == path || strings.HasPrefix(pp, path+".") || strings.HasPrefix(pp, path+"[") {
+			return p
+		}
+	}
+	return nil
+}
+
+// Save writes the document back to its file.
+func (d *Document) Save() error {
+	perm := os.FileMode(0o640)
+	if fi, err := os.Stat(d.path); err == nil {
+		perm = fi.Mode().Perm()
+	}
+	return writeDocument(d.path, d.root, perm)
+}
+
+// child returns the node at one step below n, or nil.
+func child(n *yaml.Node, e pathElem) *yaml.Node {
+	if e.index >= 0 {
+		if n.Kind == yaml.SequenceNode && e.index < len(n.Content) {
+			return n.Content[e.index]
+		}
+		return nil
+	}
+	if n.Kind != yaml.MappingNode {
+		return nil
+	}
+	for i := 0; i+1 < len(n.Content); i += 2 {
+		if n.Content[i].Value == e.key {
+			return n.Content[i+1]
+		}
+	}
+	return nil
+}
+
+// addChild adds c to n at step e. Lists can only grow by one at a time.
+func addChild(n *yaml.Node, e pathElem, c *yaml.Node, path string) error {
+	if e.index >= 0 {
+		if n.Kind != yaml.SequenceNode || e.index != len(n.Content) {
+			return fmt.Errorf("%s: index %d is out of range", path, e.index)
+		}
+		n.Content = append(n.Content, c)
+		return nil
+	}
+	if n.Kind != yaml.MappingNode {
+		return fmt.Errorf("%s: %q is not inside an object", path, e.key)
+	}
+	n.Content = append(n.Content, scalarNode("!!str", e.key), c)
+	return nil
+}
+
+// typeAtPath returns the Go type of the config field at a path, or nil if
+// the path doesn't name a field.
+func typeAtPath(elems []pathElem) reflect.Type {
+	t := reflect.TypeOf(Config{})
+	for _, e := range elems {
+		for t.Kind() == reflect.Pointer {
+			t = t.Elem()
+		}
+		switch {
+		case e.index >= 0 && t.Kind() == reflect.Slice:
+			t = t.Elem()
+		case e.index < 0 && t.Kind() == reflect.Map:
+			t = t.Elem()
+		case e.index < 0 && t.Kind() == reflect.Struct:
+			f, ok := jsonFields(t)[e.key]
+			if !ok {
+				return nil
+			}
+			t = f.Type
+		default:
+			return nil
+		}
+	}
+	return t
+}
+
+// coerceStrings retags scalars that land in text fields as strings, so an
+// ID like 8881234567 stays text instead of becoming a number.
+func coerceStrings(n *yaml.Node, t reflect.Type) {
+	for t.Kind() == reflect.Pointer {
+		t = t.Elem()
+	}
+	switch {
+	case n.Kind == yaml.ScalarNode && t.Kind() == reflect.String && n.ShortTag() != "!!null":
+		n.Tag, n.Style = "!!str", 0
+	case n.Kind == yaml.SequenceNode && t.Kind() == reflect.Slice:
+		for _, c := range n.Content {
+			coerceStrings(c, t.Elem())
+		}
+	case n.Kind == yaml.MappingNode && t.Kind() == reflect.Map:
+		for i := 1; i < len(n.Content); i += 2 {
+			coerceStrings(n.Content[i], t.Elem())
+		}
+	case n.Kind == yaml.MappingNode && t.Kind() == reflect.Struct:
+		fields := jsonFields(t)
+		for i := 0; i+1 < len(n.Content); i += 2 {
+			if f, ok := fields[n.Content[i].Value]; ok {
+				coerceStrings(n.Content[i+1], f.Type)
+			}
+		}
+	}
+}
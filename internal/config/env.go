@@ -0,0 +1,275 @@
+package config
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"reflect"
+	"strconv"
+	"strings"
+	"unicode"
+)
+
+// EnvPrefix starts every config environment variable.
+//
+// Each config field maps to one variable built from its JSON path, with
+// camelCase turned into UPPER_SNAKE_CASE:
+//
+//	agents.defaults.model           PICOBOT_AGENTS_DEFAULTS_MODEL
+//	providers.openai.apiKey         PICOBOT_PROVIDERS_OPENAI_API_KEY
+//	channels.telegram.allowFrom     PICOBOT_CHANNELS_TELEGRAM_ALLOW_FROM
+//	rateLimit.perSender.burst       PICOBOT_RATE_LIMIT_PER_SENDER_BURST
+//
+// String lists take comma-separated values; maps and lists of objects (such
+// as users or tools.mcp.servers) take JSON.
+const EnvPrefix = "PICOBOT"
+
+// applyEnv overrides fields of cfg with the PICOBOT_* variables in environ.
+func applyEnv(cfg *Config, environ []string) error {
+	env := make(map[string]string)
+	for _, kv := range environ {
+		k, v, ok := strings.Cut(kv, "=")
+		if ok && strings.HasPrefix(k, EnvPrefix+"_") {
+			env[k] = v
+		}
+	}
+	if len(env) == 0 {
+		return nil
+	}
+	return envStruct(reflect.ValueOf(cfg).Elem(), EnvPrefix, env)
+}
+
+func envStruct(v reflect.Value, prefix string, env map[string]string) error {
+	t := v.Type()
+	for i := 0; i < t.NumField(); i++ {
+		tag, _, _ := strings.Cut(t.Field(i).Tag.Get("json"), ",")
+		if tag == "" || tag == "-" {
+			continue
+		}
+		if err := envValue(v.Field(i), prefix+"_"+envName(tag), env); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func envValue(f reflect.Value, name string, env map[string]string) error {
+	val, set := env[name]
+	switch {
+	case f.Kind() == reflect.Struct:
+		return envStruct(f, name, env)
+	case f.Kind() == reflect.Pointer && f.Type().Elem().Kind() == reflect.Struct:
+		if set {
+			return envJSON(f, name, val)
+		}
+		if !hasEnvPrefix(env, name+"_") {
+			return nil
+		}
+		if f.IsNil() {
+			f.Set(reflect.New(f.Type().Elem()))
+		}
+		return envStruct(f.Elem(), name, env)
+	}
+	if !set {
+		return nil
+	}
+	switch f.Kind() {
+	case reflect.String:
+		f.SetString(val)
+	case reflect.Bool:
+		b, err := strconv.ParseBool(val)
+		if err != nil {
+			return fmt.Errorf("%s: %q is not a boolean", name, val)
+		}
+		f.SetBool(b)
+	case reflect.Int, reflect.Int64:
+		n, err := strconv.ParseInt(val, 10, 64)
+		if err != nil {
+			return fmt.Errorf("%s: %q is not an integer", name, val)
+		}
+		f.SetInt(n)
+	case reflect.Float32, reflect.Float64:
+		n, err := strconv.ParseFloat(val, 64)
+		if err != nil {
+			return fmt.Errorf("%s: %q is not a number", name, val)
+		}
+		f.SetFloat(n)
+	case reflect.Slice:
+		if f.Type().Elem().Kind() == reflect.String && !strings.HasPrefix(strings.TrimSpace(val), "[") {
+			list := []string{}
+			for _, s := range strings.Split(val, ",") {
+				if s = strings.TrimSpace(s); s != "" {
+					list = append(list, s)
+				}
+			}
+			f.Set(reflect.ValueOf(list))
+			return nil
+		}
+		return envJSON(f, name, val)
+	default:
+		return envJSON(f, name, val)
+	}
+	return nil
+}
+
+// envJSON replaces f with the JSON value of a variable.
+func envJSON(f reflect.Value, name, val string) error {
+	p := reflect.New(f.Type())
+	if err := json.Unmarshal([]byte(val), p.Interface()); err != nil {
+		return fmt.Errorf("%s: invalid JSON: %w", name, err)
+	}
+	f.Set(p.Elem())
+	return nil
+}
+
+func hasEnvPrefix(env map[string]string, prefix string) bool {
+	for k := range env {
+		if strings.HasPrefix(k, prefix) {
+			return true
+		}
+	}
+	return false
+}
+
+// envName turns a JSON key into its variable name part: "allowFrom"
+// becomes "ALLOW_FROM".
+func envName(key string) string {
+	var b strings.Builder
+	runes := []rune(key)
+	for i, r := range runes {
+		if i > 0 && unicode.IsUpper(r) && (unicode.IsLower(runes[i-1]) || unicode.IsDigit(runes[i-1])) {
+			b.WriteByte('_')
+		}
+		b.WriteRune(unicode.ToUpper(r))
+	}
+	return b.String()
+}
+
+// EnvVarName returns the variable that overrides the field at a JSON path
+// such as "channels.telegram.token".
+func EnvVarName(path string) string {
+	parts := strings.Split(path, ".")
+	for i, p := range parts {
+		parts[i] = envName(p)
+	}
+	return EnvPrefix + "_" + strings.Join(parts, "_")
+}
+
+// resolveRefs expands references in the secret-bearing string values of cfg
+// (see secretField):
+//
+//	"${OPENAI_API_KEY}"        the value of an environment variable ("$${" for a literal "${")
+//	"file:/run/secrets/key"    the contents of a file, without the trailing newline
+//
+// Other values are left alone, so a path such as a SQLite "file:/..." URI
+// isn't mistaken for a reference. A reference to an unset variable or
+// unreadable file is an error rather than an empty value.
+func resolveRefs(cfg *Config) error {
+	return refValue(reflect.ValueOf(cfg).Elem(), "", false)
+}
+
+// secretField reports whether values under the JSON key hold credentials:
+// API keys, tokens, secrets, passwords and HTTP headers.
+func secretField(key string) bool {
+	key = strings.ToLower(key)
+	for _, suffix := range []string{"key", "token", "secret", "password", "headers"} {
+		if strings.HasSuffix(key, suffix) {
+			return true
+		}
+	}
+	return false
+}
+
+func refValue(v reflect.Value, path string, secret bool) error {
+	switch v.Kind() {
+	case reflect.Pointer:
+		if v.IsNil() {
+			return nil
+		}
+		return refValue(v.Elem(), path, secret)
+	case reflect.Struct:
+		t := v.Type()
+		for i := 0; i < t.NumField(); i++ {
+			tag, _, _ := strings.Cut(t.Field(i).Tag.Get("json"), ",")
+			if tag == "" || tag == "-" {
+				continue
+			}
+			if err := refValue(v.Field(i), joinPath(path, tag), secretField(tag)); err != nil {
+				return err
+			}
+		}
+	case reflect.Slice:
+		for i := 0; i < v.Len(); i++ {
+			if err := refValue(v.Index(i), fmt.Sprintf("%s[%d]", path, i), secret); err != nil {
+				return err
+			}
+		}
+	case reflect.Map:
+		iter := v.MapRange()
+		for iter.Next() {
+			key := fmt.Sprint(iter.Key().Interface())
+			// map values aren't addressable; resolve a copy and store it back
+			elem := reflect.New(iter.Value().Type()).Elem()
+			elem.Set(iter.Value())
+			if err := refValue(elem, joinPath(path, key), secret); err != nil {
+				return err
+			}
+			v.SetMapIndex(iter.Key(), elem)
+		}
+	case reflect.String:
+		if !secret {
+			return nil
+		}
+		s, err := resolveRef(v.String())
+		if err != nil {
+			return fmt.Errorf("%s: %w", path, err)
+		}
+		v.SetString(s)
+	}
+	return nil
+}
+
+func joinPath(path, key string) string {
+	if path == "" {
+		return key
+	}
+	return path + "." + key
+}
+
+// resolveRef expands one string value.
+func resolveRef(s string) (string, error) {
+	if name, ok := strings.CutPrefix(s, "file:"); ok && strings.HasPrefix(name, "/") {
+		data, err := os.ReadFile(name)
+		if err != nil {
+			return "", err
+		}
+		return strings.TrimRight(string(data), "\r\n"), nil
+	}
+	if !strings.Contains(s, "${") {
+		return s, nil
+	}
+	var b strings.Builder
+	for {
+		i := strings.Index(s, "${")
+		if i < 0 {
+			b.WriteString(s)
+			return b.String(), nil
+		}
+		if i > 0 && s[i-1] == '$' {
+			b.WriteString(s[:i-1] + "${")
+			s = s[i+2:]
+			continue
+		}
+		end := strings.IndexByte(s[i:], '}')
+		if end < 0 {
+			return "", fmt.Errorf("unterminated ${ in %q", s)
+		}
+		name := s[i+2 : i+end]
+		val, ok := os.LookupEnv(name)
+		if !ok {
+			return "", fmt.Errorf("environment variable %s is not set", name)
+		}
+		b.WriteString(s[:i] + val)
+		s = s[i+end+1:]
+	}
+}
@@ -2,26 +2,183 @@ package config
 
 import (
 	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
 	"os"
 	"path/filepath"
+	"regexp"
+	"strings"
 )
 
-// LoadConfig loads config from ~/.picobot/config.json if present, otherwise returns defaults.
-func LoadConfig() (Config, error) {
+// The config file in use is chosen by, in order:
+//
+//	--config <file> or PICOBOT_CONFIG       that file (JSON, or YAML by extension)
+//	--profile <name> or PICOBOT_PROFILE     ~/.picobot/profiles/<name>/config.json
+//	neither                                 ~/.picobot/config.json
+//
+// For a profile or the default directory, config.yaml or config.yml is used
+// instead if it exists and config.json doesn't.
+var (
+	selectedPath    string
+	selectedProfile string
+)
+
+var profileRE = regexp.MustCompile(`^[A-Za-z0-9][A-Za-z0-9_.-]*$`)
+
+// Select records the config file and profile given on the command line.
+// Empty values fall back to PICOBOT_CONFIG and PICOBOT_PROFILE.
+func Select(path, profile string) error {
+	if path == "" {
+		path = os.Getenv("PICOBOT_CONFIG")
+	}
+	if profile == "" {
+		profile = os.Getenv("PICOBOT_PROFILE")
+	}
+	if path != "" && profile != "" {
+		return errors.New("use either a config file or a profile, not both")
+	}
+	if profile != "" && !profileRE.MatchString(profile) {
+		return fmt.Errorf("invalid profile name %q", profile)
+	}
+	selectedPath, selectedProfile = ExpandHome(path), profile
+	return nil
+}
+
+// Profile returns the selected profile, or "" for the default config.
+func Profile() string {
+	return selectedProfile
+}
+
+// ConfigPath returns the config file in use.
+func ConfigPath() string {
+	if selectedPath != "" {
+		return selectedPath
+	}
+	dir := picobotHome()
+	if selectedProfile != "" {
+		dir = filepath.Join(dir, "profiles", selectedProfile)
+	}
+	path := filepath.Join(dir, "config.json")
+	if _, err := os.Stat(path); err != nil {
+		for _, name := range []string{"config.yaml", "config.yml"} {
+			if _, err := os.Stat(filepath.Join(dir, name)); err == nil {
+				return filepath.Join(dir, name)
+			}
+		}
+	}
+	return path
+}
+
+// StateDir returns the directory that holds the config file. picobot keeps
+// its other runtime files (such as the pairing list) there too, so separate
+// profiles don't share them.
+func StateDir() string {
+	return filepath.Dir(ConfigPath())
+}
+
+// picobotHome returns ~/.picobot.
+func picobotHome() string {
 	home, err := os.UserHomeDir()
 	if err != nil {
 		home = "."
 	}
-	path := filepath.Join(home, ".picobot", "config.json")
+	return filepath.Join(home, ".picobot")
+}
+
+// ExpandHome replaces a leading "~/" in path with the user's home directory.
+// Paths in the config, such as the workspace, may start with "~/".
+func ExpandHome(path string) string {
+	if strings.HasPrefix(path, "~/") {
+		if home, err := os.UserHomeDir(); err == nil {
+			return filepath.Join(home, path[2:])
+		}
+	}
+	return path
+}
+
+// LoadConfig loads the config file in use (see ConfigPath). A missing
+// default config is not an error and yields an empty config, but a config
+// file or profile that was asked for explicitly must exist.
+// PICOBOT_* environment variables and ${ENV} / file: references are applied
+// either way (see EnvPrefix and resolveRefs).
+func LoadConfig() (Config, error) {
+	path := ConfigPath()
+	cfg, err := LoadConfigFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		if selectedPath != "" || selectedProfile != "" {
+			return Config{}, fmt.Errorf("%s does not exist (create it with picobot onboard)", path)
+		}
+		// no file (not an error): only the environment applies
+		return finishConfig(Config{})
+	}
+	return cfg, err
+}
+
+// LoadConfigFile loads the config at path, with environment overrides and
+// references applied. Unknown keys and an outdated version are logged as
+// warnings.
+func LoadConfigFile(path string) (Config, error) {
+	data, from, err := readConfigJSON(path)
+	if err != nil {
+		return Config{}, err
+	}
+	if from < CurrentVersion {
+		log.Printf("config: %s is version %d and was upgraded to version %d in memory; run `picobot config migrate` to update the file", path, from, CurrentVersion)
+	}
+	for _, p := range CheckSchema(data) {
+		if strings.HasPrefix(p.(*Problem).Message, "unknown field") {
+			log.Printf("config: %s: %v (ignored)", path, p)
+		}
+	}
+	cfg, err := decodeConfig(data)
+	if err != nil {
+		return Config{}, err
+	}
+	return finishConfig(cfg)
+}
+
+// ReadConfigFile loads the config at path as written (after migration to
+// the current version), without environment overrides or resolved
+// references. Use it when the config will be written back, so secrets from
+// the environment don't end up in the file.
+func ReadConfigFile(path string) (Config, error) {
+	data, _, err := readConfigJSON(path)
+	if err != nil {
+		return Config{}, err
+	}
+	return decodeConfig(data)
+}
+
+func decodeConfig(data []byte) (Config, error) {
 	var cfg Config
-	f, err := os.Open(path)
+	if err := json.Unmarshal(data, &cfg); err != nil {
+		return Config{}, err
+	}
+	return cfg, nil
+}
+
+// readConfigJSON returns the config file's contents as JSON, converting
+// from YAML and migrating to CurrentVersion if necessary. It also returns
+// the version the file was written for.
+func readConfigJSON(path string) (data []byte, version int, err error) {
+	root, err := readDocument(path)
 	if err != nil {
-		// return empty config (not an error)
-		return Config{}, nil
+		return nil, 0, err
+	}
+	from, _, err := migrate(root)
+	if err != nil {
+		return nil, 0, err
+	}
+	data, err = nodeToJSON(root)
+	return data, from, err
+}
+
+func finishConfig(cfg Config) (Config, error) {
+	if err := applyEnv(&cfg, os.Environ()); err != nil {
+		return Config{}, err
 	}
-	defer f.Close()
-	dec := json.NewDecoder(f)
-	if err := dec.Decode(&cfg); err != nil {
+	if err := resolveRefs(&cfg); err != nil {
 		return Config{}, err
 	}
 	return cfg, nil
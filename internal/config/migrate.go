@@ -0,0 +1,149 @@
+package config
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// CurrentVersion is the config version this build writes. Files without a
+// version field are version 0.
+const CurrentVersion = 1
+
+// A migration upgrades a config document from version to-1 to version to,
+// editing the document in place, and describes each change it made.
+//
+// Migrations work on the document rather than on Config, so they can rename
+// or restructure keys, and so a migrated file keeps its comments and order
+// when it is written back. A version that adds fields whose zero value is
+// broken only needs a step made by fillDefaults.
+type migration struct {
+	to    int
+	apply func(root *yaml.Node) ([]string, error)
+}
+
+var migrations = []migration{
+	// Version 1 introduces the version field. Files from before it may lack
+	// providers.openai.timeout, where 0 means no timeout at all.
+	{to: 1, apply: fillDefaults("providers.openai.timeout")},
+}
+
+// migrate upgrades root to CurrentVersion. It returns the version the
+// document had and what was changed.
+func migrate(root *yaml.Node) (from int, changes []string, err error) {
+	from, err = documentVersion(root)
+	if err != nil {
+		return 0, nil, err
+	}
+	if from > CurrentVersion {
+		return from, nil, fmt.Errorf("config version %d is newer than this picobot supports (%d); upgrade picobot", from, CurrentVersion)
+	}
+	for _, m := range migrations {
+		if m.to <= from {
+			continue
+		}
+		c, err := m.apply(root)
+		if err != nil {
+			return from, nil, fmt.Errorf("migrating to version %d: %w", m.to, err)
+		}
+		changes = append(changes, c...)
+		setVersion(root, m.to)
+	}
+	return from, changes, nil
+}
+
+func documentVersion(root *yaml.Node) (int, error) {
+	n := child(root, pathElem{key: "version", index: -1})
+	if n == nil {
+		return 0, nil
+	}
+	v, err := strconv.Atoi(n.Value)
+	if n.Kind != yaml.ScalarNode || err != nil || v < 0 {
+		return 0, fmt.Errorf("version: must be a whole number, not %q", n.Value)
+	}
+	return v, nil
+}
+
+// setVersion sets the version field, adding it as the first key if needed.
+func setVersion(root *yaml.Node, v int) {
+	val := scalarNode("!!int", strconv.Itoa(v))
+	if n := child(root, pathElem{key: "version", index: -1}); n != nil {
+		*n = *val
+		return
+	}
+	key := scalarNode("!!str", "version")
+	if len(root.Content) > 0 {
+		// the comment at the top of the file stays at the top
+		key.HeadComment, root.Content[0].HeadComment = root.Content[0].HeadComment, ""
+	}
+	root.Content = append([]*yaml.Node{key, val}, root.Content...)
+}
+
+// fillDefaults returns a step that adds the given fields, at their
+// DefaultConfig values, where root lacks them. Only list fields whose zero
+// value is broken: any other missing field keeps meaning what it did, such
+// as "the provider's default model". Missing sections aren't created.
+func fillDefaults(fields ...string) func(root *yaml.Node) ([]string, error) {
+	return func(root *yaml.Node) ([]string, error) {
+		b, err := json.Marshal(DefaultConfig())
+		if err != nil {
+			return nil, err
+		}
+		def, err := jsonToNode(b)
+		if err != nil {
+			return nil, err
+		}
+		var added []string
+		for _, field := range fields {
+			n, d := root, def
+			keys := strings.Split(field, ".")
+			for i, key := range keys {
+				elem := pathElem{key: key, index: -1}
+				if d = child(d, elem); d == nil {
+					return nil, fmt.Errorf("%s has no default", field)
+				}
+				c := child(n, elem)
+				if i == len(keys)-1 && c == nil {
+					n.Content = append(n.Content, scalarNode("!!str", key), d)
+					added = append(added, fmt.Sprintf("added %s: %s", field, defaultText(d)))
+				}
+				if c == nil || c.Kind != yaml.MappingNode {
+					break
+				}
+				n = c
+			}
+		}
+		return added, nil
+	}
+}
+
+func defaultText(n *yaml.Node) string {
+	b, _ := nodeToJSON(n)
+	return string(b)
+}
+
+// Migrate upgrades the document to CurrentVersion. It returns the version
+// the file had and a description of each change; there are none if the
+// file is current.
+func (d *Document) Migrate() (from int, changes []string, err error) {
+	return migrate(d.root)
+}
+
+// Backup copies the file as it is on disk to <path>.v<version>.bak and
+// returns the backup's path.
+func (d *Document) Backup(version int) (string, error) {
+	data, err := os.ReadFile(d.path)
+	if err != nil {
+		return "", err
+	}
+	perm := os.FileMode(0o640)
+	if fi, err := os.Stat(d.path); err == nil {
+		perm = fi.Mode().Perm()
+	}
+	backup := fmt.Sprintf("%s.v%d.bak", d.path, version)
+	return backup, os.WriteFile(backup, data, perm)
+}
@@ -13,6 +13,7 @@ import (
 // DefaultConfig returns a minimal default Config with sensible defaults.
 func DefaultConfig() Config {
 	return Config{
+		Version: CurrentVersion,
 		Agents: AgentsConfig{Defaults: AgentDefaults{
 			Workspace:          "~/.picobot/workspace",
 			Model:              "stub-model",
@@ -21,7 +22,7 @@ func DefaultConfig() Config {
 			MaxToolIterations:  100,
 			HeartbeatIntervalS: 60,
 		}},
-		Channels: ChannelsConfig{Telegram: TelegramConfig{Enabled: false, Token: "", AllowFrom: []string{}}, Ntfy: NtfyConfig{Enabled: false, Token: "", Server: "https://ntfy.sh", Topic: ""}},
+		Channels: ChannelsConfig{Telegram: TelegramConfig{Enabled: false, Token: "", AllowFrom: []string{}, AllowGroups: []string{}, GroupAdmins: []string{}}, Ntfy: NtfyConfig{Enabled: false, Token: "", Server: "https://ntfy.sh", Topic: ""}, HTTP: HTTPConfig{Enabled: false, Listen: "127.0.0.1:8088", Token: ""}, Web: WebConfig{Enabled: false, Listen: "127.0.0.1:8089", Token: ""}, Matrix: MatrixConfig{Enabled: false, Homeserver: "", AccessToken: "", AllowRooms: []string{}}, Email: EmailConfig{Enabled: false, IMAPPort: 993, SMTPPort: 587, Mailbox: "INBOX", PollIntervalS: 60, AllowFrom: []string{}}, Slack: SlackConfig{Enabled: false, AppToken: "", BotToken: "", AllowFrom: []string{}}, Signal: SignalConfig{Enabled: false, Address: "http://127.0.0.1:8080", Account: "", AllowFrom: []string{}}, Webhooks: WebhooksConfig{Enabled: false, Listen: "127.0.0.1:8090", Hooks: []WebhookConfig{}}, MQTT: MQTTConfig{Enabled: false, Broker: "tcp://127.0.0.1:1883", QoS: 1, ReplyTopic: "picobot/reply", Topics: []MQTTTopicConfig{}}},
 		Providers: ProvidersConfig{
 			OpenAI: &ProviderConfig{APIKey: "sk-or-v1-REPLACE_ME", APIBase: "https://openrouter.ai/api/v1", Timeout: 180},
 		},
@@ -34,6 +35,16 @@ func DefaultConfig() Config {
 			ONNXModelPath:     "~/.picobot/embeddings/model.onnx",
 			ONNXTokenizerPath: "~/.picobot/embeddings/tokenizer.json",
 		},
+		RateLimit: RateLimitConfig{
+			Enabled:      false,
+			PerSender:    BucketConfig{Burst: 5, RefillPerMinute: 10},
+			PerChannel:   BucketConfig{Burst: 30, RefillPerMinute: 60},
+			MaxPending:   20,
+			BanAfter:     10,
+			BanWindowS:   600,
+			BanDurationS: 3600,
+		},
+		Cron: CronConfig{MissedRuns: "once"},
 		Tools: ToolsConfig{
 			MCP: &MCPConfig{
 				Enabled: false,
@@ -56,7 +67,8 @@ func DefaultConfig() Config {
 	}
 }
 
-// SaveConfig writes the config to the given path (creating parent dirs).
+// SaveConfig writes the config to the given path (creating parent dirs), as
+// YAML if the name ends in .yaml or .yml.
 func SaveConfig(cfg Config, path string) error {
 	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
 		return err
@@ -65,6 +77,13 @@ func SaveConfig(cfg Config, path string) error {
 	if err != nil {
 		return err
 	}
+	if IsYAML(path) {
+		root, err := jsonToNode(b)
+		if err != nil {
+			return err
+		}
+		return writeDocument(path, root, 0o640)
+	}
 	return os.WriteFile(path, b, 0o640)
 }
 
@@ -264,14 +283,23 @@ Schedule or manage cron jobs.
 
 		"HEARTBEAT.md": `# Heartbeat
 
-This file is checked periodically (every 60 seconds). Add tasks here that should run on a schedule.
+This file is checked periodically (every 60 seconds). Tasks that are due are sent to the agent one at a time.
 
 ## Periodic Tasks
 
-<!-- Add tasks below. The agent will process them on each heartbeat check. -->
-<!-- Example:
-- Check server status at https://example.com/health
-- Summarize unread messages
+<!-- Add tasks as checklist items. Indented items set when a task runs:
+  - every: 30m              repeat at this interval
+  - cron: 0 8 * * 1-5       repeat on a cron schedule (here weekdays at 8:00)
+  - at: 2026-03-03 14:00    run once at this time
+  - if: <condition>         the agent checks this first and skips the task if it doesn't hold
+A task without every, cron or at runs once, right away. picobot ticks
+one-time tasks off when they are done, and notes when recurring tasks last
+ran; untick a task or remove its "last:" line to run it again.
+Example:
+- [ ] Check server status at https://example.com/health and tell me if it's down
+  - every: 30m
+- [ ] Summarize unread messages
+  - cron: 0 8 * * 1-5
 -->
 `,
 	}
@@ -340,16 +368,13 @@ func extractEmbeddedSkills(targetDir string) error {
 
 // ResolveDefaultPaths returns absolute paths for the config and workspace based on home directory.
 func ResolveDefaultPaths() (cfgPath string, workspacePath string, err error) {
-	home, err := os.UserHomeDir()
-	if err != nil {
-		return "", "", err
-	}
-	cfgPath = filepath.Join(home, ".picobot", "config.json")
-	workspacePath = filepath.Join(home, ".picobot", "workspace")
+	cfgPath = ConfigPath()
+	workspacePath = filepath.Join(StateDir(), "workspace")
 	return cfgPath, workspacePath, nil
 }
 
-// Onboard writes default config and initializes the workspace at the user's home.
+// Onboard writes default config and initializes the workspace next to the
+// config file in use (see ConfigPath).
 func Onboard() (string, string, error) {
 	cfgPath, workspacePath, err := ResolveDefaultPaths()
 	if err != nil {
@@ -358,6 +383,10 @@ func Onboard() (string, string, error) {
 	cfg := DefaultConfig()
 	// set workspace path in config
 	cfg.Agents.Defaults.Workspace = workspacePath
+	if StateDir() != picobotHome() {
+		// a profile or test instance keeps its own memory too
+		cfg.Memory.DbPath = filepath.Join(StateDir(), "memory.db")
+	}
 	if err := SaveConfig(cfg, cfgPath); err != nil {
 		return "", "", fmt.Errorf("saving config: %w", err)
 	}
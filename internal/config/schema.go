@@ -2,11 +2,17 @@ package config
 
 // Config holds picobot configuration (minimal for v0).
 type Config struct {
-	Agents    AgentsConfig    `json:"agents"`
-	Channels  ChannelsConfig  `json:"channels"`
-	Providers ProvidersConfig `json:"providers"`
-	Memory    MemoryConfig    `json:"memory"`
-	Tools     ToolsConfig     `json:"tools"`
+	Version     int               `json:"version"` // see CurrentVersion
+	Agents      AgentsConfig      `json:"agents"`
+	Channels    ChannelsConfig    `json:"channels"`
+	Providers   ProvidersConfig   `json:"providers"`
+	Memory      MemoryConfig      `json:"memory"`
+	Tools       ToolsConfig       `json:"tools"`
+	Users       []UserConfig      `json:"users,omitempty"`
+	Permissions PermissionsConfig `json:"permissions,omitzero"`
+	RateLimit   RateLimitConfig   `json:"rateLimit"`
+	Cron        CronConfig        `json:"cron"`
+	Heartbeat   HeartbeatConfig   `json:"heartbeat,omitzero"`
 }
 
 type AgentsConfig struct {
@@ -25,19 +31,183 @@ type AgentDefaults struct {
 type ChannelsConfig struct {
 	Telegram TelegramConfig `json:"telegram"`
 	Ntfy     NtfyConfig     `json:"ntfy"`
+	HTTP     HTTPConfig     `json:"http"`
+	Web      WebConfig      `json:"web"`
+	Matrix   MatrixConfig   `json:"matrix"`
+	Email    EmailConfig    `json:"email"`
+	Slack    SlackConfig    `json:"slack"`
+	Signal   SignalConfig   `json:"signal"`
+	Webhooks WebhooksConfig `json:"webhooks"`
+	MQTT     MQTTConfig     `json:"mqtt"`
 }
 
 type TelegramConfig struct {
-	Enabled   bool     `json:"enabled"`
-	Token     string   `json:"token"`
-	AllowFrom []string `json:"allowFrom"`
+	Enabled     bool     `json:"enabled"`
+	Token       string   `json:"token"`
+	AllowFrom   []string `json:"allowFrom"`
+	AllowGroups []string `json:"allowGroups,omitempty"` // group chat IDs the bot may respond in
+	GroupAdmins []string `json:"groupAdmins,omitempty"` // user IDs allowed to address the bot in groups (empty = any member)
+	Pairing     bool     `json:"pairing,omitempty"`     // let unknown users request access with a one-time code
 }
 
 type NtfyConfig struct {
+	Enabled         bool     `json:"enabled"`
+	Token           string   `json:"token"`
+	Server          string   `json:"server"`
+	Topic           string   `json:"topic"`
+	Subscribe       bool     `json:"subscribe,omitempty"`       // also listen for inbound messages
+	SubscribeTopics []string `json:"subscribeTopics,omitempty"` // topics to listen on (defaults to topic)
+	AllowFrom       []string `json:"allowFrom,omitempty"`       // topics whose messages reach the agent (empty = all subscribed)
+}
+
+type HTTPConfig struct {
+	Enabled bool   `json:"enabled"`
+	Listen  string `json:"listen"` // e.g. "127.0.0.1:8088"
+	Token   string `json:"token"`  // bearer token required on every request
+}
+
+type WebConfig struct {
 	Enabled bool   `json:"enabled"`
-	Token   string `json:"token"`
-	Server  string `json:"server"`
-	Topic   string `json:"topic"`
+	Listen  string `json:"listen"` // e.g. "127.0.0.1:8089"
+	Token   string `json:"token"`  // access token asked for by the UI
+}
+
+type MatrixConfig struct {
+	Enabled     bool     `json:"enabled"`
+	Homeserver  string   `json:"homeserver"` // e.g. "https://matrix.example.org"
+	AccessToken string   `json:"accessToken"`
+	AllowRooms  []string `json:"allowRooms"`          // room IDs the bot listens in (empty = all joined rooms)
+	AllowFrom   []string `json:"allowFrom,omitempty"` // Matrix user IDs allowed to talk to the bot (empty = all)
+}
+
+type EmailConfig struct {
+	Enabled       bool     `json:"enabled"`
+	IMAPHost      string   `json:"imapHost"`
+	IMAPPort      int      `json:"imapPort"` // 993 = implicit TLS, anything else = STARTTLS
+	SMTPHost      string   `json:"smtpHost"`
+	SMTPPort      int      `json:"smtpPort"` // 465 = implicit TLS, otherwise STARTTLS when offered
+	Username      string   `json:"username"`
+	Password      string   `json:"password"`
+	From          string   `json:"from"`                    // sender address for replies (defaults to username)
+	Mailbox       string   `json:"mailbox,omitempty"`       // defaults to INBOX
+	PollIntervalS int      `json:"pollIntervalS,omitempty"` // defaults to 60
+	AllowFrom     []string `json:"allowFrom"`               // sender addresses allowed to reach the agent (empty = all)
+	InsecureIMAP  bool     `json:"insecureIMAP,omitempty"`  // log in to IMAP without TLS when the server offers no STARTTLS
+}
+
+type SlackConfig struct {
+	Enabled   bool     `json:"enabled"`
+	AppToken  string   `json:"appToken"`          // xapp-... app-level token with connections:write
+	BotToken  string   `json:"botToken"`          // xoxb-... bot token used for chat.postMessage
+	AllowFrom []string `json:"allowFrom"`         // Slack user IDs allowed to talk to the bot (empty = all)
+	APIBase   string   `json:"apiBase,omitempty"` // defaults to https://slack.com/api (override for testing)
+}
+
+type SignalConfig struct {
+	Enabled        bool     `json:"enabled"`
+	Address        string   `json:"address"`                  // signal-cli daemon: "http://127.0.0.1:8080", "/run/signal-cli/socket" or "127.0.0.1:7583"
+	Account        string   `json:"account"`                  // the bot's phone number, e.g. "+4915112345678"
+	AllowFrom      []string `json:"allowFrom"`                // phone numbers (or UUIDs) allowed to talk to the bot (empty = all)
+	AllowGroups    []string `json:"allowGroups,omitempty"`    // group IDs the bot responds in
+	AttachmentsDir string   `json:"attachmentsDir,omitempty"` // signal-cli attachment dir, used if attachments can't be fetched over RPC
+}
+
+type WebhooksConfig struct {
+	Enabled bool            `json:"enabled"`
+	Listen  string          `json:"listen"` // e.g. "127.0.0.1:8090"
+	Hooks   []WebhookConfig `json:"hooks"`
+}
+
+// WebhookConfig describes one endpoint, served at /hooks/<name>.
+type WebhookConfig struct {
+	Name            string `json:"name"`
+	Secret          string `json:"secret,omitempty"`          // shared secret, sent as X-Webhook-Secret header or ?secret=
+	HMACSecret      string `json:"hmacSecret,omitempty"`      // key for an HMAC-SHA256 signature of the body
+	SignatureHeader string `json:"signatureHeader,omitempty"` // header carrying the signature (default X-Hub-Signature-256)
+	Template        string `json:"template,omitempty"`        // Go text/template rendered with the JSON payload
+	Channel         string `json:"channel"`                   // channel the agent's reply is delivered to, e.g. "telegram"
+	ChatID          string `json:"chatId"`                    // chat on that channel
+}
+
+type MQTTConfig struct {
+	Enabled            bool              `json:"enabled"`
+	Broker             string            `json:"broker"`             // e.g. "tcp://127.0.0.1:1883" or "ssl://broker:8883"
+	ClientID           string            `json:"clientId,omitempty"` // defaults to "picobot"
+	Username           string            `json:"username,omitempty"`
+	Password           string            `json:"password,omitempty"`
+	QoS                int               `json:"qos"`                          // 0, 1 or 2, for subscriptions and replies
+	CAFile             string            `json:"caFile,omitempty"`             // extra CA certificate (PEM) for TLS brokers
+	CertFile           string            `json:"certFile,omitempty"`           // client certificate (PEM) for mutual TLS
+	KeyFile            string            `json:"keyFile,omitempty"`            // client key (PEM) for mutual TLS
+	InsecureSkipVerify bool              `json:"insecureSkipVerify,omitempty"` // don't verify the broker's certificate
+	ReplyTopic         string            `json:"replyTopic"`                   // default topic for agent replies
+	Topics             []MQTTTopicConfig `json:"topics"`
+}
+
+// MQTTTopicConfig is one subscription; Topic may contain + and # wildcards.
+type MQTTTopicConfig struct {
+	Topic      string `json:"topic"`
+	Template   string `json:"template,omitempty"`   // Go text/template rendered with .Topic, .Payload and .Raw
+	ReplyTopic string `json:"replyTopic,omitempty"` // overrides the channel's replyTopic
+}
+
+// UserConfig links a person's accounts on different channels to one user.
+type UserConfig struct {
+	Name          string   `json:"name"`
+	Identities    []string `json:"identities"`              // "channel:senderID", e.g. "telegram:123456789"
+	Roles         []string `json:"roles,omitempty"`         // e.g. "admin"
+	Profile       string   `json:"profile,omitempty"`       // what the agent should know about this user (like USER.md)
+	ShareSessions bool     `json:"shareSessions,omitempty"` // one conversation across all of the user's direct chats
+	ShareMemory   bool     `json:"shareMemory,omitempty"`   // one persistent memory history across channels
+}
+
+// PermissionsConfig limits which tools each role may use. Roles are given to
+// senders through the users section.
+type PermissionsConfig struct {
+	DefaultRole   string                `json:"defaultRole,omitempty"`   // role for senders without a configured role (empty = unrestricted)
+	HeartbeatRole string                `json:"heartbeatRole,omitempty"` // role HEARTBEAT.md tasks run as (empty = defaultRole)
+	Roles         map[string]RoleConfig `json:"roles,omitempty"`
+}
+
+// RoleConfig lists the tools a role may use. Entries are tool names, glob
+// patterns such as "*_skill", or "mcp:<server>" for a server's MCP tools.
+type RoleConfig struct {
+	Allow []string                     `json:"allow,omitempty"` // empty = all tools
+	Deny  []string                     `json:"deny,omitempty"`
+	Args  map[string]map[string]string `json:"args,omitempty"` // tool -> argument -> regexp the value must match
+}
+
+// RateLimitConfig throttles inbound messages before they reach the LLM.
+type RateLimitConfig struct {
+	Enabled      bool         `json:"enabled"`
+	PerSender    BucketConfig `json:"perSender"`            // per channel:sender
+	PerChannel   BucketConfig `json:"perChannel"`           // per channel, across all senders
+	MaxPending   int          `json:"maxPending,omitempty"` // messages accepted but not yet answered (0 = unlimited)
+	BanAfter     int          `json:"banAfter,omitempty"`   // violations within banWindowS that trigger a ban (0 = never ban)
+	BanWindowS   int          `json:"banWindowS,omitempty"`
+	BanDurationS int          `json:"banDurationS,omitempty"`
+	Message      string       `json:"message,omitempty"` // reply sent when a sender is throttled
+	Exempt       []string     `json:"exempt,omitempty"`  // "channel:senderID" identities that are never limited
+}
+
+// BucketConfig is a token bucket: Burst messages at once, refilled at
+// RefillPerMinute. A zero Burst disables the bucket.
+type BucketConfig struct {
+	Burst           int     `json:"burst"`
+	RefillPerMinute float64 `json:"refillPerMinute"`
+}
+
+// CronConfig configures the scheduler behind the cron tool.
+type CronConfig struct {
+	MissedRuns string `json:"missedRuns,omitempty"` // "once" (default), "skip" or "catchup": runs missed while picobot was down
+	TimeZone   string `json:"timeZone,omitempty"`   // IANA name for jobs that don't give one (empty = the system's local time)
+}
+
+// HeartbeatConfig says where the results of HEARTBEAT.md tasks are sent.
+type HeartbeatConfig struct {
+	DeliverTo  []string `json:"deliverTo,omitempty"`  // "channel:chatID", e.g. "telegram:123456789"; none = results are only logged
+	Silent     bool     `json:"silent,omitempty"`     // let the agent drop results with nothing noteworthy in them
+	QuietHours string   `json:"quietHours,omitempty"` // "22:00-07:00", in cron.timeZone: results are held until it ends
 }
 
 type ProvidersConfig struct {
@@ -0,0 +1,181 @@
+package config
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"math"
+	"reflect"
+	"sort"
+	"strings"
+)
+
+// CheckSchema compares a config file's JSON with the Config structure and
+// returns a *Problem for every unknown key and every value of the wrong
+// type. Unlike decoding, which stops at the first type error and ignores
+// unknown keys, it reports all of them.
+func CheckSchema(data []byte) []error {
+	dec := json.NewDecoder(bytes.NewReader(data))
+	dec.UseNumber()
+	var raw interface{}
+	if err := dec.Decode(&raw); err != nil {
+		return []error{&Problem{Path: "(file)", Message: "invalid JSON: " + err.Error()}}
+	}
+	var errs []error
+	checkSchema(raw, reflect.TypeOf(Config{}), "", &errs)
+	return errs
+}
+
+func checkSchema(v interface{}, t reflect.Type, path string, errs *[]error) {
+	add := func(format string, args ...interface{}) {
+		p := path
+		if p == "" {
+			p = "(root)"
+		}
+		*errs = append(*errs, &Problem{Path: p, Message: fmt.Sprintf(format, args...)})
+	}
+	if v == nil {
+		switch t.Kind() {
+		case reflect.Pointer, reflect.Slice, reflect.Map, reflect.Interface:
+		default:
+			add("must not be null")
+		}
+		return
+	}
+	if t.Kind() == reflect.Pointer {
+		t = t.Elem()
+	}
+	switch t.Kind() {
+	case reflect.Struct:
+		obj, ok := v.(map[string]interface{})
+		if !ok {
+			add("must be an object, not %s", jsonKind(v))
+			return
+		}
+		fields := jsonFields(t)
+		keys := make([]string, 0, len(obj))
+		for k := range obj {
+			keys = append(keys, k)
+		}
+		sort.Strings(keys)
+		for _, k := range keys {
+			f, ok := fields[k]
+			if !ok {
+				// encoding/json matches keys case-insensitively
+				for name, ff := range fields {
+					if strings.EqualFold(name, k) {
+						f, ok = ff, true
+					}
+				}
+			}
+			if !ok {
+				msg := fmt.Sprintf("unknown field %q", k)
+				if s := suggestField(k, fields); s != "" {
+					msg += fmt.Sprintf(" (did you mean %q?)", s)
+				}
+				*errs = append(*errs, &Problem{Path: joinPath(path, k), Message: msg})
+				continue
+			}
+			checkSchema(obj[k], f.Type, joinPath(path, k), errs)
+		}
+	case reflect.Map:
+		obj, ok := v.(map[string]interface{})
+		if !ok {
+			add("must be an object, not %s", jsonKind(v))
+			return
+		}
+		for k, e := range obj {
+			checkSchema(e, t.Elem(), joinPath(path, k), errs)
+		}
+	case reflect.Slice:
+		arr, ok := v.([]interface{})
+		if !ok {
+			add("must be an array, not %s", jsonKind(v))
+			return
+		}
+		for i, e := range arr {
+			checkSchema(e, t.Elem(), fmt.Sprintf("%s[%d]", path, i), errs)
+		}
+	case reflect.String:
+		if _, ok := v.(string); !ok {
+			add("must be a string, not %s", jsonKind(v))
+		}
+	case reflect.Bool:
+		if _, ok := v.(bool); !ok {
+			add("must be true or false, not %s", jsonKind(v))
+		}
+	case reflect.Int, reflect.Int64:
+		n, ok := v.(json.Number)
+		if !ok {
+			add("must be a number, not %s", jsonKind(v))
+			return
+		}
+		if f, err := n.Float64(); err != nil || f != math.Trunc(f) {
+			add("must be a whole number, not %s", n)
+		}
+	case reflect.Float32, reflect.Float64:
+		if _, ok := v.(json.Number); !ok {
+			add("must be a number, not %s", jsonKind(v))
+		}
+	}
+}
+
+// jsonFields maps a struct's JSON keys to its fields.
+func jsonFields(t reflect.Type) map[string]reflect.StructField {
+	fields := make(map[string]reflect.StructField)
+	for i := 0; i < t.NumField(); i++ {
+		tag, _, _ := strings.Cut(t.Field(i).Tag.Get("json"), ",")
+		if tag != "" && tag != "-" {
+			fields[tag] = t.Field(i)
+		}
+	}
+	return fields
+}
+
+func jsonKind(v interface{}) string {
+	switch v.(type) {
+	case map[string]interface{}:
+		return "an object"
+	case []interface{}:
+		return "an array"
+	case string:
+		return "a string"
+	case bool:
+		return "a boolean"
+	case json.Number:
+		return "a number"
+	}
+	return "null"
+}
+
+// suggestField returns the known key closest to an unknown one, if any is
+// close enough to be a likely typo.
+func suggestField(key string, fields map[string]reflect.StructField) string {
+	best, bestDist := "", 3
+	for name := range fields {
+		if d := editDistance(strings.ToLower(key), strings.ToLower(name)); d < bestDist || (d == bestDist && name < best) {
+			best, bestDist = name, d
+		}
+	}
+	return best
+}
+
+func editDistance(a, b string) int {
+	prev := make([]int, len(b)+1)
+	cur := make([]int, len(b)+1)
+	for j := range prev {
+		prev[j] = j
+	}
+	for i := 1; i <= len(a); i++ {
+		cur[0] = i
+		for j := 1; j <= len(b); j++ {
+			cost := 1
+			if a[i-1] == b[j-1] {
+				cost = 0
+			}
+			cur[j] = min(prev[j]+1, cur[j-1]+1, prev[j-1]+cost)
+		}
+		prev, cur = cur, prev
+	}
+	return prev[len(b)]
+}
@@ -0,0 +1,375 @@
+package config
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"path"
+	"regexp"
+	"slices"
+	"sort"
+	"strings"
+	"text/template"
+	"time"
+)
+
+// Problem is one mistake in the config, at the JSON path of the offending
+// field (e.g. "channels.telegram.token").
+type Problem struct {
+	Path    string
+	Message string
+}
+
+func (p *Problem) Error() string {
+	return p.Path + ": " + p.Message
+}
+
+// CheckFile reads the config at path and runs both the schema checks
+// (CheckSchema) and Validate on it. err is set if the file can't be used at
+// all; problems lists everything wrong with a file that loads.
+func CheckFile(path string) (cfg Config, problems []error, err error) {
+	data, _, err := readConfigJSON(path)
+	if err != nil {
+		return Config{}, nil, err
+	}
+	problems = CheckSchema(data)
+	cfg, err = decodeConfig(data)
+	if err == nil {
+		cfg, err = finishConfig(cfg)
+	}
+	if err != nil {
+		if len(problems) > 0 {
+			// the schema problems explain the decode error better
+			return Config{}, problems, nil
+		}
+		return Config{}, nil, err
+	}
+	if verr := cfg.Validate(); verr != nil {
+		problems = append(problems, verr.(interface{ Unwrap() []error }).Unwrap()...)
+	}
+	return cfg, problems, nil
+}
+
+// Validate checks the config for mistakes that would stop picobot from
+// starting or make a section silently misbehave. All problems are returned
+// together, each as a *Problem.
+func (c Config) Validate() error {
+	var errs []error
+	add := func(path, format string, args ...interface{}) {
+		errs = append(errs, &Problem{Path: path, Message: fmt.Sprintf(format, args...)})
+	}
+
+	d := c.Agents.Defaults
+	if d.Workspace == "" {
+		add("agents.defaults.workspace", "is required")
+	} else if strings.HasPrefix(d.Workspace, "~") && !strings.HasPrefix(d.Workspace, "~/") {
+		add("agents.defaults.workspace", "only a leading ~/ is expanded, use ~/... or an absolute path")
+	}
+	if d.Temperature < 0 || d.Temperature > 2 {
+		add("agents.defaults.temperature", "must be between 0 and 2, got %g", d.Temperature)
+	}
+	if d.MaxTokens < 0 {
+		add("agents.defaults.maxTokens", "must not be negative")
+	}
+	if d.MaxToolIterations < 0 {
+		add("agents.defaults.maxToolIterations", "must not be negative")
+	}
+	if d.HeartbeatIntervalS < 0 {
+		add("agents.defaults.heartbeatIntervalS", "must not be negative")
+	}
+
+	if p := c.Providers.OpenAI; p != nil {
+		if p.APIKey != "" && p.APIBase == "" {
+			add("providers.openai.apiBase", "is required when apiKey is set")
+		}
+		if p.Timeout < 0 {
+			add("providers.openai.timeout", "must not be negative")
+		}
+	}
+
+	ch := c.Channels
+	if ch.Telegram.Enabled && ch.Telegram.Token == "" {
+		add("channels.telegram.token", "is required")
+	}
+	if ch.Telegram.Pairing && len(ch.Telegram.AllowFrom) == 0 {
+		add("channels.telegram.pairing", "needs at least one owner in allowFrom")
+	}
+	if ch.Ntfy.Enabled && ch.Ntfy.Topic == "" {
+		add("channels.ntfy.topic", "is required")
+	}
+	if ch.HTTP.Enabled {
+		checkListen(add, "channels.http.listen", ch.HTTP.Listen)
+		if ch.HTTP.Token == "" {
+			add("channels.http.token", "is required")
+		}
+	}
+	if ch.Web.Enabled {
+		checkListen(add, "channels.web.listen", ch.Web.Listen)
+		if ch.Web.Token == "" {
+			add("channels.web.token", "is required")
+		}
+	}
+	if ch.Matrix.Enabled {
+		if ch.Matrix.Homeserver == "" {
+			add("channels.matrix.homeserver", "is required")
+		}
+		if ch.Matrix.AccessToken == "" {
+			add("channels.matrix.accessToken", "is required")
+		}
+	}
+	if ch.Email.Enabled {
+		for field, v := range map[string]string{"imapHost": ch.Email.IMAPHost, "smtpHost": ch.Email.SMTPHost, "username": ch.Email.Username} {
+			if v == "" {
+				add("channels.email."+field, "is required")
+			}
+		}
+	}
+	if ch.Slack.Enabled {
+		if !strings.HasPrefix(ch.Slack.AppToken, "xapp-") {
+			add("channels.slack.appToken", "must be an app-level token (xapp-...)")
+		}
+		if !strings.HasPrefix(ch.Slack.BotToken, "xoxb-") {
+			add("channels.slack.botToken", "must be a bot token (xoxb-...)")
+		}
+	}
+	if ch.Signal.Enabled {
+		if ch.Signal.Address == "" {
+			add("channels.signal.address", "is required")
+		}
+		if ch.Signal.Account == "" {
+			add("channels.signal.account", "is required")
+		}
+	}
+	if ch.Webhooks.Enabled {
+		checkListen(add, "channels.webhooks.listen", ch.Webhooks.Listen)
+		seen := make(map[string]bool)
+		for i, h := range ch.Webhooks.Hooks {
+			p := fmt.Sprintf("channels.webhooks.hooks[%d]", i)
+			switch {
+			case h.Name == "":
+				add(p+".name", "is required")
+			case seen[h.Name]:
+				add(p+".name", "duplicate hook %q", h.Name)
+			}
+			seen[h.Name] = true
+			if h.Secret == "" && h.HMACSecret == "" {
+				add(p+".secret", "secret or hmacSecret is required")
+			}
+			if h.Channel == "" {
+				add(p+".channel", "is required")
+			}
+			if h.ChatID == "" {
+				add(p+".chatId", "is required")
+			}
+			checkTemplate(add, p+".template", h.Template)
+		}
+	}
+	if ch.MQTT.Enabled {
+		if ch.MQTT.Broker == "" {
+			add("channels.mqtt.broker", "is required")
+		}
+		if ch.MQTT.QoS < 0 || ch.MQTT.QoS > 2 {
+			add("channels.mqtt.qos", "must be 0, 1 or 2")
+		}
+		if (ch.MQTT.CertFile == "") != (ch.MQTT.KeyFile == "") {
+			add("channels.mqtt.keyFile", "certFile and keyFile must be set together")
+		}
+		for i, t := range ch.MQTT.Topics {
+			p := fmt.Sprintf("channels.mqtt.topics[%d]", i)
+			if t.Topic == "" {
+				add(p+".topic", "is required")
+			}
+			checkTemplate(add, p+".template", t.Template)
+		}
+	}
+
+	identities := make(map[string]string)
+	for i, u := range c.Users {
+		p := fmt.Sprintf("users[%d]", i)
+		if u.Name == "" {
+			add(p+".name", "is required")
+		}
+		for j, id := range u.Identities {
+			if !strings.Contains(id, ":") {
+				add(fmt.Sprintf("%s.identities[%d]", p, j), "%q is not channel:senderID", id)
+			} else if other, ok := identities[id]; ok {
+				add(fmt.Sprintf("%s.identities[%d]", p, j), "%s already belongs to %s", id, other)
+			}
+			identities[id] = u.Name
+		}
+		for j, r := range u.Roles {
+			if _, ok := c.Permissions.Roles[r]; !ok && len(c.Permissions.Roles) > 0 {
+				add(fmt.Sprintf("%s.roles[%d]", p, j), "role %q is not defined in permissions.roles", r)
+			}
+		}
+	}
+
+	perm := c.Permissions
+	if perm.DefaultRole != "" {
+		if _, ok := perm.Roles[perm.DefaultRole]; !ok {
+			add("permissions.defaultRole", "role %q is not defined", perm.DefaultRole)
+		}
+	}
+	if perm.HeartbeatRole != "" {
+		if _, ok := perm.Roles[perm.HeartbeatRole]; !ok {
+			add("permissions.heartbeatRole", "role %q is not defined", perm.HeartbeatRole)
+		}
+	}
+	for name, r := range perm.Roles {
+		p := "permissions.roles." + name
+		for i, pat := range r.Allow {
+			checkToolPattern(add, fmt.Sprintf("%s.allow[%d]", p, i), pat)
+		}
+		for i, pat := range r.Deny {
+			checkToolPattern(add, fmt.Sprintf("%s.deny[%d]", p, i), pat)
+		}
+		for tool, args := range r.Args {
+			for arg, expr := range args {
+				if _, err := regexp.Compile(expr); err != nil {
+					add(p+".args."+tool+"."+arg, "invalid regexp: %v", err)
+				}
+			}
+		}
+	}
+
+	switch c.Cron.MissedRuns {
+	case "", "once", "skip", "catchup":
+	default:
+		add("cron.missedRuns", "must be once, skip or catchup, got %q", c.Cron.MissedRuns)
+	}
+	if c.Cron.TimeZone != "" {
+		if _, err := time.LoadLocation(c.Cron.TimeZone); err != nil {
+			add("cron.timeZone", "unknown time zone %q (use an IANA name such as Europe/Berlin)", c.Cron.TimeZone)
+		}
+	}
+
+	for i, target := range c.Heartbeat.DeliverTo {
+		p := fmt.Sprintf("heartbeat.deliverTo[%d]", i)
+		channel, chatID, _ := strings.Cut(target, ":")
+		switch {
+		case chatID == "":
+			add(p, "%q is not channel:chatID", target)
+		case !slices.Contains(DeliveryChannels, channel):
+			add(p, "unknown channel %q (use one of %s)", channel, strings.Join(DeliveryChannels, ", "))
+		}
+	}
+	if c.Heartbeat.QuietHours != "" {
+		if _, _, err := ParseQuietHours(c.Heartbeat.QuietHours); err != nil {
+			add("heartbeat.quietHours", "%v", err)
+		}
+	}
+
+	rl := c.RateLimit
+	for field, v := range map[string]float64{
+		"perSender.burst": float64(rl.PerSender.Burst), "perSender.refillPerMinute": rl.PerSender.RefillPerMinute,
+		"perChannel.burst": float64(rl.PerChannel.Burst), "perChannel.refillPerMinute": rl.PerChannel.RefillPerMinute,
+		"maxPending": float64(rl.MaxPending), "banAfter": float64(rl.BanAfter),
+		"banWindowS": float64(rl.BanWindowS), "banDurationS": float64(rl.BanDurationS),
+	} {
+		if v < 0 {
+			add("rateLimit."+field, "must not be negative")
+		}
+	}
+	if rl.BanAfter > 0 && (rl.BanWindowS <= 0 || rl.BanDurationS <= 0) {
+		add("rateLimit.banAfter", "needs banWindowS and banDurationS")
+	}
+
+	if m := c.Memory; m.Enabled {
+		if m.EmbedType != "onnx" {
+			add("memory.embedType", "unknown embedder %q (supported: onnx)", m.EmbedType)
+		}
+		if m.ONNXModelPath == "" {
+			add("memory.onnxModelPath", "is required")
+		}
+		if m.ONNXTokenizerPath == "" {
+			add("memory.onnxTokenizerPath", "is required")
+		}
+		if m.DbPath == "" {
+			add("memory.dbPath", "is required")
+		}
+	}
+
+	if c.Tools.MCP != nil && c.Tools.MCP.Enabled {
+		for name, srv := range c.Tools.MCP.Servers {
+			p := "tools.mcp.servers." + name
+			switch strings.ToLower(srv.Transport) {
+			case "stdio":
+				if srv.Command == "" {
+					add(p+".command", "is required for stdio")
+				}
+			case "http":
+				if !strings.HasPrefix(srv.URL, "http://") && !strings.HasPrefix(srv.URL, "https://") {
+					add(p+".url", "must be an http(s) URL")
+				}
+			default:
+				add(p+".transport", "unknown transport %q (supported: stdio, http)", srv.Transport)
+			}
+		}
+	}
+
+	// map iteration above is unordered; report problems in a stable order
+	sort.SliceStable(errs, func(i, j int) bool {
+		return errs[i].(*Problem).Path < errs[j].(*Problem).Path
+	})
+	return errors.Join(errs...)
+}
+
+// checkListen reports a malformed listen address; empty means the default.
+func checkListen(add func(string, string, ...interface{}), path, addr string) {
+	if addr == "" {
+		return
+	}
+	if _, _, err := net.SplitHostPort(addr); err != nil {
+		add(path, "invalid listen address %q", addr)
+	}
+}
+
+// checkTemplate parses a channel template; empty means the default.
+func checkTemplate(add func(string, string, ...interface{}), path, text string) {
+	if text == "" {
+		return
+	}
+	funcs := template.FuncMap{"json": func(interface{}) string { return "" }}
+	if _, err := template.New("").Funcs(funcs).Parse(text); err != nil {
+		add(path, "invalid template: %v", err)
+	}
+}
+
+// checkToolPattern checks an allow/deny entry: a tool name, a glob, or
+// "mcp:<server>".
+func checkToolPattern(add func(string, string, ...interface{}), p, pattern string) {
+	if _, err := path.Match(strings.TrimPrefix(pattern, "mcp:"), ""); err != nil {
+		add(p, "invalid tool pattern %q", pattern)
+	}
+}
+
+// DeliveryChannels are the channels picobot can send messages to on its own,
+// e.g. heartbeat results.
+var DeliveryChannels = []string{"telegram", "ntfy", "matrix", "email", "slack", "signal", "mqtt", "web", "http"}
+
+// ParseQuietHours reads a range of the day such as "22:00-07:00" and returns
+// its start and end as offsets from midnight. A range whose end is before
+// its start runs past midnight.
+func ParseQuietHours(s string) (from, to time.Duration, err error) {
+	a, b, ok := strings.Cut(s, "-")
+	if !ok {
+		return 0, 0, fmt.Errorf("%q is not a range like 22:00-07:00", s)
+	}
+	clock := func(v string) (time.Duration, error) {
+		t, err := time.Parse("15:04", strings.TrimSpace(v))
+		if err != nil {
+			return 0, fmt.Errorf("%q is not a time like 22:00", strings.TrimSpace(v))
+		}
+		return time.Duration(t.Hour())*time.Hour + time.Duration(t.Minute())*time.Minute, nil
+	}
+	if from, err = clock(a); err != nil {
+		return 0, 0, err
+	}
+	if to, err = clock(b); err != nil {
+		return 0, 0, err
+	}
+	if from == to {
+		return 0, 0, fmt.Errorf("%q starts and ends at the same time", s)
+	}
+	return from, to, nil
+}
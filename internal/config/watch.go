@@ -0,0 +1,59 @@
+package config
+
+import (
+	"context"
+	"log"
+	"os"
+	"time"
+)
+
+// watchInterval is how often Watch checks the config file for changes.
+const watchInterval = 2 * time.Second
+
+// Watch calls apply with the new config whenever the file at path changes,
+// or immediately when reload receives (e.g. on SIGHUP). A config that fails
+// to load or validate is logged and skipped, so a half-saved edit never
+// reaches the running gateway. Watch blocks until ctx is canceled.
+func Watch(ctx context.Context, path string, reload <-chan struct{}, apply func(Config)) {
+	last := fileStamp(path)
+	ticker := time.NewTicker(watchInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-reload:
+			log.Printf("config: reload requested")
+		case <-ticker.C:
+			stamp := fileStamp(path)
+			if stamp == last {
+				continue
+			}
+			log.Printf("config: %s changed", path)
+		}
+		last = fileStamp(path)
+		cfg, err := LoadConfigFile(path)
+		if err != nil {
+			log.Printf("config: not reloading, %s: %v", path, err)
+			continue
+		}
+		if err := cfg.Validate(); err != nil {
+			log.Printf("config: not reloading, invalid config:\n%v", err)
+			continue
+		}
+		apply(cfg)
+	}
+}
+
+type stamp struct {
+	modTime time.Time
+	size    int64
+}
+
+func fileStamp(path string) stamp {
+	fi, err := os.Stat(path)
+	if err != nil {
+		return stamp{}
+	}
+	return stamp{fi.ModTime(), fi.Size()}
+}
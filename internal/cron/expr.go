@@ -0,0 +1,230 @@
+package cron
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Expr is a standard 5-field cron expression:
+//
+//	minute hour day-of-month month day-of-week
+//
+// Fields take *, numbers, ranges (1-5), lists (1,15), steps (*/15, 9-17/2)
+// and, for months and weekdays, names (jan, mon). Sunday is 0 or 7. As in
+// classic cron, if both day fields are restricted a day matches either.
+// The macros @yearly, @monthly, @weekly, @daily and @hourly are accepted
+// too.
+//
+// Times are wall-clock times in the location of the time passed to Next.
+// Across DST changes a time that is skipped (02:30 when clocks jump from
+// 02:00 to 03:00) fires at the jump, and a time that happens twice fires
+// only the first time.
+type Expr struct {
+	minute, hour, dom, month, dow uint64 // bit sets
+	domStar, dowStar              bool
+}
+
+var macros = map[string]string{
+	"@yearly":   "0 0 1 1 *",
+	"@annually": "0 0 1 1 *",
+	"@monthly":  "0 0 1 * *",
+	"@weekly":   "0 0 * * 0",
+	"@daily":    "0 0 * * *",
+	"@midnight": "0 0 * * *",
+	"@hourly":   "0 * * * *",
+}
+
+var monthNames = []string{"jan", "feb", "mar", "apr", "may", "jun", "jul", "aug", "sep", "oct", "nov", "dec"}
+var dayNames = []string{"sun", "mon", "tue", "wed", "thu", "fri", "sat"}
+
+// ParseExpr parses a cron expression.
+func ParseExpr(s string) (*Expr, error) {
+	spec := strings.TrimSpace(s)
+	if m, ok := macros[strings.ToLower(spec)]; ok {
+		spec = m
+	}
+	fields := strings.Fields(spec)
+	if len(fields) != 5 {
+		return nil, fmt.Errorf("cron expression %q: want 5 fields (minute hour day-of-month month day-of-week), got %d", s, len(fields))
+	}
+	e := &Expr{domStar: fields[2] == "*", dowStar: fields[4] == "*"}
+	var err error
+	parse := func(i int, name string, lo, hi int, names []string, namesFrom int) uint64 {
+		if err != nil {
+			return 0
+		}
+		var bits uint64
+		bits, err = parseField(fields[i], lo, hi, names, namesFrom)
+		if err != nil {
+			err = fmt.Errorf("cron expression %q: %s: %w", s, name, err)
+		}
+		return bits
+	}
+	e.minute = parse(0, "minute", 0, 59, nil, 0)
+	e.hour = parse(1, "hour", 0, 23, nil, 0)
+	e.dom = parse(2, "day of month", 1, 31, nil, 0)
+	e.month = parse(3, "month", 1, 12, monthNames, 1)
+	e.dow = parse(4, "day of week", 0, 7, dayNames, 0)
+	if err != nil {
+		return nil, err
+	}
+	if e.dow&(1<<7) != 0 {
+		e.dow |= 1 // 7 is Sunday too
+	}
+	return e, nil
+}
+
+func parseField(f string, lo, hi int, names []string, namesFrom int) (uint64, error) {
+	var bits uint64
+	for _, part := range strings.Split(f, ",") {
+		rng, stepStr, hasStep := strings.Cut(part, "/")
+		step := 1
+		if hasStep {
+			n, err := strconv.Atoi(stepStr)
+			if err != nil || n <= 0 {
+				return 0, fmt.Errorf("invalid step %q", stepStr)
+			}
+			step = n
+		}
+		first, last := lo, hi
+		if rng != "*" {
+			a, b, isRange := strings.Cut(rng, "-")
+			var err error
+			if first, err = fieldValue(a, lo, hi, names, namesFrom); err != nil {
+				return 0, err
+			}
+			last = first
+			if isRange {
+				if last, err = fieldValue(b, lo, hi, names, namesFrom); err != nil {
+					return 0, err
+				}
+				if last < first {
+					return 0, fmt.Errorf("invalid range %q", rng)
+				}
+			} else if hasStep {
+				last = hi // 5/15 means 5, 20, 35, 50
+			}
+		}
+		for v := first; v <= last; v += step {
+			bits |= 1 << v
+		}
+	}
+	return bits, nil
+}
+
+func fieldValue(s string, lo, hi int, names []string, namesFrom int) (int, error) {
+	for i, n := range names {
+		if strings.EqualFold(s, n) {
+			return i + namesFrom, nil
+		}
+	}
+	v, err := strconv.Atoi(s)
+	if err != nil {
+		return 0, fmt.Errorf("invalid value %q", s)
+	}
+	if v < lo || v > hi {
+		return 0, fmt.Errorf("%d is out of range (%d-%d)", v, lo, hi)
+	}
+	return v, nil
+}
+
+// maxSearchDays bounds Next's search; it covers expressions like Feb 29
+// that match only once every few years.
+const maxSearchDays = 8 * 366
+
+// Next returns the first time after t that matches, in t's location, or
+// the zero time if there is none (e.g. "0 0 30 2 *").
+func (e *Expr) Next(t time.Time) time.Time {
+	loc := t.Location()
+	// search in wall-clock time, starting with the next whole minute
+	wall := time.Date(t.Year(), t.Month(), t.Day(), t.Hour(), t.Minute(), 0, 0, time.UTC).Add(time.Minute)
+	day := time.Date(wall.Year(), wall.Month(), wall.Day(), 0, 0, 0, 0, time.UTC)
+	for i := 0; i < maxSearchDays; i, day = i+1, day.AddDate(0, 0, 1) {
+		if !e.matchDay(day) {
+			continue
+		}
+		for h := 0; h < 24; h++ {
+			if e.hour&(1<<h) == 0 {
+				continue
+			}
+			for m := 0; m < 60; m++ {
+				if e.minute&(1<<m) == 0 {
+					continue
+				}
+				w := day.Add(time.Duration(h)*time.Hour + time.Duration(m)*time.Minute)
+				if w.Before(wall) {
+					continue
+				}
+				if at := instant(w, loc); at.After(t) {
+					return at
+				}
+			}
+		}
+	}
+	return time.Time{}
+}
+
+// MinGap returns the shortest time between two consecutive runs among the
+// runs in the year after t, or 0 if there is at most one.
+func (e *Expr) MinGap(t time.Time) time.Duration {
+	var gap time.Duration
+	limit := t.AddDate(1, 0, 0)
+	prev := e.Next(t)
+	for i := 0; i < 1500 && !prev.IsZero() && prev.Before(limit); i++ {
+		next := e.Next(prev)
+		if next.IsZero() {
+			break
+		}
+		if d := next.Sub(prev); gap == 0 || d < gap {
+			gap = d
+		}
+		prev = next
+	}
+	return gap
+}
+
+func (e *Expr) matchDay(day time.Time) bool {
+	if e.month&(1<<int(day.Month())) == 0 {
+		return false
+	}
+	domOK := e.dom&(1<<day.Day()) != 0
+	dowOK := e.dow&(1<<int(day.Weekday())) != 0
+	if !e.domStar && !e.dowStar {
+		return domOK || dowOK
+	}
+	return domOK && dowOK
+}
+
+// instant converts a wall-clock time (given in UTC) to an instant in loc.
+// A time skipped by a DST change maps to the change; a time that happens
+// twice maps to its first occurrence.
+func instant(wall time.Time, loc *time.Location) time.Time {
+	t := time.Date(wall.Year(), wall.Month(), wall.Day(), wall.Hour(), wall.Minute(), 0, 0, loc)
+	if !wallOf(t).Equal(wall) {
+		// in a gap: time.Date picked one side of it
+		start, end := t.ZoneBounds()
+		if wallOf(t).After(wall) {
+			return start
+		}
+		return end
+	}
+	// an earlier instant with the same wall time exists if the clocks
+	// went back at the start of t's zone period
+	start, _ := t.ZoneBounds()
+	if !start.IsZero() {
+		_, off := t.Zone()
+		_, prevOff := start.Add(-time.Second).Zone()
+		if prevOff > off {
+			if earlier := t.Add(-time.Duration(prevOff-off) * time.Second); wallOf(earlier).Equal(wall) {
+				return earlier
+			}
+		}
+	}
+	return t
+}
+
+func wallOf(t time.Time) time.Time {
+	return time.Date(t.Year(), t.Month(), t.Day(), t.Hour(), t.Minute(), t.Second(), t.Nanosecond(), time.UTC)
+}
@@ -0,0 +1,121 @@
+package cron
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// Run is one run of a job, as kept in the run log.
+type Run struct {
+	JobID   string    `json:"jobId"`
+	Name    string    `json:"name"`
+	Kind    string    `json:"kind"`
+	Channel string    `json:"channel"` // the job's chat, so runs stay attributable after the job is gone
+	ChatID  string    `json:"chatId"`
+	DueAt   time.Time `json:"dueAt"`
+	Start   time.Time `json:"start"`
+	End     time.Time `json:"end"`
+	Status  string    `json:"status"`           // RunOK or RunFailed
+	Output  string    `json:"output,omitempty"` // the start of what the run sent, or its error
+}
+
+// Run statuses.
+const (
+	RunOK     = "ok"
+	RunFailed = "failed"
+)
+
+// The run log keeps the last runsPerJob runs of each job, and no more than
+// maxRuns in all, with outputs cut to maxOutput characters.
+const (
+	runsPerJob = 20
+	maxRuns    = 1000
+	maxOutput  = 500
+)
+
+// runsPath is the run log next to the jobs file, or "" if the jobs are in
+// memory only.
+func (s *Scheduler) runsPath() string {
+	if s.path == "" {
+		return ""
+	}
+	return filepath.Join(filepath.Dir(s.path), "runs.json")
+}
+
+// Record adds a finished run to the run log, logging failures.
+func (s *Scheduler) Record(r Run) {
+	s.mu.Lock()
+	path := s.runsPath()
+	s.mu.Unlock()
+	if path == "" {
+		return
+	}
+	if rs := []rune(r.Output); len(rs) > maxOutput {
+		r.Output = string(rs[:maxOutput]) + "…"
+	}
+	s.runsMu.Lock()
+	defer s.runsMu.Unlock()
+	runs, err := readRuns(path)
+	if err != nil {
+		log.Printf("cron: %v; starting a new run log", err)
+	}
+	runs = append(runs, r)
+	// keep the newest runs, going back from the end
+	perJob := map[string]int{}
+	kept := make([]Run, 0, len(runs))
+	for i := len(runs) - 1; i >= 0 && len(kept) < maxRuns; i-- {
+		if perJob[runs[i].JobID]++; perJob[runs[i].JobID] <= runsPerJob {
+			kept = append(kept, runs[i])
+		}
+	}
+	for a, b := 0, len(kept)-1; a < b; a, b = a+1, b-1 {
+		kept[a], kept[b] = kept[b], kept[a]
+	}
+	if err := writeJSON(path, kept); err != nil {
+		log.Printf("cron: saving run log: %v", err)
+	}
+}
+
+// History returns the logged runs of a job, oldest first, or of all jobs
+// if id is "".
+func (s *Scheduler) History(id string) ([]Run, error) {
+	s.mu.Lock()
+	path := s.runsPath()
+	s.mu.Unlock()
+	if path == "" {
+		return nil, nil
+	}
+	s.runsMu.Lock()
+	defer s.runsMu.Unlock()
+	runs, err := readRuns(path)
+	if err != nil || id == "" {
+		return runs, err
+	}
+	var result []Run
+	for _, r := range runs {
+		if r.JobID == id {
+			result = append(result, r)
+		}
+	}
+	return result, nil
+}
+
+func readRuns(path string) ([]Run, error) {
+	data, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	var runs []Run
+	if err := json.Unmarshal(data, &runs); err != nil {
+		return nil, fmt.Errorf("invalid %s: %w", path, err)
+	}
+	return runs, nil
+}
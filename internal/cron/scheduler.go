@@ -1,35 +1,113 @@
 package cron
 
 import (
+	"encoding/json"
+	"errors"
 	"fmt"
 	"log"
+	"os"
+	"path/filepath"
+	"sort"
 	"sync"
 	"time"
 )
 
 // Job represents a scheduled task.
 type Job struct {
-	ID        string
-	Name      string
-	Message   string
-	FireAt    time.Time
-	Channel   string // originating channel (e.g., "telegram")
-	ChatID    string // originating chat ID
-	Recurring bool   // if true, re-schedule after firing
-	Interval  time.Duration
-	fired     bool
+	ID        string        `json:"id"`
+	Name      string        `json:"name"`
+	Message   string        `json:"message"`
+	FireAt    time.Time     `json:"fireAt"`              // next run; when passed to FireCallback, the time the run was due
+	Channel   string        `json:"channel"`             // originating channel (e.g., "telegram")
+	ChatID    string        `json:"chatId"`              // originating chat ID
+	Recurring bool          `json:"recurring,omitempty"` // if true, re-schedule after firing
+	Interval  time.Duration `json:"interval,omitempty"`  // in nanoseconds
+	Cron      string        `json:"cron,omitempty"`      // cron expression (see Expr); set instead of Interval
+	TimeZone  string        `json:"timeZone,omitempty"`  // IANA name Cron is read and times are shown in; "" = the scheduler's default
+
+	Kind     string                 `json:"kind,omitempty"`     // what firing does, see KindRemind etc.; "" = KindRemind
+	Tool     string                 `json:"tool,omitempty"`     // for KindTool
+	Args     map[string]interface{} `json:"args,omitempty"`     // for KindTool
+	SenderID string                 `json:"senderId,omitempty"` // who scheduled the job, on Channel
+
+	Paused       bool `json:"paused,omitempty"`       // if true, the job doesn't fire until resumed
+	RunRequested bool `json:"runRequested,omitempty"` // fire on the next tick, besides the schedule (see RunNow)
+}
+
+// Job kinds. The scheduler only keeps time; the fire callback decides what
+// each kind does.
+const (
+	KindRemind = "remind" // the agent relays Message to the chat
+	KindAgent  = "agent"  // the agent runs Message as a prompt and sends the result
+	KindTool   = "tool"   // Tool is called with Args and its output sent
+	KindRaw    = "raw"    // Message is sent as is, without the LLM
+)
+
+// Kinds lists the valid job kinds.
+var Kinds = []string{KindRemind, KindAgent, KindTool, KindRaw}
+
+// recurs reports whether the job runs more than once.
+func (j *Job) recurs() bool {
+	return j.Cron != "" || (j.Recurring && j.Interval > 0)
+}
+
+// Describe returns the job's schedule in words, e.g. "every 1h0m0s" or
+// "cron 0 8 * * 1-5 (Europe/Berlin)".
+func (j Job) Describe() string {
+	switch {
+	case j.Cron != "":
+		if j.TimeZone != "" {
+			return fmt.Sprintf("cron %s (%s)", j.Cron, j.TimeZone)
+		}
+		return "cron " + j.Cron
+	case j.Recurring:
+		return fmt.Sprintf("every %v", j.Interval)
+	}
+	return "once"
 }
 
 // FireCallback is called when a job fires. The scheduler passes the job details.
 type FireCallback func(job Job)
 
-// Scheduler manages in-memory scheduled jobs and fires them when due.
+// MissedPolicy says what happens to runs that fell due while picobot wasn't
+// running.
+type MissedPolicy string
+
+const (
+	// MissedOnce fires each overdue job once, however many runs it missed.
+	MissedOnce MissedPolicy = "once"
+	// MissedSkip drops overdue one-time jobs and moves recurring jobs on to
+	// their next run.
+	MissedSkip MissedPolicy = "skip"
+	// MissedCatchUp fires every missed run of a recurring job, up to
+	// maxCatchUp of them.
+	MissedCatchUp MissedPolicy = "catchup"
+)
+
+// maxCatchUp bounds the runs MissedCatchUp fires for one job, so a job that
+// runs every few minutes doesn't flood the chat after a long outage.
+const maxCatchUp = 10
+
+// Scheduler manages scheduled jobs and fires them when due. Jobs are kept in
+// memory and, once Persist has been called, in a file as well.
 type Scheduler struct {
 	mu       sync.Mutex
 	jobs     map[string]*Job
 	callback FireCallback
 	nextID   int
 	running  bool
+	path     string         // "" = in memory only
+	backlog  []Job          // missed runs to fire on the next tick
+	loc      *time.Location // default time zone for cron jobs
+	modTime  time.Time      // of the file when last read or written
+
+	runsMu sync.Mutex // serializes writes to the run log
+}
+
+// storeFile is the format of the persisted jobs.
+type storeFile struct {
+	NextID int    `json:"nextId"`
+	Jobs   []*Job `json:"jobs"`
 }
 
 // NewScheduler creates a new scheduler with the given fire callback.
@@ -37,53 +115,361 @@ func NewScheduler(callback FireCallback) *Scheduler {
 	return &Scheduler{
 		jobs:     make(map[string]*Job),
 		callback: callback,
+		loc:      time.Local,
 	}
 }
 
-// Add schedules a new job. Returns the job ID.
-func (s *Scheduler) Add(name, message string, delay time.Duration, channel, chatID string) string {
+// SetTimeZone sets the time zone for cron jobs that don't name their own.
+// It defaults to the local time zone.
+func (s *Scheduler) SetTimeZone(loc *time.Location) {
 	s.mu.Lock()
 	defer s.mu.Unlock()
-	s.nextID++
-	id := fmt.Sprintf("job-%d", s.nextID)
-	s.jobs[id] = &Job{
-		ID:      id,
-		Name:    name,
-		Message: message,
-		FireAt:  time.Now().Add(delay),
-		Channel: channel,
-		ChatID:  chatID,
+	s.loc = loc
+}
+
+// Location returns the named IANA time zone, or the default one for "".
+func (s *Scheduler) Location(name string) (*time.Location, error) {
+	if name == "" {
+		s.mu.Lock()
+		defer s.mu.Unlock()
+		return s.loc, nil
 	}
-	log.Printf("cron: scheduled job %q (%s) to fire in %v", name, id, delay)
-	return id
+	return time.LoadLocation(name)
 }
 
-// AddRecurring schedules a recurring job. Returns the job ID.
-func (s *Scheduler) AddRecurring(name, message string, interval time.Duration, channel, chatID string) string {
+// location returns the time zone a job's cron expression is read in.
+// Callers hold s.mu.
+func (s *Scheduler) location(j *Job) (*time.Location, error) {
+	if j.TimeZone == "" {
+		return s.loc, nil
+	}
+	return time.LoadLocation(j.TimeZone)
+}
+
+// nextAfter returns the job's first run after t, or the zero time if it has
+// no more runs. Callers hold s.mu.
+func (s *Scheduler) nextAfter(j *Job, t time.Time) time.Time {
+	switch {
+	case j.Cron != "":
+		e, err := ParseExpr(j.Cron)
+		if err != nil {
+			log.Printf("cron: job %s: %v", j.ID, err)
+			return time.Time{}
+		}
+		loc, err := s.location(j)
+		if err != nil {
+			log.Printf("cron: job %s: %v", j.ID, err)
+			return time.Time{}
+		}
+		return e.Next(t.In(loc))
+	case j.Recurring && j.Interval > 0:
+		return nextRun(j.FireAt, j.Interval, t)
+	}
+	return time.Time{}
+}
+
+// StorePath is where the jobs of the given workspace are saved.
+func StorePath(workspace string) string {
+	return filepath.Join(workspace, "cron", "jobs.json")
+}
+
+// Persist loads the jobs saved at path and saves every later change there.
+// Runs that fell due while the jobs were not loaded are handled according
+// to policy; they fire on the first tick after Start. A missing file is an
+// empty list of jobs.
+//
+// The file is re-read whenever it changes on disk, so jobs edited by
+// another process (see Open) take effect within a tick.
+func (s *Scheduler) Persist(path string, policy MissedPolicy) error {
 	s.mu.Lock()
 	defer s.mu.Unlock()
+	s.path = path
+	if err := s.reload(); err != nil {
+		return err
+	}
+	now := time.Now()
+	changed := false
+	for id, j := range s.jobs {
+		if !j.Paused && j.FireAt.Before(now) && s.missed(j, now, policy) {
+			changed = true
+			if j.FireAt.IsZero() {
+				delete(s.jobs, id)
+			}
+		}
+	}
+	log.Printf("cron: loaded %d job(s) from %s", len(s.jobs), path)
+	if changed {
+		s.save()
+	}
+	return nil
+}
+
+// Open returns a scheduler for managing the jobs saved at path without
+// running them, as the picobot CLI does. Changes are saved to the file,
+// where a running gateway picks them up; overdue runs are left for the
+// gateway to handle.
+func Open(path string) (*Scheduler, error) {
+	s := NewScheduler(nil)
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.path = path
+	if err := s.reload(); err != nil {
+		return nil, err
+	}
+	return s, nil
+}
+
+// reload re-reads the jobs file if it changed since it was last read or
+// written. Callers hold s.mu.
+func (s *Scheduler) reload() error {
+	if s.path == "" {
+		return nil
+	}
+	fi, err := os.Stat(s.path)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	if fi.ModTime().Equal(s.modTime) {
+		return nil
+	}
+	data, err := os.ReadFile(s.path)
+	if err != nil {
+		return err
+	}
+	var st storeFile
+	if err := json.Unmarshal(data, &st); err != nil {
+		return fmt.Errorf("invalid %s: %w", s.path, err)
+	}
+	jobs := make(map[string]*Job, len(st.Jobs))
+	for _, j := range st.Jobs {
+		if j.ID == "" {
+			continue
+		}
+		if j.Kind == "" {
+			j.Kind = KindRemind // saved before jobs had kinds
+		}
+		jobs[j.ID] = j
+	}
+	if !s.modTime.IsZero() {
+		log.Printf("cron: %s changed, reloaded %d job(s)", s.path, len(jobs))
+	}
+	s.jobs = jobs
+	s.nextID = max(s.nextID, st.NextID)
+	s.modTime = fi.ModTime()
+	return nil
+}
+
+// sync reloads the jobs file, logging failures: the jobs in memory stay as
+// they are until the file can be read. Callers hold s.mu.
+func (s *Scheduler) sync() {
+	if err := s.reload(); err != nil {
+		log.Printf("cron: %v", err)
+	}
+}
+
+// missed applies policy to a job that fell due at j.FireAt, before now. It
+// reports whether the job changed; a job that should be dropped is left
+// with a zero FireAt. Callers hold s.mu.
+func (s *Scheduler) missed(j *Job, now time.Time, policy MissedPolicy) bool {
+	if !j.recurs() {
+		if policy == MissedSkip {
+			log.Printf("cron: skipping job %q (%s), missed at %s", j.Name, j.ID, j.FireAt.Format(time.RFC3339))
+			j.FireAt = time.Time{}
+			return true
+		}
+		// a one-time job is fired by the first tick as it is
+		return false
+	}
+	var runs []Job
+	for t := j.FireAt; !t.IsZero() && t.Before(now); t = s.nextAfter(j, t) {
+		if len(runs) < maxCatchUp {
+			run := *j
+			run.FireAt = t
+			runs = append(runs, run)
+		}
+	}
+	switch policy {
+	case MissedSkip:
+		log.Printf("cron: skipping %d missed run(s) of job %q (%s)", len(runs), j.Name, j.ID)
+	case MissedCatchUp:
+		s.backlog = append(s.backlog, runs...)
+	default:
+		s.backlog = append(s.backlog, runs[0])
+	}
+	j.FireAt = s.nextAfter(j, now)
+	return true
+}
+
+// nextRun returns the first time after now that is a whole number of
+// intervals after last, so a recurring job keeps its rhythm.
+func nextRun(last time.Time, interval time.Duration, now time.Time) time.Time {
+	if last.After(now) {
+		return last
+	}
+	n := now.Sub(last)/interval + 1
+	return last.Add(n * interval)
+}
+
+// save writes the jobs to s.path atomically, logging failures: the jobs are
+// still scheduled in memory. Callers hold s.mu.
+func (s *Scheduler) save() {
+	if s.path == "" {
+		return
+	}
+	st := storeFile{NextID: s.nextID, Jobs: s.sorted()}
+	if err := writeJSON(s.path, st); err != nil {
+		log.Printf("cron: saving jobs: %v", err)
+		return
+	}
+	if fi, err := os.Stat(s.path); err == nil {
+		s.modTime = fi.ModTime()
+	}
+}
+
+func writeJSON(path string, v interface{}) error {
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		return err
+	}
+	data, err := json.MarshalIndent(v, "", "  ")
+	if err != nil {
+		return err
+	}
+	tmp := path + ".tmp"
+	if err := os.WriteFile(tmp, data, 0o600); err != nil {
+		return err
+	}
+	return os.Rename(tmp, path)
+}
+
+// sorted returns the jobs in order of their IDs. Callers hold s.mu.
+func (s *Scheduler) sorted() []*Job {
+	jobs := make([]*Job, 0, len(s.jobs))
+	for _, j := range s.jobs {
+		jobs = append(jobs, j)
+	}
+	sort.Slice(jobs, func(a, b int) bool {
+		if len(jobs[a].ID) != len(jobs[b].ID) {
+			return len(jobs[a].ID) < len(jobs[b].ID)
+		}
+		return jobs[a].ID < jobs[b].ID
+	})
+	return jobs
+}
+
+// Schedule adds a job and returns it with its ID and first run filled in.
+// A cron job (Cron set) is scheduled from its expression, in TimeZone or
+// the scheduler's default; an interval job (Recurring and Interval set)
+// first runs at FireAt, or one interval from now if FireAt is zero; any
+// other job runs once at FireAt.
+func (s *Scheduler) Schedule(j Job) (Job, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.sync()
+	now := time.Now()
+	if err := s.prepare(&j, now); err != nil {
+		return Job{}, err
+	}
+	if !j.FireAt.After(now) {
+		return Job{}, fmt.Errorf("%s is in the past", j.FireAt.Format(time.RFC3339))
+	}
 	s.nextID++
-	id := fmt.Sprintf("job-%d", s.nextID)
-	s.jobs[id] = &Job{
-		ID:        id,
-		Name:      name,
-		Message:   message,
-		FireAt:    time.Now().Add(interval),
-		Channel:   channel,
-		ChatID:    chatID,
-		Recurring: true,
-		Interval:  interval,
+	j.ID = fmt.Sprintf("job-%d", s.nextID)
+	s.jobs[j.ID] = &j
+	s.save()
+	log.Printf("cron: scheduled job %q (%s), %s, first run %s", j.Name, j.ID, j.Describe(), j.FireAt.Format(time.RFC3339))
+	return j, nil
+}
+
+// prepare checks a job's kind and schedule and fills in FireAt where the
+// schedule determines it. Callers hold s.mu.
+func (s *Scheduler) prepare(j *Job, now time.Time) error {
+	switch j.Kind {
+	case "":
+		j.Kind = KindRemind
+	case KindRemind, KindAgent, KindRaw:
+	case KindTool:
+		if j.Tool == "" {
+			return fmt.Errorf("a tool job needs a tool")
+		}
+	default:
+		return fmt.Errorf("unknown job kind %q", j.Kind)
+	}
+	if _, err := s.location(j); err != nil {
+		return fmt.Errorf("time zone %q: %w", j.TimeZone, err)
+	}
+	switch {
+	case j.Cron != "":
+		if _, err := ParseExpr(j.Cron); err != nil {
+			return err
+		}
+		j.Recurring, j.Interval = true, 0
+		if j.FireAt = s.nextAfter(j, now); j.FireAt.IsZero() {
+			return fmt.Errorf("cron expression %q never matches", j.Cron)
+		}
+	case j.Recurring:
+		if j.Interval <= 0 {
+			return fmt.Errorf("interval must be positive")
+		}
+		if j.FireAt.IsZero() {
+			j.FireAt = now.Add(j.Interval)
+		}
+	case j.FireAt.IsZero():
+		return fmt.Errorf("no time given")
+	}
+	return nil
+}
+
+// Update changes a job with edit and reschedules it as Schedule would. A
+// cron job's next run is recomputed; for other jobs, edit sets FireAt if
+// it changes the time, and a new FireAt must be in the future. The ID and
+// paused state stay as they are.
+func (s *Scheduler) Update(id string, edit func(j *Job)) (Job, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.sync()
+	old, ok := s.jobs[id]
+	if !ok {
+		return Job{}, fmt.Errorf("no job %q", id)
+	}
+	j := *old
+	edit(&j)
+	j.ID, j.Paused = old.ID, old.Paused
+	now := time.Now()
+	if err := s.prepare(&j, now); err != nil {
+		return Job{}, err
+	}
+	if !j.FireAt.Equal(old.FireAt) && !j.FireAt.After(now) {
+		return Job{}, fmt.Errorf("%s is in the past", j.FireAt.Format(time.RFC3339))
 	}
-	log.Printf("cron: scheduled recurring job %q (%s) every %v", name, id, interval)
-	return id
+	s.jobs[id] = &j
+	s.save()
+	log.Printf("cron: updated job %q (%s), %s, next run %s", j.Name, j.ID, j.Describe(), j.FireAt.Format(time.RFC3339))
+	return j, nil
+}
+
+// Add schedules a new job. Returns the job ID.
+func (s *Scheduler) Add(name, message string, delay time.Duration, channel, chatID string) string {
+	j, _ := s.Schedule(Job{Name: name, Message: message, FireAt: time.Now().Add(delay), Channel: channel, ChatID: chatID})
+	return j.ID
+}
+
+// AddRecurring schedules a recurring job. Returns the job ID.
+func (s *Scheduler) AddRecurring(name, message string, interval time.Duration, channel, chatID string) string {
+	j, _ := s.Schedule(Job{Name: name, Message: message, Channel: channel, ChatID: chatID, Recurring: true, Interval: interval})
+	return j.ID
 }
 
 // Cancel removes a job by ID. Returns true if found.
 func (s *Scheduler) Cancel(id string) bool {
 	s.mu.Lock()
 	defer s.mu.Unlock()
+	s.sync()
 	if _, ok := s.jobs[id]; ok {
 		delete(s.jobs, id)
+		s.save()
 		log.Printf("cron: cancelled job %s", id)
 		return true
 	}
@@ -94,9 +480,11 @@ func (s *Scheduler) Cancel(id string) bool {
 func (s *Scheduler) CancelByName(name string) bool {
 	s.mu.Lock()
 	defer s.mu.Unlock()
+	s.sync()
 	for id, j := range s.jobs {
 		if j.Name == name {
 			delete(s.jobs, id)
+			s.save()
 			log.Printf("cron: cancelled job %q (%s)", name, id)
 			return true
 		}
@@ -104,12 +492,69 @@ func (s *Scheduler) CancelByName(name string) bool {
 	return false
 }
 
+// Pause stops a job from firing until Resume. Returns false if there is no
+// such job.
+func (s *Scheduler) Pause(id string) (Job, bool) {
+	return s.set(id, "paused", func(j *Job) { j.Paused = true })
+}
+
+// Resume lets a paused job fire again. A recurring job that fell due while
+// paused moves on to its next run; a one-time job that did fires on the
+// next tick.
+func (s *Scheduler) Resume(id string) (Job, bool) {
+	return s.set(id, "resumed", func(j *Job) {
+		j.Paused = false
+		if now := time.Now(); j.recurs() && j.FireAt.Before(now) {
+			j.FireAt = s.nextAfter(j, now)
+		}
+	})
+}
+
+// RunNow fires a job on the next tick, paused or not, without changing its
+// schedule. The request is saved with the job, so a gateway picks it up
+// from a scheduler made with Open.
+func (s *Scheduler) RunNow(id string) (Job, bool) {
+	return s.set(id, "run requested for", func(j *Job) { j.RunRequested = true })
+}
+
+// set changes a job in place and saves it. Callers don't hold s.mu.
+func (s *Scheduler) set(id, what string, change func(j *Job)) (Job, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.sync()
+	j, ok := s.jobs[id]
+	if !ok {
+		return Job{}, false
+	}
+	change(j)
+	s.save()
+	log.Printf("cron: %s job %q (%s)", what, j.Name, j.ID)
+	return *j, true
+}
+
+// Find returns the job with the given ID or, failing that, name.
+func (s *Scheduler) Find(ref string) (Job, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.sync()
+	if j, ok := s.jobs[ref]; ok {
+		return *j, true
+	}
+	for _, j := range s.sorted() {
+		if j.Name == ref {
+			return *j, true
+		}
+	}
+	return Job{}, false
+}
+
 // List returns all pending jobs.
 func (s *Scheduler) List() []Job {
 	s.mu.Lock()
 	defer s.mu.Unlock()
+	s.sync()
 	result := make([]Job, 0, len(s.jobs))
-	for _, j := range s.jobs {
+	for _, j := range s.sorted() {
 		result = append(result, *j)
 	}
 	return result
@@ -137,29 +582,44 @@ func (s *Scheduler) Start(done <-chan struct{}) {
 // tick checks all jobs and fires any that are due.
 func (s *Scheduler) tick(now time.Time) {
 	s.mu.Lock()
-	// collect jobs to fire
-	var toFire []*Job
-	for _, j := range s.jobs {
-		if !j.fired && now.After(j.FireAt) {
-			toFire = append(toFire, j)
+	s.sync()
+	// collect jobs to fire, as they were when due
+	toFire := s.backlog
+	s.backlog = nil
+	requested := false
+	for _, j := range s.sorted() {
+		switch {
+		case j.RunRequested:
+			j.RunRequested, requested = false, true
+			run := *j
+			run.FireAt = now
+			toFire = append(toFire, run)
+		case !j.Paused && now.After(j.FireAt):
+			toFire = append(toFire, *j)
 		}
 	}
-	// handle fired jobs while still holding lock
+	// reschedule or remove fired jobs while still holding lock
 	for _, j := range toFire {
-		if j.Recurring {
-			j.FireAt = now.Add(j.Interval)
+		job, ok := s.jobs[j.ID]
+		if !ok || job.Paused || !now.After(job.FireAt) {
+			continue
+		}
+		if next := s.nextAfter(job, now); !next.IsZero() {
+			job.FireAt = next
 		} else {
-			j.fired = true
-			delete(s.jobs, j.ID)
+			delete(s.jobs, job.ID)
 		}
 	}
+	if len(toFire) > 0 || requested {
+		s.save()
+	}
 	s.mu.Unlock()
 
 	// fire callbacks outside lock
 	for _, j := range toFire {
 		log.Printf("cron: firing job %q (%s): %s", j.Name, j.ID, j.Message)
 		if s.callback != nil {
-			s.callback(*j)
+			s.callback(j)
 		}
 	}
 }
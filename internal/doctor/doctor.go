@@ -0,0 +1,227 @@
+// Package doctor implements the checks behind `picobot doctor`: it tries
+// out the configured provider, channels, MCP servers, memory and workspace
+// the way the gateway would, and reports what works and what doesn't.
+package doctor
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/local/picobot/internal/agent/memory"
+	"github.com/local/picobot/internal/agent/tools"
+	"github.com/local/picobot/internal/config"
+)
+
+// Status is the outcome of one check.
+type Status int
+
+const (
+	Pass Status = iota
+	Warn
+	Fail
+	Skip
+)
+
+// Result is one line of the report.
+type Result struct {
+	Name   string
+	Status Status
+	Detail string
+}
+
+// requestTimeout bounds every network check.
+const requestTimeout = 10 * time.Second
+
+// Run performs all checks against the config at cfgPath and returns the
+// results in report order.
+func Run(cfgPath string) []Result {
+	var results []Result
+	cfg, ok := checkConfig(cfgPath, &results)
+	if !ok {
+		return results
+	}
+	client := &http.Client{Timeout: requestTimeout}
+	results = append(results, checkWorkspace(config.ExpandHome(cfg.Agents.Defaults.Workspace)))
+	results = append(results, checkProvider(client, cfg))
+	results = append(results, checkTelegram(client, cfg.Channels.Telegram))
+	results = append(results, checkMCP(cfg.Tools)...)
+	results = append(results, checkMemory(cfg.Memory))
+	return results
+}
+
+// checkConfig loads the config and runs the schema and semantic checks. It
+// reports false if the config can't be used for the remaining checks.
+func checkConfig(path string, results *[]Result) (config.Config, bool) {
+	cfg, problems, err := config.CheckFile(path)
+	switch {
+	case errors.Is(err, os.ErrNotExist):
+		*results = append(*results, Result{"config", Fail, path + " not found (run picobot onboard)"})
+		return cfg, false
+	case err != nil:
+		*results = append(*results, Result{"config", Fail, err.Error()})
+		return cfg, false
+	case len(problems) == 0:
+		*results = append(*results, Result{"config", Pass, path})
+		checkVersion(path, results)
+		return cfg, true
+	}
+	for _, p := range problems {
+		*results = append(*results, Result{"config", Fail, p.Error()})
+	}
+	// a config with problems that still decodes is worth checking further
+	return cfg, cfg.Agents.Defaults.Workspace != ""
+}
+
+// checkVersion warns about a config file that is only upgraded in memory.
+func checkVersion(path string, results *[]Result) {
+	doc, err := config.OpenDocument(path)
+	if err != nil {
+		return
+	}
+	if from, changes, err := doc.Migrate(); err == nil && from < config.CurrentVersion {
+		*results = append(*results, Result{"config", Warn, fmt.Sprintf("version %d is outdated (%d change(s) pending); run picobot config migrate", from, len(changes))})
+	}
+}
+
+func checkWorkspace(dir string) Result {
+	const name = "workspace"
+	fi, err := os.Stat(dir)
+	if err != nil {
+		return Result{name, Fail, err.Error()}
+	}
+	if !fi.IsDir() {
+		return Result{name, Fail, dir + " is not a directory"}
+	}
+	f, err := os.CreateTemp(dir, ".doctor-*")
+	if err != nil {
+		return Result{name, Fail, "not writable: " + err.Error()}
+	}
+	f.Close()
+	os.Remove(f.Name())
+	var missing []string
+	for _, file := range []string{"SOUL.md", "AGENTS.md", "USER.md", "TOOLS.md", "HEARTBEAT.md", "memory", "skills"} {
+		if _, err := os.Stat(filepath.Join(dir, file)); err != nil {
+			missing = append(missing, file)
+		}
+	}
+	if len(missing) > 0 {
+		return Result{name, Warn, fmt.Sprintf("%s is missing %s (run picobot onboard to restore)", dir, strings.Join(missing, ", "))}
+	}
+	return Result{name, Pass, dir + " (writable)"}
+}
+
+// checkProvider lists the provider's models, which needs a valid API key
+// but costs no tokens, and looks for the configured model.
+func checkProvider(client *http.Client, cfg config.Config) Result {
+	const name = "provider"
+	p := cfg.Providers.OpenAI
+	if p == nil || p.APIKey == "" {
+		return Result{name, Warn, "no API key configured, using the stub provider"}
+	}
+	base := strings.TrimRight(p.APIBase, "/")
+	req, err := http.NewRequest("GET", base+"/models", nil)
+	if err != nil {
+		return Result{name, Fail, err.Error()}
+	}
+	req.Header.Set("Authorization", "Bearer "+p.APIKey)
+	resp, err := client.Do(req)
+	if err != nil {
+		return Result{name, Fail, fmt.Sprintf("%s unreachable: %v", base, err)}
+	}
+	defer resp.Body.Close()
+	switch {
+	case resp.StatusCode == http.StatusUnauthorized || resp.StatusCode == http.StatusForbidden:
+		return Result{name, Fail, fmt.Sprintf("%s rejected the API key (%s)", base, resp.Status)}
+	case resp.StatusCode != http.StatusOK:
+		return Result{name, Warn, fmt.Sprintf("%s/models returned %s; chat may still work", base, resp.Status)}
+	}
+	var models struct {
+		Data []struct {
+			ID string `json:"id"`
+		} `json:"data"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&models); err != nil {
+		return Result{name, Pass, base + " reachable, API key accepted"}
+	}
+	model := cfg.Agents.Defaults.Model
+	for _, m := range models.Data {
+		if m.ID == model {
+			return Result{name, Pass, fmt.Sprintf("%s reachable, model %s available", base, model)}
+		}
+	}
+	return Result{name, Warn, fmt.Sprintf("%s reachable, but model %q is not in its model list", base, model)}
+}
+
+func checkTelegram(client *http.Client, cfg config.TelegramConfig) Result {
+	const name = "telegram"
+	if !cfg.Enabled {
+		return Result{name, Skip, "disabled"}
+	}
+	resp, err := client.PostForm("https://api.telegram.org/bot"+cfg.Token+"/getMe", url.Values{})
+	if err != nil {
+		// the error contains the URL, and with it the token
+		return Result{name, Fail, "api.telegram.org unreachable"}
+	}
+	defer resp.Body.Close()
+	body, _ := io.ReadAll(resp.Body)
+	var me struct {
+		Ok          bool   `json:"ok"`
+		Description string `json:"description"`
+		Result      struct {
+			Username string `json:"username"`
+		} `json:"result"`
+	}
+	if err := json.Unmarshal(body, &me); err != nil || !me.Ok {
+		detail := me.Description
+		if detail == "" {
+			detail = resp.Status
+		}
+		return Result{name, Fail, "token rejected: " + detail}
+	}
+	return Result{name, Pass, "token valid, bot @" + me.Result.Username}
+}
+
+func checkMCP(cfg config.ToolsConfig) []Result {
+	if cfg.MCP == nil || !cfg.MCP.Enabled {
+		return []Result{{"mcp", Skip, "disabled"}}
+	}
+	names := make([]string, 0, len(cfg.MCP.Servers))
+	for n := range cfg.MCP.Servers {
+		names = append(names, n)
+	}
+	sort.Strings(names)
+	var results []Result
+	for _, n := range names {
+		count, err := tools.ProbeMCPServer(n, cfg.MCP.Servers[n])
+		if err != nil {
+			results = append(results, Result{"mcp " + n, Fail, err.Error()})
+			continue
+		}
+		results = append(results, Result{"mcp " + n, Pass, fmt.Sprintf("started, %d tools", count)})
+	}
+	if len(results) == 0 {
+		results = append(results, Result{"mcp", Warn, "enabled but no servers configured"})
+	}
+	return results
+}
+
+func checkMemory(cfg config.MemoryConfig) Result {
+	const name = "memory"
+	if !cfg.Enabled {
+		return Result{name, Skip, "disabled"}
+	}
+	dims, err := memory.ProbeEmbedder(cfg)
+	if err != nil {
+		return Result{name, Fail, err.Error()}
+	}
+	return Result{name, Pass, fmt.Sprintf("%s model and tokenizer loaded, %d-dimensional embeddings", cfg.EmbedType, dims)}
+}
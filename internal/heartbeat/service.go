@@ -2,18 +2,85 @@ package heartbeat
 
 import (
 	"context"
+	"crypto/sha256"
+	"fmt"
 	"log"
 	"os"
 	"path/filepath"
 	"strings"
+	"sync"
 	"time"
 
 	"github.com/local/picobot/internal/chat"
+	"github.com/local/picobot/internal/config"
 )
 
-// StartHeartbeat starts a periodic check that reads HEARTBEAT.md and pushes
-// its content into the agent's inbound chat hub for processing.
-func StartHeartbeat(ctx context.Context, workspace string, interval time.Duration, hub *chat.Hub) {
+// SkipReply is what the agent replies when a task's condition doesn't hold.
+const SkipReply = "SKIP"
+
+// NothingReply is what the agent replies in silent mode when a run found
+// nothing worth telling the user. Such results aren't delivered.
+const NothingReply = "NOTHING_TO_REPORT"
+
+// staleAfter is how long a dispatched task counts as running. After that it
+// can be dispatched again even if the agent never finished it.
+const staleAfter = 30 * time.Minute
+
+// service keeps the state of the heartbeat between ticks.
+type service struct {
+	path    string
+	loc     *time.Location
+	hub     *chat.Hub
+	targets []chat.Outbound // where results are delivered; Content is unset
+	silent  bool
+
+	quiet              bool          // whether quiet hours are set
+	quietFrom, quietTo time.Duration // since midnight, in loc
+
+	mu        sync.Mutex
+	fileHash  [sha256.Size]byte
+	file      *File
+	seen      map[string]time.Time // when each task was first seen
+	running   map[string]time.Time // tasks dispatched and not finished, by text
+	notesHash string               // of the notes last sent
+	held      []held               // results held during quiet hours
+}
+
+// held is a result waiting for quiet hours to end.
+type held struct {
+	at      time.Time
+	content string
+}
+
+// StartHeartbeat starts a periodic check of HEARTBEAT.md. Each tick, the
+// tasks that are due are sent to the agent one by one, and their outcome is
+// written back to the file when the agent is done; notes (see File) are
+// sent only when they changed since they were last sent. Times in the file
+// and quiet hours are read in loc.
+//
+// The agent's replies are delivered to cfg.DeliverTo, except during quiet
+// hours, when they are held until the quiet hours end.
+func StartHeartbeat(ctx context.Context, workspace string, interval time.Duration, loc *time.Location, cfg *config.HeartbeatConfig, hub *chat.Hub) {
+	s := &service{
+		path:    filepath.Join(workspace, "HEARTBEAT.md"),
+		loc:     loc,
+		hub:     hub,
+		silent:  cfg.Silent,
+		seen:    map[string]time.Time{},
+		running: map[string]time.Time{},
+	}
+	for _, target := range cfg.DeliverTo {
+		channel, chatID, _ := strings.Cut(target, ":")
+		s.targets = append(s.targets, chat.Outbound{Channel: channel, ChatID: chatID})
+	}
+	if cfg.QuietHours != "" {
+		var err error
+		if s.quietFrom, s.quietTo, err = config.ParseQuietHours(cfg.QuietHours); err != nil {
+			log.Printf("heartbeat: ignoring quietHours: %v", err)
+		} else {
+			s.quiet = true
+		}
+	}
 	go func() {
 		ticker := time.NewTicker(interval)
 		defer ticker.Stop()
@@ -23,27 +90,195 @@ func StartHeartbeat(ctx context.Context, workspace string, interval time.Duratio
 			case <-ctx.Done():
 				log.Println("heartbeat: stopping")
 				return
-			case <-ticker.C:
-				path := filepath.Join(workspace, "HEARTBEAT.md")
-				data, err := os.ReadFile(path)
-				if err != nil {
-					// file doesn't exist or can't be read — skip silently
-					continue
-				}
-				content := strings.TrimSpace(string(data))
-				if content == "" {
-					continue
-				}
-
-				// Push heartbeat content into the agent loop for processing
-				log.Println("heartbeat: sending tasks to agent")
-				hub.In <- chat.Inbound{
-					Channel:  "heartbeat",
-					ChatID:   "system",
-					SenderID: "heartbeat",
-					Content:  "[HEARTBEAT CHECK] Review and execute any pending tasks from HEARTBEAT.md:\n\n" + content,
-				}
+			case now := <-ticker.C:
+				s.tick(now)
 			}
 		}
 	}()
 }
+
+// tick dispatches whatever is due at now, and delivers held results once
+// quiet hours are over.
+func (s *service) tick(now time.Time) {
+	s.flush(now)
+	data, err := os.ReadFile(s.path)
+	if err != nil {
+		// file doesn't exist or can't be read — skip silently
+		return
+	}
+	s.mu.Lock()
+	var out []chat.Inbound
+	if h := sha256.Sum256(data); s.file == nil || h != s.fileHash {
+		s.fileHash, s.file = h, Parse(string(data), s.loc)
+		for _, e := range s.file.Errors {
+			log.Printf("heartbeat: HEARTBEAT.md: %s", e)
+		}
+	}
+	for _, t := range s.file.Tasks {
+		if _, ok := s.seen[t.Text]; !ok {
+			s.seen[t.Text] = now
+		}
+		if started, ok := s.running[t.Text]; ok && now.Sub(started) < staleAfter {
+			continue
+		}
+		if t.due(now, s.seen[t.Text], s.loc) {
+			s.running[t.Text] = now
+			out = append(out, s.taskMessage(t, now))
+		}
+	}
+	if notes := s.file.Notes; notes != "" && s.file.NotesHash() != s.notesHash {
+		if _, ok := s.running[""]; !ok {
+			s.running[""] = now
+			out = append(out, s.notesMessage(notes, s.file.NotesHash()))
+		}
+	}
+	s.mu.Unlock()
+
+	// the agent loop calls back into s when done, so send without s.mu
+	for _, msg := range out {
+		s.hub.In <- msg
+	}
+}
+
+// taskMessage returns the message that sends a task to the agent.
+func (s *service) taskMessage(t *Task, due time.Time) chat.Inbound {
+	var b strings.Builder
+	fmt.Fprintf(&b, "[HEARTBEAT TASK] %s\n", t.Text)
+	for _, d := range t.Details {
+		b.WriteString(d + "\n")
+	}
+	if t.If != "" {
+		fmt.Fprintf(&b, "\nOnly do this if: %s. Check that first; if it doesn't hold, reply with just %s.\n", t.If, SkipReply)
+	}
+	if !t.Last.IsZero() {
+		fmt.Fprintf(&b, "\nThis task last ran at %s.\n", t.Last.In(s.loc).Format(timeLayout))
+	}
+	b.WriteString(s.replyNote())
+	log.Printf("heartbeat: sending task %q to agent", t.Text)
+	text := t.Text
+	return message(b.String(), func(output string, err error) {
+		// a failed run counts as not run: recurring tasks wait for their
+		// next run, one-time tasks are retried after recheckAfter
+		ran := err == nil && strings.TrimSpace(output) != SkipReply
+		switch {
+		case err != nil:
+			log.Printf("heartbeat: task %q failed: %v", text, err)
+		case !ran:
+			log.Printf("heartbeat: task %q skipped, its condition doesn't hold", text)
+		default:
+			s.deliver(output, time.Now())
+		}
+		if err := record(s.path, text, ran, due, s.loc); err != nil {
+			log.Printf("heartbeat: recording task %q: %v", text, err)
+		}
+		// only now, so the next tick sees the recorded run
+		s.mu.Lock()
+		delete(s.running, text)
+		s.mu.Unlock()
+	})
+}
+
+// notesMessage returns the message that sends the notes to the agent.
+func (s *service) notesMessage(notes, hash string) chat.Inbound {
+	log.Println("heartbeat: HEARTBEAT.md notes changed, sending them to agent")
+	content := "[HEARTBEAT CHECK] Review and execute any pending tasks from HEARTBEAT.md:\n\n" + notes + "\n" + s.replyNote()
+	return message(content, func(output string, err error) {
+		if err == nil {
+			s.deliver(output, time.Now())
+		}
+		s.mu.Lock()
+		defer s.mu.Unlock()
+		delete(s.running, "")
+		if err == nil {
+			s.notesHash = hash
+		}
+	})
+}
+
+// replyNote tells the agent what happens to its reply.
+func (s *service) replyNote() string {
+	if len(s.targets) == 0 {
+		return ""
+	}
+	note := "\nYour reply is sent to the user as is."
+	if s.silent {
+		note += fmt.Sprintf(" If there is nothing noteworthy to tell them, reply with just %s.", NothingReply)
+	}
+	return note + "\n"
+}
+
+// deliver sends a result to the delivery targets, or holds it if now is in
+// quiet hours.
+func (s *service) deliver(content string, now time.Time) {
+	switch {
+	case strings.TrimSpace(content) == NothingReply:
+		log.Println("heartbeat: nothing to report")
+		return
+	case len(s.targets) == 0:
+		log.Println("heartbeat: result not delivered, heartbeat.deliverTo is not set")
+		return
+	}
+	s.mu.Lock()
+	if s.inQuietHours(now) {
+		s.held = append(s.held, held{at: now, content: content})
+		s.mu.Unlock()
+		log.Println("heartbeat: quiet hours, holding result")
+		return
+	}
+	s.mu.Unlock()
+	s.send(content)
+}
+
+// flush delivers the held results once quiet hours are over.
+func (s *service) flush(now time.Time) {
+	s.mu.Lock()
+	if len(s.held) == 0 || s.inQuietHours(now) {
+		s.mu.Unlock()
+		return
+	}
+	results := s.held
+	s.held = nil
+	s.mu.Unlock()
+	log.Printf("heartbeat: quiet hours over, delivering %d held result(s)", len(results))
+	for _, r := range results {
+		s.send(fmt.Sprintf("(held during quiet hours, from %s)\n\n%s", r.at.In(s.loc).Format("15:04"), r.content))
+	}
+}
+
+// inQuietHours reports whether t is in quiet hours.
+func (s *service) inQuietHours(t time.Time) bool {
+	if !s.quiet {
+		return false
+	}
+	t = t.In(s.loc)
+	day := time.Duration(t.Hour())*time.Hour + time.Duration(t.Minute())*time.Minute
+	if s.quietFrom < s.quietTo {
+		return day >= s.quietFrom && day < s.quietTo
+	}
+	return day >= s.quietFrom || day < s.quietTo
+}
+
+// send delivers content to every target.
+func (s *service) send(content string) {
+	for _, target := range s.targets {
+		out := target
+		out.Content = content
+		select {
+		case s.hub.Out <- out:
+		default:
+			log.Printf("Outbound channel full, dropping heartbeat result for %s:%s", out.Channel, out.ChatID)
+		}
+	}
+}
+
+// message is a heartbeat message for the agent loop, with done called when
+// the agent has finished with it.
+func message(content string, done func(output string, err error)) chat.Inbound {
+	return chat.Inbound{
+		Channel:  "heartbeat",
+		ChatID:   "system",
+		SenderID: "heartbeat",
+		Content:  content,
+		Metadata: map[string]interface{}{chat.MetaJob: &chat.JobRun{ID: "heartbeat", Done: done}},
+	}
+}
@@ -0,0 +1,258 @@
+package heartbeat
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"os"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/local/picobot/internal/cron"
+)
+
+// A Task is a checklist item in HEARTBEAT.md:
+//
+//	## Periodic Tasks
+//
+//	- [ ] Check https://example.com/health and tell me if it's down
+//	  - every: 30m
+//	  - if: it's a weekday
+//	  - last: 2026-03-03 14:00
+//
+// The indented "key: value" items set the schedule (every, cron or at) and
+// a condition (if) the agent checks before acting. picobot writes last
+// after each run of a recurring task, and ticks one-time tasks off with
+// done. Other indented lines are details sent along with the task.
+type Task struct {
+	Text    string   // the task line, after the checkbox
+	Details []string // indented lines that aren't attributes
+	Done    bool     // ticked off
+
+	Every time.Duration
+	Cron  string
+	At    time.Time
+	If    string
+	Last  time.Time // last run, written by picobot
+
+	expr *cron.Expr
+}
+
+// timeLayout is how picobot writes times into HEARTBEAT.md. at, last and
+// done are read in the same layout, in the heartbeat's time zone.
+const timeLayout = "2006-01-02 15:04"
+
+// recheckAfter is how long a one-time task whose condition didn't hold
+// waits before it is checked again.
+const recheckAfter = time.Hour
+
+var (
+	taskRE = regexp.MustCompile(`^[-*] \[([ xX])\]\s+(.+)$`)
+	itemRE = regexp.MustCompile(`^\s*(?:[-*+]|\d+[.)])\s+\S`)
+	attrRE = regexp.MustCompile(`^\s+[-*]\s+(every|cron|at|if|last|done):\s*(.*)$`)
+)
+
+// recurs reports whether the task runs on a schedule rather than once.
+func (t *Task) recurs() bool {
+	return t.Every > 0 || t.Cron != ""
+}
+
+// due reports whether the task should run at now. seen is when the task
+// was first seen, which a cron task that never ran counts from.
+func (t *Task) due(now, seen time.Time, loc *time.Location) bool {
+	switch {
+	case t.Done:
+		return false
+	case t.Every > 0:
+		return t.Last.IsZero() || !now.Before(t.Last.Add(t.Every))
+	case t.expr != nil:
+		from := t.Last
+		if from.IsZero() {
+			from = seen
+		}
+		next := t.expr.Next(from.In(loc))
+		return !next.IsZero() && !now.Before(next)
+	case !t.At.IsZero() && now.Before(t.At):
+		return false
+	}
+	return t.Last.IsZero() || !now.Before(t.Last.Add(recheckAfter))
+}
+
+// File is a parsed HEARTBEAT.md.
+type File struct {
+	Tasks []*Task
+	// Notes are list items without a checkbox, outside HTML comments:
+	// free-form tasks as HEARTBEAT.md had them before checklists. They
+	// are sent to the agent together, whenever they change.
+	Notes string
+	// Errors describes task attributes that couldn't be read; those tasks
+	// are left out.
+	Errors []string
+}
+
+// NotesHash identifies the notes' content.
+func (f *File) NotesHash() string {
+	sum := sha256.Sum256([]byte(f.Notes))
+	return hex.EncodeToString(sum[:])
+}
+
+// Parse reads the tasks and notes in HEARTBEAT.md content.
+func Parse(content string, loc *time.Location) *File {
+	f := &File{}
+	var notes []string
+	var task *Task
+	var taskErr error
+	flush := func() {
+		if task == nil {
+			return
+		}
+		if taskErr != nil {
+			f.Errors = append(f.Errors, fmt.Sprintf("task %q: %v", task.Text, taskErr))
+		} else {
+			f.Tasks = append(f.Tasks, task)
+		}
+		task, taskErr = nil, nil
+	}
+	inComment := false
+	for _, line := range strings.Split(content, "\n") {
+		trimmed := strings.TrimSpace(line)
+		if inComment || strings.HasPrefix(trimmed, "<!--") {
+			inComment = !strings.Contains(trimmed, "-->")
+			continue
+		}
+		if m := taskRE.FindStringSubmatch(line); m != nil {
+			flush()
+			task = &Task{Text: strings.TrimSpace(m[2]), Done: m[1] != " "}
+			continue
+		}
+		if task != nil && line != "" && (line[0] == ' ' || line[0] == '\t') {
+			if m := attrRE.FindStringSubmatch(line); m != nil {
+				if err := task.set(m[1], strings.TrimSpace(m[2]), loc); err != nil && taskErr == nil {
+					taskErr = err
+				}
+			} else {
+				task.Details = append(task.Details, trimmed)
+			}
+			continue
+		}
+		flush()
+		if itemRE.MatchString(line) {
+			notes = append(notes, strings.TrimRight(line, " \t"))
+		}
+	}
+	flush()
+	f.Notes = strings.Join(notes, "\n")
+	return f
+}
+
+func (t *Task) set(key, value string, loc *time.Location) error {
+	var err error
+	switch key {
+	case "every":
+		if t.Every, err = time.ParseDuration(value); err == nil && t.Every < time.Minute {
+			err = fmt.Errorf("every: %v is less than a minute", t.Every)
+		}
+	case "cron":
+		t.Cron = value
+		t.expr, err = cron.ParseExpr(value)
+	case "at":
+		t.At, err = time.ParseInLocation(timeLayout, value, loc)
+	case "if":
+		t.If = value
+	case "last":
+		t.Last, err = time.ParseInLocation(timeLayout, value, loc)
+	case "done":
+		// informational; the checkbox says whether the task is done
+	}
+	if err != nil && !strings.HasPrefix(err.Error(), key+":") {
+		err = fmt.Errorf("%s: %w", key, err)
+	}
+	if t.Every > 0 && t.Cron != "" {
+		err = fmt.Errorf("give either every or cron, not both")
+	}
+	return err
+}
+
+// record writes the outcome of a run of the task with the given text back
+// to the file at path: last for a recurring task or one whose condition
+// didn't hold, the checkbox and done for a one-time task that ran. It
+// re-reads the file, so edits made meanwhile are kept; if the task is gone
+// or was reworded, nothing is written.
+func record(path, text string, ran bool, at time.Time, loc *time.Location) error {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return err
+	}
+	lines := strings.Split(string(data), "\n")
+	start := -1
+	var task *Task
+	for i, line := range lines {
+		if m := taskRE.FindStringSubmatch(line); m != nil && strings.TrimSpace(m[2]) == text {
+			start = i
+			task = Parse(line+"\n"+attrBlock(lines[i+1:]), loc).first()
+			break
+		}
+	}
+	if start < 0 || task == nil {
+		return nil
+	}
+	end := start + 1
+	for end < len(lines) && lines[end] != "" && (lines[end][0] == ' ' || lines[end][0] == '\t') {
+		end++
+	}
+	stamp := at.In(loc).Format(timeLayout)
+	block := append([]string{}, lines[start:end]...)
+	if ran && !task.recurs() {
+		block[0] = strings.Replace(block[0], "[ ]", "[x]", 1)
+		block = setAttr(block, "done", stamp)
+	} else {
+		block = setAttr(block, "last", stamp)
+	}
+	lines = append(lines[:start], append(block, lines[end:]...)...)
+
+	perm := os.FileMode(0o644)
+	if fi, err := os.Stat(path); err == nil {
+		perm = fi.Mode().Perm()
+	}
+	tmp := path + ".tmp"
+	if err := os.WriteFile(tmp, []byte(strings.Join(lines, "\n")), perm); err != nil {
+		return err
+	}
+	return os.Rename(tmp, path)
+}
+
+// attrBlock returns the indented lines at the start of lines.
+func attrBlock(lines []string) string {
+	var b strings.Builder
+	for _, l := range lines {
+		if l == "" || (l[0] != ' ' && l[0] != '\t') {
+			break
+		}
+		b.WriteString(l + "\n")
+	}
+	return b.String()
+}
+
+func (f *File) first() *Task {
+	if len(f.Tasks) == 0 {
+		return nil
+	}
+	return f.Tasks[0]
+}
+
+// setAttr sets an attribute in a task's lines, replacing it if present and
+// adding it at the end otherwise.
+func setAttr(block []string, key, value string) []string {
+	indent := "  "
+	for i, l := range block[1:] {
+		if m := attrRE.FindStringSubmatch(l); m != nil {
+			indent = l[:len(l)-len(strings.TrimLeft(l, " \t"))]
+			if m[1] == key {
+				block[i+1] = fmt.Sprintf("%s- %s: %s", indent, key, value)
+				return block
+			}
+		}
+	}
+	return append(block, fmt.Sprintf("%s- %s: %s", indent, key, value))
+}
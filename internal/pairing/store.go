@@ -0,0 +1,247 @@
+package pairing
+
+import (
+	"crypto/rand"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/local/picobot/internal/config"
+)
+
+// CodeTTL is how long a pairing code stays valid.
+const CodeTTL = time.Hour
+
+// maxPending bounds outstanding requests so strangers can't flood the file.
+const maxPending = 20
+
+// codeAlphabet avoids characters that are easy to confuse (0/O, 1/I/L).
+const codeAlphabet = "ABCDEFGHJKMNPQRSTUVWXYZ23456789"
+
+// Request is a pending pairing request from an unknown sender.
+type Request struct {
+	Code     string    `json:"code"`
+	Channel  string    `json:"channel"`
+	SenderID string    `json:"senderId"`
+	ChatID   string    `json:"chatId"`
+	Name     string    `json:"name,omitempty"`
+	Created  time.Time `json:"created"`
+}
+
+// Paired is an approved sender.
+type Paired struct {
+	Channel    string    `json:"channel"`
+	SenderID   string    `json:"senderId"`
+	Name       string    `json:"name,omitempty"`
+	Approved   time.Time `json:"approved"`
+	ApprovedBy string    `json:"approvedBy,omitempty"`
+}
+
+type state struct {
+	Pending []Request `json:"pending"`
+	Paired  []Paired  `json:"paired"`
+}
+
+// Store is the runtime allow-list, kept in a JSON file so the gateway and the
+// picobot CLI can share it. The file is re-read whenever it changes on disk,
+// so approvals made by another process take effect immediately.
+type Store struct {
+	path    string
+	mu      sync.Mutex
+	state   state
+	modTime time.Time
+}
+
+// DefaultPath is pairing.json next to the config file in use, normally
+// ~/.picobot/pairing.json. It deliberately lives outside the workspace,
+// where the agent's filesystem tool could edit it.
+func DefaultPath() string {
+	return filepath.Join(config.StateDir(), "pairing.json")
+}
+
+// Open returns a store backed by path. A missing file is an empty store.
+func Open(path string) *Store {
+	s := &Store{path: path}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if err := s.reload(); err != nil {
+		// keep going with an empty list; the next successful write repairs the file
+		log.Printf("pairing: %v", err)
+	}
+	return s
+}
+
+// reload re-reads the file if it changed since the last read. Callers hold s.mu.
+func (s *Store) reload() error {
+	fi, err := os.Stat(s.path)
+	if errors.Is(err, os.ErrNotExist) {
+		s.state = state{}
+		s.modTime = time.Time{}
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	if fi.ModTime().Equal(s.modTime) {
+		return nil
+	}
+	data, err := os.ReadFile(s.path)
+	if err != nil {
+		return err
+	}
+	var st state
+	if err := json.Unmarshal(data, &st); err != nil {
+		return fmt.Errorf("invalid %s: %w", s.path, err)
+	}
+	s.state = st
+	s.modTime = fi.ModTime()
+	return nil
+}
+
+// save writes the state atomically. Callers hold s.mu.
+func (s *Store) save() error {
+	if err := os.MkdirAll(filepath.Dir(s.path), 0o700); err != nil {
+		return err
+	}
+	data, err := json.MarshalIndent(s.state, "", "  ")
+	if err != nil {
+		return err
+	}
+	tmp := s.path + ".tmp"
+	if err := os.WriteFile(tmp, data, 0o600); err != nil {
+		return err
+	}
+	if err := os.Rename(tmp, s.path); err != nil {
+		return err
+	}
+	if fi, err := os.Stat(s.path); err == nil {
+		s.modTime = fi.ModTime()
+	}
+	return nil
+}
+
+// expire drops pending requests older than CodeTTL. Callers hold s.mu.
+func (s *Store) expire(now time.Time) bool {
+	kept := s.state.Pending[:0]
+	for _, r := range s.state.Pending {
+		if now.Sub(r.Created) < CodeTTL {
+			kept = append(kept, r)
+		}
+	}
+	changed := len(kept) != len(s.state.Pending)
+	s.state.Pending = kept
+	return changed
+}
+
+// IsPaired reports whether the sender has been approved.
+func (s *Store) IsPaired(channel, senderID string) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if err := s.reload(); err != nil {
+		log.Printf("pairing: %v", err)
+	}
+	for _, p := range s.state.Paired {
+		if p.Channel == channel && p.SenderID == senderID {
+			return true
+		}
+	}
+	return false
+}
+
+// Request returns a pairing code for an unknown sender. A sender who already
+// has a valid code gets the same one back with isNew false.
+func (s *Store) Request(channel, senderID, chatID, name string) (code string, isNew bool, err error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if err := s.reload(); err != nil {
+		return "", false, err
+	}
+	now := time.Now()
+	changed := s.expire(now)
+	for _, r := range s.state.Pending {
+		if r.Channel == channel && r.SenderID == senderID {
+			if changed {
+				err = s.save()
+			}
+			return r.Code, false, err
+		}
+	}
+	if len(s.state.Pending) >= maxPending {
+		if changed {
+			s.save()
+		}
+		return "", false, errors.New("too many pending pairing requests")
+	}
+	code, err = newCode()
+	if err != nil {
+		return "", false, err
+	}
+	s.state.Pending = append(s.state.Pending, Request{Code: code, Channel: channel, SenderID: senderID, ChatID: chatID, Name: name, Created: now})
+	return code, true, s.save()
+}
+
+// Approve turns the pending request with the given code into a paired sender.
+func (s *Store) Approve(code, by string) (Request, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if err := s.reload(); err != nil {
+		return Request{}, err
+	}
+	s.expire(time.Now())
+	code = strings.ToUpper(strings.TrimSpace(code))
+	for i, r := range s.state.Pending {
+		if r.Code != code {
+			continue
+		}
+		s.state.Pending = append(s.state.Pending[:i], s.state.Pending[i+1:]...)
+		s.state.Paired = append(s.state.Paired, Paired{Channel: r.Channel, SenderID: r.SenderID, Name: r.Name, Approved: time.Now(), ApprovedBy: by})
+		return r, s.save()
+	}
+	return Request{}, fmt.Errorf("no pending request with code %s (codes expire after %s)", code, CodeTTL)
+}
+
+// Revoke removes a paired sender. It returns false if the sender wasn't paired.
+func (s *Store) Revoke(channel, senderID string) (bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if err := s.reload(); err != nil {
+		return false, err
+	}
+	for i, p := range s.state.Paired {
+		if p.Channel == channel && p.SenderID == senderID {
+			s.state.Paired = append(s.state.Paired[:i], s.state.Paired[i+1:]...)
+			return true, s.save()
+		}
+	}
+	return false, nil
+}
+
+// List returns the valid pending requests and the paired senders.
+func (s *Store) List() ([]Request, []Paired, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if err := s.reload(); err != nil {
+		return nil, nil, err
+	}
+	s.expire(time.Now())
+	pending := append([]Request(nil), s.state.Pending...)
+	paired := append([]Paired(nil), s.state.Paired...)
+	return pending, paired, nil
+}
+
+func newCode() (string, error) {
+	b := make([]byte, 6)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	for i := range b {
+		b[i] = codeAlphabet[int(b[i])%len(codeAlphabet)]
+	}
+	return string(b), nil
+}
@@ -0,0 +1,258 @@
+package ratelimit
+
+import (
+	"expvar"
+	"sync"
+	"time"
+
+	"github.com/local/picobot/internal/config"
+)
+
+// Stats counts throttle events. Published through expvar as "ratelimit"
+// (served on the HTTP channel at /debug/vars).
+var Stats = expvar.NewMap("ratelimit")
+
+// maxTrackedSenders is the sender table size at which idle entries are pruned.
+const maxTrackedSenders = 10000
+
+// DefaultMessage is the reply sent to a throttled sender.
+const DefaultMessage = "You're sending messages faster than I can keep up with. Please wait a moment and try again."
+
+// Verdict is the outcome of Limiter.Allow.
+type Verdict int
+
+const (
+	// Allowed means the message may be processed.
+	Allowed Verdict = iota
+	// Throttled means a bucket is empty.
+	Throttled
+	// Busy means too many messages are already pending.
+	Busy
+	// Banned means the sender is temporarily banned.
+	Banned
+)
+
+func (v Verdict) String() string {
+	switch v {
+	case Allowed:
+		return "allowed"
+	case Throttled:
+		return "throttled"
+	case Busy:
+		return "busy"
+	case Banned:
+		return "banned"
+	}
+	return "unknown"
+}
+
+type bucket struct {
+	tokens float64
+	last   time.Time
+}
+
+// refill adds the tokens earned since the bucket's last use.
+func (b *bucket) refill(cfg config.BucketConfig, now time.Time) {
+	if b.last.IsZero() {
+		b.tokens = float64(cfg.Burst)
+	} else {
+		b.tokens += now.Sub(b.last).Minutes() * cfg.RefillPerMinute
+		if b.tokens > float64(cfg.Burst) {
+			b.tokens = float64(cfg.Burst)
+		}
+	}
+	b.last = now
+}
+
+type senderState struct {
+	bucket      bucket
+	violations  []time.Time
+	bannedUntil time.Time
+	notified    bool // told about the current throttle/ban already
+}
+
+// Limiter applies per-sender and per-channel token buckets, a global cap on
+// pending messages and temporary bans after repeated violations.
+type Limiter struct {
+	cfg    config.RateLimitConfig
+	exempt map[string]struct{}
+
+	mu       sync.Mutex
+	senders  map[string]*senderState
+	channels map[string]*bucket
+	pending  int
+	now      func() time.Time
+}
+
+// New returns a limiter for cfg, or nil if rate limiting is disabled.
+// A nil *Limiter allows everything.
+func New(cfg config.RateLimitConfig) *Limiter {
+	if !cfg.Enabled {
+		return nil
+	}
+	l := &Limiter{
+		cfg:      cfg,
+		exempt:   make(map[string]struct{}),
+		senders:  make(map[string]*senderState),
+		channels: make(map[string]*bucket),
+		now:      time.Now,
+	}
+	for _, id := range cfg.Exempt {
+		l.exempt[id] = struct{}{}
+	}
+	return l
+}
+
+// Allow decides whether a message from sender on channel may be processed.
+// An allowed message counts as pending until Done is called for it. notify
+// is true the first time a sender is refused after being let through, so
+// callers can answer once instead of on every message.
+func (l *Limiter) Allow(channel, sender string) (v Verdict, notify bool) {
+	if l == nil {
+		return Allowed, false
+	}
+	if _, ok := l.exempt[channel+":"+sender]; ok {
+		l.Admit()
+		return Allowed, false
+	}
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	now := l.now()
+	key := channel + ":" + sender
+	st, ok := l.senders[key]
+	if !ok {
+		if len(l.senders) >= maxTrackedSenders {
+			l.prune(now)
+		}
+		st = &senderState{}
+		l.senders[key] = st
+	}
+
+	if now.Before(st.bannedUntil) {
+		Stats.Add("dropped_banned", 1)
+		return Banned, false
+	}
+
+	// check both buckets before taking from either, so a message refused
+	// by one doesn't use up the other
+	var senderBucket, channelBucket *bucket
+	if l.cfg.PerSender.Burst > 0 {
+		senderBucket = &st.bucket
+		senderBucket.refill(l.cfg.PerSender, now)
+	}
+	if l.cfg.PerChannel.Burst > 0 {
+		channelBucket = l.channelBucket(channel)
+		channelBucket.refill(l.cfg.PerChannel, now)
+	}
+	v = Allowed
+	ownExcess := false
+	switch {
+	case l.cfg.MaxPending > 0 && l.pending >= l.cfg.MaxPending:
+		v = Busy
+	case senderBucket != nil && senderBucket.tokens < 1:
+		v, ownExcess = Throttled, true
+	case channelBucket != nil && channelBucket.tokens < 1:
+		v = Throttled
+	}
+	if v == Allowed {
+		for _, b := range []*bucket{senderBucket, channelBucket} {
+			if b != nil {
+				b.tokens--
+			}
+		}
+		st.notified = false
+		l.pending++
+		return Allowed, false
+	}
+	Stats.Add(v.String(), 1)
+
+	// Only the sender's own excess counts towards a ban, not a busy server
+	// or a channel others have filled.
+	if ownExcess && l.cfg.BanAfter > 0 {
+		window := time.Duration(l.cfg.BanWindowS) * time.Second
+		recent := st.violations[:0]
+		for _, t := range st.violations {
+			if now.Sub(t) < window {
+				recent = append(recent, t)
+			}
+		}
+		st.violations = append(recent, now)
+		if len(st.violations) >= l.cfg.BanAfter {
+			st.violations = nil
+			st.bannedUntil = now.Add(time.Duration(l.cfg.BanDurationS) * time.Second)
+			st.notified = false
+			Stats.Add("bans", 1)
+			v = Banned
+		}
+	}
+
+	notify = !st.notified
+	st.notified = true
+	return v, notify
+}
+
+// prune forgets senders that are neither banned nor recently active, so
+// open mode can't grow the table without bound.
+func (l *Limiter) prune(now time.Time) {
+	for key, st := range l.senders {
+		if now.After(st.bannedUntil) && now.Sub(st.bucket.last) > time.Hour {
+			delete(l.senders, key)
+		}
+	}
+}
+
+func (l *Limiter) channelBucket(channel string) *bucket {
+	b, ok := l.channels[channel]
+	if !ok {
+		b = &bucket{}
+		l.channels[channel] = b
+	}
+	return b
+}
+
+// Admit counts a message as pending without applying any limit. It is used
+// for picobot's own messages (heartbeat, cron), which are never throttled.
+func (l *Limiter) Admit() {
+	if l == nil {
+		return
+	}
+	l.mu.Lock()
+	l.pending++
+	l.mu.Unlock()
+}
+
+// Done marks an allowed message as answered.
+func (l *Limiter) Done() {
+	if l == nil {
+		return
+	}
+	l.mu.Lock()
+	if l.pending > 0 {
+		l.pending--
+	}
+	l.mu.Unlock()
+}
+
+// BannedFor returns how much longer the sender stays banned.
+func (l *Limiter) BannedFor(channel, sender string) time.Duration {
+	if l == nil {
+		return 0
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if st, ok := l.senders[channel+":"+sender]; ok {
+		if d := st.bannedUntil.Sub(l.now()); d > 0 {
+			return d
+		}
+	}
+	return 0
+}
+
+// Message returns the throttle reply.
+func (l *Limiter) Message() string {
+	if l == nil || l.cfg.Message == "" {
+		return DefaultMessage
+	}
+	return l.cfg.Message
+}
@@ -0,0 +1,101 @@
+package users
+
+import (
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/local/picobot/internal/config"
+)
+
+// User is a person known to picobot, possibly reachable on several channels.
+type User struct {
+	Name          string
+	Roles         []string
+	Profile       string
+	ShareSessions bool
+	ShareMemory   bool
+}
+
+// HasRole reports whether the user has the given role.
+func (u *User) HasRole(role string) bool {
+	if u == nil {
+		return false
+	}
+	for _, r := range u.Roles {
+		if r == role {
+			return true
+		}
+	}
+	return false
+}
+
+// Directory maps channel-specific sender IDs to canonical users.
+type Directory struct {
+	workspace  string
+	byIdentity map[string]*User
+}
+
+// NewDirectory builds a directory from the users section of the config.
+// Identities are "channel:senderID"; an identity claimed by two users is
+// kept for the first and logged.
+func NewDirectory(cfg []config.UserConfig, workspace string) *Directory {
+	d := &Directory{workspace: workspace, byIdentity: make(map[string]*User)}
+	for _, uc := range cfg {
+		if uc.Name == "" {
+			log.Printf("users: skipping entry without a name")
+			continue
+		}
+		u := &User{
+			Name:          uc.Name,
+			Roles:         uc.Roles,
+			Profile:       strings.TrimSpace(uc.Profile),
+			ShareSessions: uc.ShareSessions,
+			ShareMemory:   uc.ShareMemory,
+		}
+		for _, id := range uc.Identities {
+			if !strings.Contains(id, ":") {
+				log.Printf("users: identity %q of %s is not channel:senderID, ignoring", id, uc.Name)
+				continue
+			}
+			if other, ok := d.byIdentity[id]; ok {
+				log.Printf("users: identity %s already belongs to %s, ignoring for %s", id, other.Name, uc.Name)
+				continue
+			}
+			d.byIdentity[id] = u
+		}
+	}
+	return d
+}
+
+// Lookup returns the user behind a sender on a channel, or nil if unknown.
+func (d *Directory) Lookup(channel, senderID string) *User {
+	if d == nil {
+		return nil
+	}
+	return d.byIdentity[channel+":"+senderID]
+}
+
+// ProfileText returns the user's profile from config followed by the
+// workspace file users/<name>.md, which the agent can maintain itself.
+func (d *Directory) ProfileText(u *User) string {
+	if u == nil {
+		return ""
+	}
+	parts := []string{}
+	if u.Profile != "" {
+		parts = append(parts, u.Profile)
+	}
+	if data, err := os.ReadFile(d.ProfilePath(u)); err == nil {
+		if s := strings.TrimSpace(string(data)); s != "" {
+			parts = append(parts, s)
+		}
+	}
+	return strings.Join(parts, "\n\n")
+}
+
+// ProfilePath is the workspace file holding notes about u.
+func (d *Directory) ProfilePath(u *User) string {
+	return filepath.Join(d.workspace, "users", u.Name+".md")
+}